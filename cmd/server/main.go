@@ -1,23 +1,88 @@
 package main
 
 import (
+	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"literary-lions/internal/admin"
 	"literary-lions/internal/auth"
+	"literary-lions/internal/config"
 	"literary-lions/internal/db"
+	"literary-lions/internal/mail"
 	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/oidc"
 	"literary-lions/internal/pages"
+	"literary-lions/internal/password"
 	"literary-lions/internal/views"
 )
 
 func main() {
-	// Open (or create) the SQLite database file
-	dbConn, err := db.InitDB("forum.db")
+	// Settings come from LIONS_* environment variables (see internal/config)
+	cfg := config.Load()
+
+	// "server migrate ..." manages the schema without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg.DBPath, os.Args[2:]))
+	}
+	// "server role ..." sets a user's role (e.g. to appoint the first admin)
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		os.Exit(runRole(cfg.DBPath, os.Args[2:]))
+	}
+
+	// Settings the server cannot run with stop it here, rather than break pages later
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Open (or create) the SQLite database file and apply pending migrations
+	dbConn, fullText, err := db.InitDB(cfg.DBPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Mail goes out through SMTP if configured, otherwise to files or the log
+	var mailer mail.Mailer = mail.LogMailer{Dir: cfg.MailDir, From: cfg.MailFrom}
+	if cfg.SMTPAddr != "" {
+		mailer = mail.SMTPMailer{Addr: cfg.SMTPAddr, From: cfg.MailFrom, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}
+	}
+
+	// Expired sessions are removed, and due account deletions carried out, now and then
+	go housekeeping(dbConn, time.Hour)
+
+	// Failed logins (passwords and two-factor codes) are rate limited
+	loginThrottle := auth.NewLoginThrottle(dbConn, cfg.LoginMaxFailures, cfg.LoginLockout)
+
+	// New passwords must be long and hard enough to guess, and not known leaked
+	policy := password.Policy{MinLength: cfg.PasswordMinLength, MinScore: cfg.PasswordMinScore}
+	if cfg.BreachedPasswords != "" {
+		if policy.Breached, err = password.LoadBreached(cfg.BreachedPasswords); err != nil {
+			log.Fatal("Could not load the breached password list: ", err)
+		}
+	}
+
+	// Passwords are hashed with the configured algorithm, and older hashes upgraded on login
+	hasher, err := password.NewHasher(cfg.PasswordHash, cfg.BcryptCost)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Members may log in through OpenID Connect providers too
+	var providers []*oidc.Provider
+	for _, p := range cfg.OIDCProviders {
+		providers = append(providers, oidc.New(oidc.Config{
+			Name:         p.Name,
+			Label:        p.Label,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  cfg.BaseURL + "/login/oidc/" + p.Name + "/callback",
+		}, nil))
+	}
+
 	// Parse and cache all HTML templates for rendering pages
 	views.InitTemplates()
 
@@ -27,28 +92,58 @@ func main() {
 	// Serve static files (CSS, JS, images) from /static/ URL
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
 
-	// Page routes:
+	// Page routes (DenySuspended: suspended users may only read here;
+	// DenyUnverified: users must confirm their email before posting here):
 	mux.HandleFunc("/about", pages.AboutPageHandler(dbConn))
 	mux.HandleFunc("/terms", pages.TermsPageHandler(dbConn))
-	mux.HandleFunc("/signup", auth.NewSignupHandler(dbConn))
-	mux.HandleFunc("/login", auth.NewLoginHandler(dbConn))
+	mux.HandleFunc("/signup", auth.NewSignupHandler(dbConn, mailer, cfg.BaseURL, policy, hasher))
+	mux.HandleFunc("/login", auth.NewLoginHandler(dbConn, loginThrottle, hasher, providers))
+	mux.HandleFunc("GET /login/oidc/{provider}", auth.NewOIDCLoginHandler(dbConn, providers))
+	mux.HandleFunc("GET /login/oidc/{provider}/callback", auth.NewOIDCCallbackHandler(dbConn, providers, mailer, cfg.BaseURL))
+	mux.HandleFunc("/login/2fa", auth.NewTwoFactorLoginHandler(dbConn, loginThrottle, providers))
 	mux.HandleFunc("/logout", auth.NewLogoutHandler(dbConn))
-	mux.HandleFunc("/u/", pages.NewProfileHandler(dbConn))
+	mux.HandleFunc("/forgot", auth.NewForgotPasswordHandler(dbConn, mailer, cfg.BaseURL))
+	mux.HandleFunc("/reset/{token}", auth.NewResetPasswordHandler(dbConn, policy, hasher))
+	mux.HandleFunc("GET /verify/{token}", auth.NewVerifyEmailHandler(dbConn))
+	mux.HandleFunc("POST /verify/resend", auth.NewResendVerificationHandler(dbConn, mailer, cfg.BaseURL))
+	mux.HandleFunc("/u/", pages.NewProfileHandler(dbConn, cfg.PageSize))
 	mux.HandleFunc("/profile", pages.NewMyProfileHandler(dbConn))
-	mux.HandleFunc("/createpost", pages.NewCreatePostHandler(dbConn))
-	mux.HandleFunc("/like", pages.NewLikeHandler(dbConn))
-	mux.HandleFunc("/deletecomment", pages.NewDeleteCommentHandler(dbConn))
-	mux.HandleFunc("/deletepost", pages.NewDeletePostHandler(dbConn))
-	mux.Handle("/category/", pages.NewCategoryHandler(dbConn))
-	mux.HandleFunc("/post/", pages.NewShowPostHandler(dbConn))
-	mux.HandleFunc("/comment-like", pages.NewCommentLikeHandler(dbConn))
-	mux.HandleFunc("/search", pages.NewSearchHandler(dbConn))
+	mux.HandleFunc("/settings", auth.NewAccountSettingsHandler(dbConn, mailer, cfg.BaseURL, policy, hasher))
+	mux.HandleFunc("/settings/data", auth.NewDataHandler(dbConn, cfg.DeletionGrace, hasher))
+	mux.HandleFunc("POST /settings/export", auth.NewExportHandler(dbConn))
+	mux.HandleFunc("/settings/sessions", auth.NewSessionsHandler(dbConn))
+	mux.HandleFunc("/settings/2fa", auth.NewTwoFactorSettingsHandler(dbConn, hasher))
+	mux.HandleFunc("GET /settings/2fa/qr.png", auth.NewTwoFactorQRHandler(dbConn))
+	mux.HandleFunc("/settings/identities", auth.NewIdentitiesHandler(dbConn, providers, hasher))
+	mux.Handle("/createpost", middleware.DenySuspended(middleware.DenyUnverified(pages.NewCreatePostHandler(dbConn))))
+	mux.Handle("/like", middleware.DenySuspended(pages.NewLikeHandler(dbConn)))
+	mux.Handle("/deletecomment", middleware.DenySuspended(pages.NewDeleteCommentHandler(dbConn)))
+	mux.Handle("/editcomment", middleware.DenySuspended(middleware.DenyUnverified(pages.NewEditCommentHandler(dbConn))))
+	mux.Handle("/deletepost", middleware.DenySuspended(pages.NewDeletePostHandler(dbConn)))
+	mux.Handle("/lockpost", middleware.DenySuspended(pages.NewLockPostHandler(dbConn)))
+	mux.Handle("/report", middleware.DenySuspended(pages.NewReportHandler(dbConn)))
+	mux.Handle("/category/", pages.NewCategoryHandler(dbConn, cfg.PageSize))
+	mux.Handle("/post/", middleware.DenySuspended(middleware.DenyUnverified(pages.NewShowPostHandler(dbConn, cfg.CommentMaxDepth, cfg.CommentCollapseDepth))))
+	mux.Handle("/post/{id}/edit", middleware.DenySuspended(middleware.DenyUnverified(pages.NewEditPostHandler(dbConn))))
+	mux.HandleFunc("GET /post/{id}/history", pages.NewPostHistoryHandler(dbConn))
+	mux.Handle("/comment-like", middleware.DenySuspended(pages.NewCommentLikeHandler(dbConn)))
+	mux.HandleFunc("/search", pages.NewSearchHandler(dbConn, cfg.PageSize, fullText))
+	mux.HandleFunc("GET /tag/{name}", pages.NewTagHandler(dbConn, cfg.PageSize))
+
+	// Moderation routes (moderators and admins):
+	mux.Handle("/mod/reports", middleware.RequireRole(models.RoleModerator)(admin.NewReportsHandler(dbConn)))
+	mux.Handle("/mod/sanctions", middleware.RequireRole(models.RoleModerator)(admin.NewSanctionsHandler(dbConn)))
+
+	// Admin routes (admins only):
+	mux.Handle("/admin/users", middleware.RequireRole(models.RoleAdmin)(admin.NewUsersHandler(dbConn)))
+	mux.Handle("/admin/categories", middleware.RequireRole(models.RoleAdmin)(admin.NewCategoriesHandler(dbConn)))
+	mux.Handle("GET /admin/audit", middleware.RequireRole(models.RoleAdmin)(admin.NewAuditHandler(dbConn, cfg.PageSize)))
 
 	// fallback for "/" and 404s
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// Home page for "/"
 		if r.URL.Path == "/" {
-			pages.NewHomeHandler(dbConn)(w, r)
+			pages.NewHomeHandler(dbConn, cfg.PageSize)(w, r)
 			return
 		}
 		// Everything else = 404
@@ -60,9 +155,39 @@ func main() {
 		middleware.ErrorHandler(w, http.StatusNotFound, "Page not found", loggedIn, username)
 	})
 
-	// Compose middleware: session management + panic recovery
-	handler := middleware.RecoverMiddleware(middleware.NewWithSession(dbConn)(mux))
+	// Compose middleware: session management + CSRF checks + panic recovery
+	handler := middleware.RecoverMiddleware(middleware.NewWithSession(dbConn)(middleware.RequireCSRF(mux)))
+
+	log.Printf("Server starting at %s...", cfg.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Addr, handler))
+}
 
-	log.Println("Server starting at http://localhost:8080...")
-	log.Fatal(http.ListenAndServe(":8080", handler))
+// housekeeping removes expired sessions and deletes the accounts whose
+// deletion is due (with the images of erased posts), at startup and then
+// every interval.
+func housekeeping(dbConn *sql.DB, interval time.Duration) {
+	for {
+		if n, err := db.PurgeExpiredSessions(dbConn); err != nil {
+			log.Println("Could not purge expired sessions:", err)
+		} else if n > 0 {
+			log.Printf("Purged %d expired session(s)", n)
+		}
+
+		n, images, err := db.DeleteDueAccounts(dbConn)
+		if err != nil {
+			log.Println("Could not delete accounts:", err)
+		}
+		if n > 0 {
+			log.Printf("Deleted %d account(s)", n)
+		}
+		for _, img := range images {
+			if file := pages.UploadFile(img); file != "" {
+				if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+					log.Println("Could not remove image of deleted post:", err)
+				}
+			}
+		}
+
+		time.Sleep(interval)
+	}
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"literary-lions/internal/db"
+)
+
+// runMigrate implements the "migrate" subcommand:
+//
+//	server migrate status      list migrations and whether they are applied
+//	server migrate up          apply all pending migrations
+//	server migrate down [n]    roll back the last n migrations (default 1)
+//
+// It returns the process exit code.
+func runMigrate(dbPath string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: server migrate status|up|down [n]")
+		return 2
+	}
+
+	dbConn, err := db.OpenDB(dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer dbConn.Close()
+
+	switch args[0] {
+	case "status":
+		states, err := db.MigrationStatus(dbConn)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, s := range states {
+			status := "pending"
+			if s.Applied {
+				status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-32s %s\n", s.Version, s.Name, status)
+		}
+
+	case "up":
+		n, err := db.MigrateUp(dbConn)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Applied %d migration(s).\n", n)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "down expects a positive number of steps")
+				return 2
+			}
+		}
+		n, err := db.MigrateDown(dbConn, steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Rolled back %d migration(s).\n", n)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/models"
+)
+
+// runRole implements the "role" subcommand, which sets a user's role from
+// the command line (e.g. to appoint the first admin):
+//
+//	server role <username> member|admin
+//	server role <username> moderator <category>...
+//
+// Categories are given by name. It returns the process exit code.
+func runRole(dbPath string, args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: server role <username> member|moderator|admin [category...]")
+		return 2
+	}
+	username, role, names := args[0], args[1], args[2:]
+	if role == models.RoleModerator && len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "a moderator needs at least one category")
+		return 2
+	}
+	if role != models.RoleModerator && len(names) > 0 {
+		fmt.Fprintln(os.Stderr, "only moderators are assigned categories")
+		return 2
+	}
+
+	// The role column may be newer than the database file
+	dbConn, _, err := db.InitDB(dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer dbConn.Close()
+
+	categories, err := db.FetchCategories(dbConn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var ids []int
+	for _, name := range names {
+		found := false
+		for _, c := range categories {
+			if strings.EqualFold(c.Name, name) {
+				ids = append(ids, c.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "no category named %q\n", name)
+			return 1
+		}
+	}
+
+	err = db.SetUserRole(dbConn, 0, username, role, ids)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Fprintf(os.Stderr, "no user named %q\n", username)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s now has the role %s.\n", username, role)
+	return 0
+}
@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/pages"
+	"literary-lions/internal/views"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout is the format of the audit log's from/to date filters.
+const dateLayout = "2006-01-02"
+
+// AuditPageData holds everything needed to render the audit log page.
+type AuditPageData struct {
+	models.BasePageData
+	Categories  []models.Category
+	Entries     []models.AuditEntry
+	Pager       models.Pager
+	Filter      url.Values // the filter form's values, to fill it in again
+	Actions     []string
+	TargetTypes []string
+	CSVURL      string
+	Error       string
+}
+
+// NewAuditHandler serves /admin/audit, the log of moderator and admin
+// actions, newest first and pageSize per page. It can be filtered with
+// ?actor=, ?action=, ?target= (type), ?target_id=, ?from= and ?to=
+// (inclusive dates, YYYY-MM-DD); ?format=csv downloads every matching entry.
+func NewAuditHandler(dbConn *sql.DB, pageSize int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, username, loggedIn := middleware.CurrentUser(r)
+		q := r.URL.Query()
+		data := AuditPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+			Filter:       q,
+			Actions:      db.AuditActions,
+			TargetTypes:  db.AuditTargetTypes,
+		}
+
+		// 1. Read the filter
+		filter, problem := auditFilter(q)
+		if problem != "" {
+			data.Error = problem
+		}
+
+		// 2. CSV export: every matching entry, no paging
+		if q.Get("format") == "csv" && problem == "" {
+			entries, _, err := db.FetchAuditLog(dbConn, filter, 0, 0)
+			if err != nil {
+				log.Println("DB problem:", err)
+				middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not export the audit log.", loggedIn, username)
+				return
+			}
+			writeAuditCSV(w, entries)
+			return
+		}
+
+		// 3. One page of entries
+		pageNum, _ := strconv.Atoi(q.Get("page"))
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		if problem == "" {
+			entries, more, err := db.FetchAuditLog(dbConn, filter, (pageNum-1)*pageSize, pageSize)
+			if err != nil {
+				log.Println("DB problem:", err)
+				middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not load the audit log.", loggedIn, username)
+				return
+			}
+			data.Entries = entries
+			data.Pager = pages.NumberedPagerLinks(r, pageNum, more)
+
+			csvQuery := r.URL.Query()
+			csvQuery.Del("page")
+			csvQuery.Set("format", "csv")
+			data.CSVURL = r.URL.Path + "?" + csvQuery.Encode()
+		}
+		data.Categories, _ = db.FetchCategories(dbConn)
+
+		// 4. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "admin_audit.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// auditFilter reads the audit log filter from the query string. It returns
+// a message for the admin if a value cannot be understood.
+func auditFilter(q url.Values) (db.AuditFilter, string) {
+	f := db.AuditFilter{
+		Actor:      strings.TrimSpace(q.Get("actor")),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target"),
+	}
+	if s := strings.TrimSpace(q.Get("target_id")); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return f, "The target ID must be a number."
+		}
+		f.TargetID = id
+	}
+	for _, d := range []struct {
+		key string
+		dst *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		s := strings.TrimSpace(q.Get(d.key))
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(dateLayout, s)
+		if err != nil {
+			return f, "Dates must look like " + dateLayout + "."
+		}
+		*d.dst = t
+	}
+	if !f.To.IsZero() {
+		f.To = f.To.AddDate(0, 0, 1) // include the whole "to" day
+	}
+	return f, ""
+}
+
+// csvCell quotes text that spreadsheet programs would take for a formula
+// (starting with =, +, -, @, a tab or a carriage return) with a leading '.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeAuditCSV sends audit log entries as a CSV download.
+func writeAuditCSV(w http.ResponseWriter, entries []models.AuditEntry) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-log.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "time", "actor_id", "actor", "action", "target_type", "target_id", "reason", "before", "after"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.Itoa(e.ID),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(e.ActorID),
+			csvCell(e.Actor),
+			csvCell(e.Action),
+			csvCell(e.TargetType),
+			strconv.Itoa(e.TargetID),
+			csvCell(e.Reason),
+			csvCell(e.Before),
+			csvCell(e.After),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Println("CSV export failed:", err)
+	}
+}
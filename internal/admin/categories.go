@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/views"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CategoriesPageData holds everything needed to render the category
+// management page.
+type CategoriesPageData struct {
+	models.BasePageData
+	Categories []models.Category // for the sidebar
+	All        []models.Category // every category, archived ones included
+	Error      string
+	Notice     string
+}
+
+// NewCategoriesHandler serves /admin/categories.
+//   - GET: List all categories with their post counts.
+//   - POST: Apply the form's action: create, update (rename and describe),
+//     up/down (reorder), archive, restore or merge.
+func NewCategoriesHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		data := CategoriesPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+		}
+
+		// 1. Apply the requested change, then show the result on the same page
+		if r.Method == http.MethodPost {
+			notice, err := applyCategoryAction(dbConn, r, userID)
+			switch {
+			case err == nil:
+				log.Printf("Admin %s: %s", username, notice)
+				data.Notice = notice
+			case errors.Is(err, sql.ErrNoRows):
+				data.Error = "That category no longer exists or has been merged."
+			case errors.Is(err, db.ErrCategoryExists):
+				data.Error = "A category with this name already exists."
+			case errors.As(err, new(formError)):
+				data.Error = err.Error()
+			default:
+				log.Println("DB problem:", err)
+				data.Error = "Could not save the change."
+			}
+		}
+
+		// 2. Load the categories
+		all, err := db.FetchAllCategories(dbConn)
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not load the categories.", loggedIn, username)
+			return
+		}
+		data.All = all
+		data.Categories, _ = db.FetchCategories(dbConn)
+
+		// 3. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "admin_categories.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// formError is a problem with what the admin entered.
+type formError string
+
+func (e formError) Error() string { return string(e) }
+
+// applyCategoryAction carries out one form submission by adminID and
+// describes what was done.
+func applyCategoryAction(dbConn *sql.DB, r *http.Request, adminID int) (string, error) {
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	name := strings.TrimSpace(r.FormValue("name"))
+	description := strings.TrimSpace(r.FormValue("description"))
+
+	switch action := r.FormValue("action"); action {
+	case "create":
+		if name == "" {
+			return "", formError("A category needs a name.")
+		}
+		if _, err := db.CreateCategory(dbConn, adminID, name, description); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Created %q.", name), nil
+
+	case "update":
+		if name == "" {
+			return "", formError("A category needs a name.")
+		}
+		if err := db.UpdateCategory(dbConn, adminID, id, name, description); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Saved %q.", name), nil
+
+	case "up", "down":
+		if err := db.MoveCategory(dbConn, adminID, id, action == "up"); err != nil {
+			return "", err
+		}
+		return "Moved category " + strconv.Itoa(id) + " " + action + ".", nil
+
+	case "archive", "restore":
+		if err := db.SetCategoryArchived(dbConn, adminID, id, action == "archive"); err != nil {
+			return "", err
+		}
+		if action == "archive" {
+			return "Archived category " + strconv.Itoa(id) + ".", nil
+		}
+		return "Restored category " + strconv.Itoa(id) + ".", nil
+
+	case "merge":
+		into, _ := strconv.Atoi(r.FormValue("into"))
+		if into == 0 || into == id {
+			return "", formError("Choose another category to merge into.")
+		}
+		moved, err := db.MergeCategory(dbConn, adminID, id, into)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Merged category %d into %d (%d post(s) moved).", id, into, moved), nil
+	}
+	return "", formError("Unknown action.")
+}
@@ -0,0 +1,149 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/views"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportsPageData holds everything needed to render the moderation queue.
+type ReportsPageData struct {
+	models.BasePageData
+	Categories []models.Category
+	Groups     []models.ReportGroup
+	Error      string
+	Notice     string
+}
+
+// NewReportsHandler serves /mod/reports, the queue of open reports for
+// moderators (their categories) and admins (everything).
+//   - GET: List reported posts and comments, most reported first, with
+//     every report and how often each reporter's reports were dismissed.
+//   - POST: Handle one reported post or comment (post_id, comment_id):
+//     resolve or dismiss its reports, delete it, or ban or suspend its
+//     author for a number of days or until lifted.
+func NewReportsHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		data := ReportsPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+		}
+
+		// 1. Apply the moderator's decision, then show the queue again
+		if r.Method == http.MethodPost {
+			notice, err := handleReport(dbConn, r, userID)
+			switch {
+			case err == nil:
+				log.Printf("Moderator %s: %s", username, notice)
+				data.Notice = notice
+			case errors.Is(err, sql.ErrNoRows):
+				data.Error = "This has already been handled, or you may not moderate it."
+			case errors.As(err, new(formError)):
+				data.Error = err.Error()
+			default:
+				log.Println("DB problem:", err)
+				data.Error = "Could not handle the report."
+			}
+		}
+
+		// 2. Load the open reports this user may handle
+		groups, err := db.FetchReportQueue(dbConn, userID)
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not load the reports.", loggedIn, username)
+			return
+		}
+		data.Groups = groups
+		data.Categories, _ = db.FetchCategories(dbConn)
+
+		// 3. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "mod_reports.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// handleReport carries out one queue action for moderatorID and describes
+// what was done.
+func handleReport(dbConn *sql.DB, r *http.Request, moderatorID int) (string, error) {
+	postID, _ := strconv.Atoi(r.FormValue("post_id"))
+	commentID, _ := strconv.Atoi(r.FormValue("comment_id"))
+	what := fmt.Sprintf("post %d", postID)
+	if commentID != 0 {
+		what = fmt.Sprintf("comment %d", commentID)
+	}
+
+	// The moderator must be allowed to moderate where the content lives
+	post, err := db.GetPost(dbConn, postID, moderatorID)
+	if err != nil {
+		return "", err
+	}
+	if ok, err := db.CanModerate(dbConn, moderatorID, post.CategoryID); err != nil || !ok {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return "", err
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+
+	switch action := r.FormValue("action"); action {
+	case "resolve", "dismiss":
+		status := db.ReportResolved
+		if action == "dismiss" {
+			status = db.ReportDismissed
+		}
+		n, err := db.CloseReports(dbConn, postID, commentID, moderatorID, status, reason)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Marked %d report(s) about %s as %s.", n, what, status), nil
+
+	case "delete":
+		if _, err := db.DeleteReported(dbConn, postID, commentID, moderatorID, reason); err != nil {
+			return "", err
+		}
+		return "Deleted " + what + ".", nil
+
+	case "ban", "suspend":
+		kind := db.SanctionBan
+		if action == "suspend" {
+			kind = db.SanctionSuspension
+		}
+		var expires time.Time
+		if days, _ := strconv.Atoi(r.FormValue("days")); days > 0 {
+			expires = time.Now().AddDate(0, 0, days)
+		}
+		authorID, err := db.AuthorOf(dbConn, postID, commentID)
+		if err != nil {
+			return "", err
+		}
+		if err := db.SanctionUser(dbConn, authorID, moderatorID, kind, reason, expires); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return "", formError("Only members can be banned or suspended.")
+			}
+			return "", err
+		}
+		if _, err := db.CloseReports(dbConn, postID, commentID, moderatorID, db.ReportResolved, reason); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+		verb := "Banned"
+		if kind == db.SanctionSuspension {
+			verb = "Suspended"
+		}
+		return fmt.Sprintf("%s the author of %s.", verb, what), nil
+	}
+	return "", formError("Unknown action.")
+}
@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/views"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SanctionsPageData holds everything needed to render the list of bans and
+// suspensions in force.
+type SanctionsPageData struct {
+	models.BasePageData
+	Categories []models.Category
+	Sanctions  []models.Sanction
+	Error      string
+	Notice     string
+}
+
+// NewSanctionsHandler serves /mod/sanctions.
+//   - GET: List the bans and suspensions in force.
+//   - POST: Lift one early (id, optional reason). Moderators may lift the
+//     sanctions they imposed, admins any.
+func NewSanctionsHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		data := SanctionsPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+		}
+
+		// 1. Lift a sanction, then show the list again
+		if r.Method == http.MethodPost {
+			id, _ := strconv.Atoi(r.FormValue("id"))
+			err := db.LiftSanction(dbConn, id, userID, strings.TrimSpace(r.FormValue("reason")))
+			switch {
+			case err == nil:
+				log.Printf("Moderator %s lifted sanction %d", username, id)
+				data.Notice = "Lifted."
+			case errors.Is(err, sql.ErrNoRows):
+				data.Error = "This has already ended, or you may not lift it."
+			default:
+				log.Println("DB problem:", err)
+				data.Error = "Could not lift it."
+			}
+		}
+
+		// 2. Load the sanctions in force
+		sanctions, err := db.FetchActiveSanctions(dbConn)
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not load the sanctions.", loggedIn, username)
+			return
+		}
+		data.Sanctions = sanctions
+		data.Categories, _ = db.FetchCategories(dbConn)
+
+		// 3. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "mod_sanctions.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Package admin serves the staff pages: /mod/ for moderators and admins,
+// /admin/ for admins only (see middleware.RequireRole).
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/views"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UsersPageData holds everything needed to render the staff management page.
+type UsersPageData struct {
+	models.BasePageData
+	Staff      []db.StaffMember
+	Roles      []string
+	Categories []models.Category
+	Require2FA bool // staff must use two-factor authentication
+	Error      string
+	Notice     string
+}
+
+// NewUsersHandler serves /admin/users, where admins appoint moderators and
+// other admins.
+//   - GET: List the current staff and show the role form.
+//   - POST: Set the role of the user named in the form; moderators get the
+//     selected categories. Admins cannot change their own role.
+//   - POST action=require_2fa: Set whether moderators and admins must use
+//     two-factor authentication.
+func NewUsersHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		data := UsersPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+			Roles:        models.Roles,
+		}
+
+		// 1. Apply a policy or role change, then show the result on the same page
+		if r.Method == http.MethodPost && r.FormValue("action") == "require_2fa" {
+			value := "0"
+			if r.FormValue("require") == "1" {
+				value = "1"
+			}
+			if err := db.SetSetting(dbConn, userID, db.SettingRequireStaff2FA, value); err != nil {
+				log.Println("DB problem:", err)
+				data.Error = "Could not change the two-factor policy."
+			} else {
+				log.Printf("Admin %s set %s to %s", username, db.SettingRequireStaff2FA, value)
+				data.Notice = "Two-factor policy saved."
+			}
+		} else if r.Method == http.MethodPost {
+			target := strings.TrimSpace(r.FormValue("username"))
+			role := r.FormValue("role")
+			var categoryIDs []int
+			for _, v := range r.Form["category_id"] {
+				if id, err := strconv.Atoi(v); err == nil {
+					categoryIDs = append(categoryIDs, id)
+				}
+			}
+
+			switch {
+			case target == "":
+				data.Error = "Enter a username."
+			case strings.EqualFold(target, username):
+				data.Error = "You cannot change your own role."
+			case role == models.RoleModerator && len(categoryIDs) == 0:
+				data.Error = "Choose at least one category for a moderator."
+			default:
+				err := db.SetUserRole(dbConn, userID, target, role, categoryIDs)
+				switch {
+				case errors.Is(err, sql.ErrNoRows):
+					data.Error = "There is no user named " + target + "."
+				case err != nil:
+					log.Println("DB problem:", err)
+					data.Error = "Could not change the role."
+				default:
+					log.Printf("Admin %s made %s a %s", username, target, role)
+					data.Notice = target + " now has the role " + role + "."
+				}
+			}
+		}
+
+		// 2. Load the staff list, the policy and the categories for the form
+		staff, err := db.FetchStaff(dbConn)
+		if err == nil {
+			var require string
+			require, err = db.Setting(dbConn, db.SettingRequireStaff2FA)
+			data.Require2FA = require == "1"
+		}
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not load the staff list.", loggedIn, username)
+			return
+		}
+		data.Staff = staff
+		data.Categories, _ = db.FetchCategories(dbConn)
+
+		// 3. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "admin_users.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
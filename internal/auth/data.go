@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/pages"
+	"literary-lions/internal/password"
+	"literary-lions/internal/views"
+)
+
+// DataPageData holds the "your data" page: export and account deletion.
+type DataPageData struct {
+	models.BasePageData
+	Grace        int       // days between asking for deletion and the deletion
+	HasPassword  bool      // false for members who signed up through a provider
+	DeletionMode string    // of a scheduled deletion ("" if none)
+	DeletionDue  time.Time // ... and when it happens
+	Error        string
+	Notice       string
+}
+
+// NewDataHandler returns the handler for /settings/data, where users
+// download their data (see NewExportHandler) and delete their account.
+//   - GET: Show the export button, and the deletion form or, once deletion
+//     is scheduled, when it happens.
+//   - POST action=delete: Given the password (if any), schedule the account for
+//     deletion (mode erase or anonymize, see db.ScheduleAccountDeletion)
+//     grace from now, and log out everywhere. Logging in again before then
+//     leads back here.
+//   - POST action=cancel: Keep the account.
+func NewDataHandler(dbConn *sql.DB, grace time.Duration, hasher password.Hasher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		data := DataPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: true},
+			Grace:        int(grace.Hours() / 24),
+		}
+		var hash string
+		if err := dbConn.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hash); err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+		data.HasPassword = hash != db.NoPassword
+
+		// 1. Schedule or cancel the deletion
+		if r.Method == http.MethodPost {
+			switch r.FormValue("action") {
+			case "delete":
+				mode := r.FormValue("mode")
+				switch {
+				case mode != db.DeleteErase && mode != db.DeleteAnonymize:
+					data.Error = "Choose what should happen to your posts and comments."
+				case data.HasPassword && !hasher.Verify(hash, r.FormValue("password")):
+					data.Error = "That password is not right."
+				default:
+					if err := db.ScheduleAccountDeletion(dbConn, userID, mode, grace); err != nil {
+						log.Println("Could not schedule account deletion:", err)
+						middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not delete your account.", true, username)
+						return
+					}
+					log.Printf("User %s asked for their account to be deleted (%s)", username, mode)
+					clearSessionCookie(w)
+					http.Redirect(w, r, "/login?deleting=1", http.StatusSeeOther)
+					return
+				}
+			case "cancel":
+				if err := db.CancelAccountDeletion(dbConn, userID); err != nil {
+					log.Println("DB problem:", err)
+					middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+					return
+				}
+				log.Printf("User %s kept their account", username)
+				data.Notice = "Your account will not be deleted."
+			default:
+				data.Error = "Unknown action."
+			}
+		}
+
+		// 2. Is a deletion scheduled?
+		mode, due, err := db.AccountDeletion(dbConn, userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+		data.DeletionMode, data.DeletionDue = mode, due
+
+		// 3. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "settings_data.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// NewExportHandler returns the handler for POST /settings/export, which
+// sends the logged-in user a ZIP file of their data: JSON files of their
+// profile, posts, comments and likes, and the images they uploaded.
+func NewExportHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		x, err := db.ExportUser(dbConn, userID)
+		if err != nil {
+			log.Println("Export failed:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not gather your data.", true, username)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition",
+			`attachment; filename="literary-lions-`+time.Now().UTC().Format("2006-01-02")+`.zip"`)
+		w.Header().Set("Cache-Control", "no-store")
+		if err := writeExport(w, x); err != nil {
+			// The response has started, so all that is left is to log it
+			log.Printf("Export for %s failed: %v", username, err)
+			return
+		}
+		log.Printf("User %s downloaded their data", username)
+	}
+}
+
+// writeExport writes x as a ZIP file, with the uploaded images under images/.
+func writeExport(w io.Writer, x db.UserExport) error {
+	zw := zip.NewWriter(w)
+	for i := range x.Posts {
+		post := &x.Posts[i]
+		file := pages.UploadFile(post.ImageURL)
+		if file == "" {
+			continue
+		}
+		if err := addFile(zw, "images/"+filepath.Base(file), file); err != nil {
+			log.Printf("Export: skipping image %s: %v", file, err)
+			continue
+		}
+		post.Image = "images/" + filepath.Base(file)
+	}
+
+	for _, f := range []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", x.Profile},
+		{"posts.json", orEmpty(x.Posts)},
+		{"comments.json", orEmpty(x.Comments)},
+		{"likes.json", map[string][]db.ExportLike{"posts": orEmpty(x.PostLikes), "comments": orEmpty(x.CommentLikes)}},
+	} {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// addFile copies the file at src into the archive as name.
+func addFile(zw *zip.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, f)
+	return err
+}
+
+// orEmpty makes a nil slice come out as [] rather than null in JSON.
+func orEmpty[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/oidc"
+	"literary-lions/internal/password"
+	"literary-lions/internal/views"
+)
+
+// IdentitiesPageData holds the sign-in providers page.
+type IdentitiesPageData struct {
+	models.BasePageData
+	Providers   []ProviderLink
+	HasPassword bool // false for members who signed up through a provider
+	Error       string
+	Notice      string
+}
+
+// ProviderLink is a configured identity provider and the member's account
+// there, if connected.
+type ProviderLink struct {
+	Name     string
+	Label    string
+	Identity *models.Identity
+}
+
+// NewIdentitiesHandler returns the handler for /settings/identities, where
+// members connect identity providers to log in with.
+//   - GET: List the providers, and which are connected.
+//   - POST action=link: Given the current password (if the member has one),
+//     send the browser to the provider; it comes back through
+//     NewOIDCCallbackHandler.
+//   - POST action=unlink: Disconnect the provider, unless it is the
+//     member's only way to log in.
+func NewIdentitiesHandler(dbConn *sql.DB, providers []*oidc.Provider, hasher password.Hasher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		data := IdentitiesPageData{BasePageData: models.BasePageData{Username: username, LoggedIn: true}}
+		var hash string
+		if err := dbConn.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hash); err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+		data.HasPassword = hash != db.NoPassword
+
+		// 1. Report how connecting went (see NewOIDCCallbackHandler)
+		q := r.URL.Query()
+		if p := findProvider(providers, q.Get("linked")); p != nil {
+			data.Notice = "Connected. You can now log in with " + p.Label + "."
+		} else if p := findProvider(providers, q.Get("provider")); p != nil {
+			switch q.Get("error") {
+			case "taken":
+				data.Error = "That " + p.Label + " account is already connected to another member."
+			case "linked":
+				data.Error = "You have another " + p.Label + " account connected. Disconnect it first."
+			}
+		}
+
+		// 2. Connect or disconnect a provider
+		if r.Method == http.MethodPost {
+			p := findProvider(providers, r.FormValue("provider"))
+			switch {
+			case p == nil:
+				data.Error = "Unknown sign-in provider."
+			case r.FormValue("action") == "link":
+				if data.HasPassword && !hasher.Verify(hash, r.FormValue("current_password")) {
+					data.Error = "Your current password is not right."
+					break
+				}
+				if err := beginOIDC(w, r, dbConn, p, userID); err != nil {
+					log.Printf("Could not start connecting %s: %v", p.Name, err)
+					data.Error = p.Label + " is not available right now. Please try again later."
+					break
+				}
+				return
+			case r.FormValue("action") == "unlink":
+				err := db.UnlinkIdentity(dbConn, userID, p.Name)
+				switch {
+				case errors.Is(err, db.ErrLastLogin):
+					data.Error = p.Label + " is your only way to log in. Set a password first (under Account) or connect another provider."
+				case errors.Is(err, sql.ErrNoRows):
+					data.Error = p.Label + " is not connected."
+				case err != nil:
+					log.Println("Could not unlink identity:", err)
+					middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not disconnect "+p.Label+".", true, username)
+					return
+				default:
+					log.Printf("User %s disconnected %s", username, p.Name)
+					data.Notice = p.Label + " is disconnected."
+				}
+			default:
+				data.Error = "Unknown action."
+			}
+		}
+
+		// 3. List the providers
+		ids, err := db.UserIdentities(dbConn, userID)
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+		for _, p := range providers {
+			link := ProviderLink{Name: p.Name, Label: p.Label}
+			for i := range ids {
+				if ids[i].Provider == p.Name {
+					link.Identity = &ids[i]
+				}
+			}
+			data.Providers = append(data.Providers, link)
+		}
+
+		// 4. Render
+		if r.Method == http.MethodPost && data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "settings_identities.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
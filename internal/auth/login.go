@@ -6,19 +6,36 @@ import (
 	"net/http"
 	"time"
 
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/oidc"
+	"literary-lions/internal/password"
 	"literary-lions/internal/views"
-
-	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// NewLoginHandler returns an HTTP handler for the login page and POST login submissions
-func NewLoginHandler(dbConn *sql.DB) http.HandlerFunc {
+// NewLoginHandler returns an HTTP handler for the login page and POST login submissions.
+// Failed logins are rate limited by throttle. Users with two-factor authentication
+// on are sent on to /login/2fa (see NewTwoFactorLoginHandler) instead of logged in.
+// Password hashes older or weaker than what hasher makes are replaced once the
+// password checks out. The page also offers to log in with providers (see
+// NewOIDCLoginHandler).
+func NewLoginHandler(dbConn *sql.DB, throttle LoginThrottle, hasher password.Hasher, providers []*oidc.Provider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// --- Show login form on GET ---
 		if r.Method == http.MethodGet {
-			views.Templates.ExecuteTemplate(w, "login.html", nil)
+			data := map[string]any{"Providers": providers}
+			switch {
+			case r.URL.Query().Get("reset") == "1":
+				data["LoginNotice"] = "Your password has been changed. Log in with the new one."
+			case r.URL.Query().Get("signup") == "1":
+				data["LoginNotice"] = "Welcome! We've mailed you a link to confirm your email address. You can log in and read meanwhile, and post once it is confirmed."
+			case r.URL.Query().Get("verified") == "1":
+				data["LoginNotice"] = "Your email address is confirmed. Log in to start posting."
+			case r.URL.Query().Get("deleting") == "1":
+				data["LoginNotice"] = "Your account will be deleted. Changed your mind? Log in before then to keep it."
+			}
+			views.Render(w, r, "login.html", data)
 			return
 		}
 
@@ -26,6 +43,11 @@ func NewLoginHandler(dbConn *sql.DB) http.HandlerFunc {
 		email := r.FormValue("email")
 		password := r.FormValue("password")
 
+		// Refuse the attempt, before checking anything, if it comes too soon after failed ones
+		if throttle.refuse(w, r, providers, email) {
+			return
+		}
+
 		// Prepare variables for user DB lookup
 		var (
 			id       int
@@ -40,39 +62,135 @@ func NewLoginHandler(dbConn *sql.DB) http.HandlerFunc {
 		// If no user found or DB error, show invalid credentials (do not reveal which failed)
 		if err != nil {
 			log.Printf("Login DB lookup failed for email %s: %v", email, err)
-			views.Templates.ExecuteTemplate(w, "login.html", map[string]string{"LoginError": "Invalid credentials"})
+			loginFailed(w, r, throttle, providers, email)
 			return
 		}
 
 		// Compare hashed password from DB to the submitted password
-		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		if !hasher.Verify(hash, password) {
 			log.Printf("Login password mismatch for user %s", email)
-			views.Templates.ExecuteTemplate(w, "login.html", map[string]string{"LoginError": "Invalid credentials"})
+			loginFailed(w, r, throttle, providers, email)
 			return
 		}
 
-		// Generate a new session ID (UUID)
-		sID := uuid.NewString()
+		// Upgrade the stored hash while we have the password (a failure only costs the upgrade)
+		if hasher.NeedsRehash(hash) {
+			if newHash, err := hasher.Hash(password); err != nil {
+				log.Printf("Could not rehash the password of user %s: %v", email, err)
+			} else if err := db.RehashPassword(dbConn, id, newHash); err != nil {
+				log.Printf("Could not store the rehashed password of user %s: %v", email, err)
+			}
+		}
 
-		// Insert session into DB, valid for 30 days
-		_, err = dbConn.Exec(`INSERT INTO sessions(id,user_id,expires_at) VALUES(?,?,?)`,
-			sID, id, time.Now().Add(30*24*time.Hour))
+		// Banned users are refused, and users with two-factor authentication sent on for a code
+		if finishLogin(w, r, dbConn, providers, id, email) {
+			throttle.succeed(email)
+		}
+	}
+}
+
+// finishLogin logs in user id, whose first factor (a password, or an
+// identity provider) checked out, and says who it is in logs. Banned users
+// are refused, and users with two-factor authentication on sent to
+// /login/2fa for a code; the rest get a session and are redirected. It
+// reports whether a session was started.
+func finishLogin(w http.ResponseWriter, r *http.Request, dbConn *sql.DB, providers []*oidc.Provider, id int, who string) bool {
+	// Banned users cannot log in
+	sanction, sanctioned, err := db.ActiveSanction(dbConn, id)
+	if err != nil {
+		log.Printf("Sanction lookup failed for user %s: %v", who, err)
+		http.Error(w, "server error", 500)
+		return false
+	}
+	if sanctioned && sanction.Kind == db.SanctionBan {
+		log.Printf("Login refused for banned user %s", who)
+		msg := "This account has been banned"
+		if !sanction.Permanent() {
+			msg += " until " + sanction.ExpiresAt.Format("02 Jan 2006 15:04") + " UTC"
+		}
+		msg += "."
+		if sanction.Reason != "" {
+			msg += " Reason: " + sanction.Reason
+		}
+		loginError(w, r, providers, msg)
+		return false
+	}
+
+	// With two-factor authentication on, the code is still to come
+	twoFactor, err := db.TwoFactorEnabled(dbConn, id)
+	if err != nil {
+		log.Printf("Two-factor lookup failed for user %s: %v", who, err)
+		http.Error(w, "server error", 500)
+		return false
+	}
+	if twoFactor {
+		token, err := db.CreateLoginChallenge(dbConn, id, loginChallengeTTL)
 		if err != nil {
-			log.Printf("Failed to create session for user %s: %v", email, err)
+			log.Printf("Failed to create login challenge for user %s: %v", who, err)
 			http.Error(w, "server error", 500)
-			return
+			return false
 		}
+		setChallengeCookie(w, token, int(loginChallengeTTL.Seconds()))
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return false
+	}
+
+	// Log the user in and redirect to the homepage
+	if err := startSession(w, r, dbConn, id); err != nil {
+		log.Printf("Failed to create session for user %s: %v", who, err)
+		http.Error(w, "server error", 500)
+		return false
+	}
+	http.Redirect(w, r, landingPage(dbConn, id, "/"), http.StatusSeeOther)
+	return true
+}
+
+// sessionTTL is how long a login lasts.
+const sessionTTL = 30 * 24 * time.Hour
+
+// startSession logs the user in: it creates a session, with its own CSRF
+// token for forms and a note of the browser and address it is used from,
+// and sets the session cookie.
+func startSession(w http.ResponseWriter, r *http.Request, dbConn *sql.DB, userID int) error {
+	sID, err := db.CreateSession(dbConn, userID, middleware.NewCSRFToken(), r.UserAgent(), middleware.ClientIP(r), sessionTTL)
+	if err != nil {
+		return err
+	}
+
+	// Set a secure session cookie in user's browser
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    sID,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// landingPage returns where the user goes after logging in: def, unless
+// their account is about to be deleted, when they are shown how to keep it.
+func landingPage(dbConn *sql.DB, userID int, def string) string {
+	if _, _, err := db.AccountDeletion(dbConn, userID); err == nil {
+		return "/settings/data"
+	}
+	return def
+}
+
+// loginError shows the login page with msg, and the provider buttons.
+func loginError(w http.ResponseWriter, r *http.Request, providers []*oidc.Provider, msg string) {
+	views.Render(w, r, "login.html", map[string]any{"LoginError": msg, "Providers": providers})
+}
 
-		// Set a secure session cookie in user's browser
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_id",
-			Value:    sID,
-			Path:     "/",
-			HttpOnly: true,
-			SameSite: http.SameSiteLaxMode,
-		})
-
-		// Redirect user to the homepage after login
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+// loginFailed records a failed login and shows the form again, with a
+// notice if the failure has brought on a wait or lockout.
+func loginFailed(w http.ResponseWriter, r *http.Request, throttle LoginThrottle, providers []*oidc.Provider, email string) {
+	throttle.fail(r, email)
+	msg := "Invalid credentials"
+	if retryAt, locked, err := throttle.retryAt(r, email); err != nil {
+		log.Printf("Login throttle lookup failed for %s: %v", email, err)
+	} else if time.Now().Before(retryAt) {
+		msg += ". " + retryMessage(retryAt, locked)
 	}
+	loginError(w, r, providers, msg)
 }
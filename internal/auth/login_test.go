@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/oidc"
+)
+
+// Every way the login page comes back with an error keeps the buttons to
+// log in with a provider.
+func TestLoginErrorsKeepProviders(t *testing.T) {
+	dbConn := newTestDB(t)
+	providers := []*oidc.Provider{oidc.New(oidc.Config{Name: "mock", Label: "Mock"}, nil)}
+	throttle := NewLoginThrottle(dbConn, 3, time.Hour)
+	login := NewLoginHandler(dbConn, throttle, testHasher, providers)
+	twoFactor := NewTwoFactorLoginHandler(dbConn, NewLoginThrottle(dbConn, 0, 0), providers)
+
+	hash, err := testHasher.Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	annID, _ := loggedIn(t, dbConn, "ann", hash)
+	banned, _ := loggedIn(t, dbConn, "banned", hash)
+	adminID, _ := loggedIn(t, dbConn, "admin", hash)
+	if _, err := dbConn.Exec(`UPDATE users SET role = 'admin' WHERE id = ?`, adminID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SanctionUser(dbConn, banned, adminID, db.SanctionBan, "spam", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.StartTOTPEnrolment(dbConn, annID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ConfirmTOTP(dbConn, annID, 100, []string{"aaaa-bbbb"}); err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := db.CreateLoginChallenge(dbConn, annID, loginChallengeTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(h http.Handler, target string, form url.Values, cookies ...*http.Cookie) (int, string) {
+		w := serve(dbConn, h, target, form, cookies...)
+		return w.Code, w.Body.String()
+	}
+	tests := []struct {
+		name   string
+		do     func() (int, string)
+		status int
+		want   string
+	}{
+		{"wrong password", func() (int, string) {
+			return post(login, "/login", url.Values{"email": {"ann@example.com"}, "password": {"wrong"}})
+		}, http.StatusOK, "Invalid credentials"},
+		{"banned", func() (int, string) {
+			return post(login, "/login", url.Values{"email": {"banned@example.com"}, "password": {"correct horse battery"}})
+		}, http.StatusOK, "This account has been banned"},
+		{"throttled", func() (int, string) {
+			for i := 0; i < 2; i++ {
+				post(login, "/login", url.Values{"email": {"ann@example.com"}, "password": {"wrong"}})
+			}
+			return post(login, "/login", url.Values{"email": {"ann@example.com"}, "password": {"wrong"}})
+		}, http.StatusTooManyRequests, "Too many failed login attempts"},
+		{"expired second step", func() (int, string) {
+			return post(twoFactor, "/login/2fa", nil, &http.Cookie{Name: challengeCookie, Value: "gone"})
+		}, http.StatusOK, "Your login has expired"},
+		{"too many wrong codes", func() (int, string) {
+			var (
+				status int
+				body   string
+			)
+			for i := 0; i < maxChallengeAttempts; i++ {
+				status, body = post(twoFactor, "/login/2fa", url.Values{"code": {"000000"}}, &http.Cookie{Name: challengeCookie, Value: challenge})
+			}
+			return status, body
+		}, http.StatusBadRequest, "Too many wrong codes"},
+	}
+	for _, tt := range tests {
+		status, body := tt.do()
+		if status != tt.status || !strings.Contains(body, tt.want) {
+			t.Errorf("%s: status %d, want %d with %q in\n%s", tt.name, status, tt.status, tt.want, body)
+		}
+		if !strings.Contains(body, `href="/login/oidc/mock"`) {
+			t.Errorf("%s: the page has no button to log in with Mock", tt.name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/mail"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/oidc"
+)
+
+const (
+	// oidcLoginTTL is how long a member has to get through the provider.
+	oidcLoginTTL = 10 * time.Minute
+	// oidcStateCookie ties the provider's answer to the browser that went
+	// there.
+	oidcStateCookie = "oidc_state"
+)
+
+// findProvider returns the provider called name, or nil.
+func findProvider(providers []*oidc.Provider, name string) *oidc.Provider {
+	for _, p := range providers {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// beginOIDC sends the browser to the provider, to log in or, for
+// linkUserID, connect the provider to their account.
+func beginOIDC(w http.ResponseWriter, r *http.Request, dbConn *sql.DB, p *oidc.Provider, linkUserID int) error {
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return err
+	}
+	state, err := db.CreateOIDCLogin(dbConn, p.Name, nonce, verifier, linkUserID, oidcLoginTTL)
+	if err != nil {
+		return err
+	}
+	authURL, err := p.AuthURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		return err
+	}
+	setOIDCStateCookie(w, state, int(oidcLoginTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+	return nil
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/login/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode, // sent along when the provider redirects back
+	})
+}
+
+// oidcFailed shows the login page with msg and the provider buttons.
+func oidcFailed(w http.ResponseWriter, r *http.Request, providers []*oidc.Provider, status int, msg string) {
+	w.WriteHeader(status)
+	loginError(w, r, providers, msg)
+}
+
+// NewOIDCLoginHandler returns the handler for /login/oidc/{provider}, which
+// the "Log in with ..." buttons lead to: it sends the browser to the
+// provider (see NewOIDCCallbackHandler for the way back).
+func NewOIDCLoginHandler(dbConn *sql.DB, providers []*oidc.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := findProvider(providers, r.PathValue("provider"))
+		if p == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if _, _, loggedIn := middleware.CurrentUser(r); loggedIn {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		if err := beginOIDC(w, r, dbConn, p, 0); err != nil {
+			log.Printf("Could not start a login with %s: %v", p.Name, err)
+			oidcFailed(w, r, providers, http.StatusBadGateway, "Logging in with "+p.Label+" is not available right now. Please try again later.")
+		}
+	}
+}
+
+// NewOIDCCallbackHandler returns the handler for
+// /login/oidc/{provider}/callback, where the provider sends the browser
+// back. The state must match the browser's cookie and the ID token the
+// code is exchanged for must verify (see oidc.Provider.Exchange). Then:
+//   - connecting a provider: the account there is linked to the member, who
+//     goes back to /settings/identities;
+//   - an account there that is linked already: its member is logged in
+//     (two-factor authentication and bans apply as with a password);
+//   - a new account there: a member is signed up with its email address and
+//     name, unless the address is someone's already (they should log in and
+//     connect the provider instead). Addresses the provider has not
+//     confirmed are mailed a confirmation link (on baseURL).
+func NewOIDCCallbackHandler(dbConn *sql.DB, providers []*oidc.Provider, mailer mail.Mailer, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := findProvider(providers, r.PathValue("provider"))
+		if p == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// 1. Match the answer to the login this browser started, using it up
+		state := r.URL.Query().Get("state")
+		cookie, err := r.Cookie(oidcStateCookie)
+		setOIDCStateCookie(w, "", -1)
+		if err != nil || state == "" || cookie.Value != state {
+			oidcFailed(w, r, providers, http.StatusBadRequest, "This login was not started in this browser, or has expired. Please try again.")
+			return
+		}
+		provider, nonce, verifier, linkUserID, err := db.TakeOIDCLogin(dbConn, state)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && provider != p.Name) {
+			oidcFailed(w, r, providers, http.StatusBadRequest, "This login has expired or was already used. Please try again.")
+			return
+		}
+		if err != nil {
+			log.Println("DB error:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", false, "")
+			return
+		}
+
+		// 2. Get the member's identity from the provider
+		if e := r.URL.Query().Get("error"); e != "" {
+			log.Printf("Login with %s failed at the provider: %s %s", p.Name, e, r.URL.Query().Get("error_description"))
+			msg := p.Label + " could not log you in. Please try again."
+			if e == "access_denied" {
+				msg = "Logging in with " + p.Label + " was cancelled."
+			}
+			oidcFailed(w, r, providers, http.StatusBadRequest, msg)
+			return
+		}
+		claims, err := p.Exchange(r.Context(), r.URL.Query().Get("code"), verifier, nonce)
+		if err != nil {
+			log.Printf("Login with %s failed: %v", p.Name, err)
+			oidcFailed(w, r, providers, http.StatusBadGateway, p.Label+" could not log you in. Please try again.")
+			return
+		}
+		who := claims.Subject + " at " + p.Name
+
+		// 3. Connect the provider to the member who asked to
+		if linkUserID != 0 {
+			userID, username, loggedIn := middleware.CurrentUser(r)
+			if !loggedIn || userID != linkUserID {
+				middleware.ErrorHandler(w, http.StatusForbidden, "Please log in as the member who asked to connect "+p.Label+".", loggedIn, username)
+				return
+			}
+			err := db.LinkIdentity(dbConn, userID, p.Name, claims.Subject, claims.Email)
+			switch {
+			case errors.Is(err, db.ErrIdentityTaken):
+				http.Redirect(w, r, "/settings/identities?error=taken&provider="+p.Name, http.StatusSeeOther)
+			case errors.Is(err, db.ErrProviderLinked):
+				http.Redirect(w, r, "/settings/identities?error=linked&provider="+p.Name, http.StatusSeeOther)
+			case err != nil:
+				log.Println("Could not link identity:", err)
+				middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not connect "+p.Label+".", true, username)
+			default:
+				log.Printf("User %s connected %s", username, who)
+				http.Redirect(w, r, "/settings/identities?linked="+p.Name, http.StatusSeeOther)
+			}
+			return
+		}
+
+		// 4. Log in the member the identity belongs to
+		userID, err := db.IdentityLogin(dbConn, p.Name, claims.Subject, claims.Email)
+		if err == nil {
+			finishLogin(w, r, dbConn, providers, userID, who)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("DB error:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", false, "")
+			return
+		}
+
+		// 5. Or sign up a new member
+		if !strings.Contains(claims.Email, "@") {
+			oidcFailed(w, r, providers, http.StatusBadRequest,
+				p.Label+" did not share your email address with us, which an account needs. Please sign up with a password instead.")
+			return
+		}
+		var taken bool
+		if err := dbConn.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)`, claims.Email).Scan(&taken); err != nil {
+			log.Println("DB error:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", false, "")
+			return
+		}
+		if taken {
+			oidcFailed(w, r, providers, http.StatusConflict,
+				"There is already an account with the address "+claims.Email+". Log in with your password, then connect "+
+					p.Label+" under Settings, Sign-in providers.")
+			return
+		}
+		userID, username, err := db.CreateIdentityUser(dbConn, p.Name, claims.Subject, identityUsername(claims), claims.Email, claims.EmailVerified)
+		if err != nil {
+			log.Println("Could not sign up identity:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not create your account.", false, "")
+			return
+		}
+		log.Printf("✅ User %s registered with %s", username, who)
+		if !claims.EmailVerified {
+			if err := sendVerification(dbConn, mailer, baseURL, userID, username, claims.Email); err != nil {
+				log.Printf("Could not send confirmation mail to %s: %v", claims.Email, err)
+			}
+		}
+		finishLogin(w, r, dbConn, providers, userID, who)
+	}
+}
+
+// notUsername matches what may not appear in a username.
+var notUsername = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// identityUsername picks a username for a member signing up through a
+// provider: their name there, their full name or the start of their email
+// address, made to fit validUsername. CreateIdentityUser numbers it if it
+// is taken.
+func identityUsername(c *oidc.Claims) string {
+	local, _, _ := strings.Cut(c.Email, "@")
+	for _, name := range []string{c.PreferredUsername, c.Name, local} {
+		name = notUsername.ReplaceAllString(strings.ReplaceAll(strings.TrimSpace(name), " ", "."), "")
+		if len(name) > 30 {
+			name = name[:30]
+		}
+		if validUsername.MatchString(name) {
+			return name
+		}
+	}
+	return "member"
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/mail"
+	"literary-lions/internal/oidc"
+	"literary-lions/internal/oidc/oidctest"
+)
+
+// oidcTest is the forum's login routes with a mock provider behind them.
+type oidcTest struct {
+	t      *testing.T
+	dbConn *sql.DB
+	mock   *oidctest.Provider
+	mux    *http.ServeMux
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	mock, err := oidctest.NewProvider("client", "secret", oidctest.User{
+		Subject: "sub-1", Email: "new@example.com", EmailVerified: true, PreferredUsername: "newcomer",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	providers := []*oidc.Provider{oidc.New(oidc.Config{
+		Name:         "mock",
+		Label:        "Mock",
+		Issuer:       mock.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://forum.test/login/oidc/mock/callback",
+	}, mock.Server.Client())}
+
+	dbConn := newTestDB(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login/oidc/{provider}", NewOIDCLoginHandler(dbConn, providers))
+	mux.HandleFunc("GET /login/oidc/{provider}/callback", NewOIDCCallbackHandler(dbConn, providers, mail.LogMailer{Dir: t.TempDir()}, "http://forum.test"))
+	mux.HandleFunc("/settings/identities", NewIdentitiesHandler(dbConn, providers, testHasher))
+	return &oidcTest{t: t, dbConn: dbConn, mock: mock, mux: mux}
+}
+
+// start begins a login (or, with a session, connecting the provider via
+// form) and follows the browser through the provider. It returns the
+// callback URL the provider sends it back to, and the state cookie.
+func (o *oidcTest) start(session string, form url.Values) (string, *http.Cookie) {
+	o.t.Helper()
+	var w *httptest.ResponseRecorder
+	if session == "" {
+		w = serve(o.dbConn, o.mux, "/login/oidc/mock", nil)
+	} else {
+		w = serve(o.dbConn, o.mux, "/settings/identities", form, sessionCookie(session))
+	}
+	if w.Code != http.StatusSeeOther {
+		o.t.Fatalf("starting: status %d\n%s", w.Code, w.Body)
+	}
+	var state *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			state = c
+		}
+	}
+	if state == nil {
+		o.t.Fatal("no state cookie")
+	}
+
+	client := o.mock.Server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || back.Path != "/login/oidc/mock/callback" {
+		o.t.Fatalf("the provider sent the browser to %q", resp.Header.Get("Location"))
+	}
+	return back.RequestURI(), state
+}
+
+// callback comes back from the provider.
+func (o *oidcTest) callback(target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	return serve(o.dbConn, o.mux, target, nil, cookies...)
+}
+
+// startedSession reports whether w logged someone in.
+func startedSession(w *httptest.ResponseRecorder) bool {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session_id" && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOIDCSignupAndLogin(t *testing.T) {
+	o := newOIDCTest(t)
+
+	// A new account at the provider signs up
+	target, state := o.start("", nil)
+	w := o.callback(target, state)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" || !startedSession(w) {
+		t.Fatalf("signup: status %d, location %q\n%s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	var (
+		userID         int
+		username, hash string
+		verified       bool
+	)
+	err := o.dbConn.QueryRow(`SELECT id, username, password, email_verified_at IS NOT NULL FROM users WHERE email = 'new@example.com'`).
+		Scan(&userID, &username, &hash, &verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "newcomer" || hash != db.NoPassword || !verified {
+		t.Errorf("signed up %q with password %q, verified %v", username, hash, verified)
+	}
+
+	// Coming back with the same answer is refused
+	if w := o.callback(target, state); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "already used") || startedSession(w) {
+		t.Errorf("replay: status %d\n%s", w.Code, w.Body)
+	}
+
+	// The next time, the same member logs in
+	target, state = o.start("", nil)
+	if w := o.callback(target, state); w.Code != http.StatusSeeOther || !startedSession(w) {
+		t.Fatalf("login: status %d\n%s", w.Code, w.Body)
+	}
+	var users int
+	o.dbConn.QueryRow(`SELECT COUNT(*) FROM users WHERE email = 'new@example.com'`).Scan(&users)
+	if users != 1 {
+		t.Errorf("%d accounts for the address", users)
+	}
+
+	// An address that is a member's already is not signed up again
+	o.mock.SetUser(oidctest.User{Subject: "sub-2", Email: "new@example.com", EmailVerified: true})
+	target, state = o.start("", nil)
+	if w := o.callback(target, state); w.Code != http.StatusConflict || startedSession(w) {
+		t.Errorf("taken address: status %d\n%s", w.Code, w.Body)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	o := newOIDCTest(t)
+	target, state := o.start("", nil)
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+	}{
+		{"no cookie", nil},
+		{"another login's cookie", []*http.Cookie{{Name: oidcStateCookie, Value: "other"}}},
+	}
+	for _, tt := range tests {
+		w := o.callback(target, tt.cookies...)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "not started in this browser") || startedSession(w) {
+			t.Errorf("%s: status %d\n%s", tt.name, w.Code, w.Body)
+		}
+	}
+	if w := o.callback(strings.Replace(target, "state=", "state=x", 1), state); w.Code != http.StatusBadRequest || startedSession(w) {
+		t.Errorf("another state: status %d", w.Code)
+	}
+	// The login is still there for the browser that started it
+	if w := o.callback(target, state); w.Code != http.StatusSeeOther || !startedSession(w) {
+		t.Errorf("the right cookie: status %d\n%s", w.Code, w.Body)
+	}
+}
+
+func TestOIDCCallbackBadToken(t *testing.T) {
+	o := newOIDCTest(t)
+	o.mock.Tamper(func(c map[string]any) { c["aud"] = "another client" })
+	target, state := o.start("", nil)
+	w := o.callback(target, state)
+	if w.Code != http.StatusBadGateway || startedSession(w) {
+		t.Errorf("status %d\n%s", w.Code, w.Body)
+	}
+	var users int
+	o.dbConn.QueryRow(`SELECT COUNT(*) FROM users WHERE email = 'new@example.com'`).Scan(&users)
+	if users != 0 {
+		t.Error("signed up from a token for another client")
+	}
+}
+
+func TestOIDCLink(t *testing.T) {
+	o := newOIDCTest(t)
+	hash, err := testHasher.Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	annID, annSession := loggedIn(t, o.dbConn, "ann", hash)
+	_, bobSession := loggedIn(t, o.dbConn, "bob", hash)
+	link := url.Values{"action": {"link"}, "provider": {"mock"}, "current_password": {"correct horse battery"}}
+
+	// Connecting needs the password
+	w := serve(o.dbConn, o.mux, "/settings/identities", url.Values{"action": {"link"}, "provider": {"mock"}}, sessionCookie(annSession))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("without the password: status %d", w.Code)
+	}
+
+	// Only the member who asked may finish connecting
+	target, state := o.start(annSession, link)
+	if w := o.callback(target, state, sessionCookie(bobSession)); w.Code != http.StatusForbidden {
+		t.Errorf("finished by another member: status %d", w.Code)
+	}
+
+	target, state = o.start(annSession, link)
+	w = o.callback(target, state, sessionCookie(annSession))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/settings/identities?linked=mock" {
+		t.Fatalf("linking: status %d, location %q\n%s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	var linked int
+	if err := o.dbConn.QueryRow(`SELECT user_id FROM user_identities WHERE provider = 'mock' AND subject = 'sub-1'`).Scan(&linked); err != nil || linked != annID {
+		t.Fatalf("identity linked to %d, %v; want %d", linked, err, annID)
+	}
+
+	// Logging in with it is logging in as ann, not signing up
+	target, state = o.start("", nil)
+	if w := o.callback(target, state); w.Code != http.StatusSeeOther || !startedSession(w) {
+		t.Fatalf("login: status %d\n%s", w.Code, w.Body)
+	}
+	var users int
+	o.dbConn.QueryRow(`SELECT COUNT(*) FROM users WHERE email = 'new@example.com'`).Scan(&users)
+	if users != 0 {
+		t.Error("signed up a new member for a linked identity")
+	}
+
+	// Nobody else can connect the same account
+	target, state = o.start(bobSession, link)
+	w = o.callback(target, state, sessionCookie(bobSession))
+	if w.Header().Get("Location") != "/settings/identities?error=taken&provider=mock" {
+		t.Errorf("taken: status %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+}
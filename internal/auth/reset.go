@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/mail"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/password"
+	"literary-lions/internal/views"
+)
+
+// passwordResetTTL is how long a password reset link works.
+const passwordResetTTL = time.Hour
+
+// ForgotPageData holds the "forgot your password" form.
+type ForgotPageData struct {
+	models.BasePageData
+	Email string
+	Error string
+	Sent  bool
+}
+
+// ResetPageData holds the form for choosing a new password.
+type ResetPageData struct {
+	models.BasePageData
+	Token        string
+	Account      string
+	PasswordHint string // what a new password needs
+	Error        string
+	Suggestions  []string // how to pick a stronger password
+}
+
+// NewForgotPasswordHandler returns a handler for /forgot: it asks for an
+// email address and mails a password reset link (on baseURL) to the account
+// using it. The answer is the same whether or not there is such an account,
+// so the form can't be used to find out who is a member.
+func NewForgotPasswordHandler(dbConn *sql.DB, mailer mail.Mailer, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 1. Show the form on GET
+		if r.Method == http.MethodGet {
+			views.Render(w, r, "forgot.html", ForgotPageData{})
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// 2. Look up the account
+		email := strings.TrimSpace(r.FormValue("email"))
+		if email == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			views.Render(w, r, "forgot.html", ForgotPageData{Error: "Please enter your email address."})
+			return
+		}
+		var (
+			userID   int
+			username string
+			address  string // as stored, which may differ in case
+		)
+		err := dbConn.QueryRow(`SELECT id, username, email FROM users WHERE email = ?`, email).
+			Scan(&userID, &username, &address)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			log.Printf("Password reset asked for unknown email %s", email)
+			views.Render(w, r, "forgot.html", ForgotPageData{Email: email, Sent: true})
+			return
+		case err != nil:
+			log.Println("DB error:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", false, "")
+			return
+		}
+
+		// 3. Issue a token and mail the link (not again if one just went out)
+		token, err := db.CreatePasswordReset(dbConn, userID, passwordResetTTL)
+		if errors.Is(err, db.ErrTooSoon) {
+			views.Render(w, r, "forgot.html", ForgotPageData{Email: email, Sent: true})
+			return
+		}
+		if err != nil {
+			log.Println("Could not create password reset:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Server error", false, "")
+			return
+		}
+		err = mailer.Send(mail.Message{
+			To:      address,
+			Subject: "Reset your Literary Lions password",
+			Body: "Hello " + username + ",\n\n" +
+				"Someone (hopefully you) asked to reset your password. To choose a new one, open:\n\n" +
+				baseURL + "/reset/" + token + "\n\n" +
+				"The link works once, for one hour. If you didn't ask for it, you can ignore this email;\n" +
+				"your password stays as it is.\n",
+		})
+		// A failure is only logged: an error page here would tell whoever
+		// asked that the address is a member's
+		if err != nil {
+			log.Printf("Could not send password reset mail to %s: %v", email, err)
+		} else {
+			log.Printf("Password reset link sent to %s", username)
+		}
+		views.Render(w, r, "forgot.html", ForgotPageData{Email: email, Sent: true})
+	}
+}
+
+// NewResetPasswordHandler returns a handler for /reset/{token}, where the
+// link from the reset mail leads: it sets a new password, which uses up the
+// token and logs the user out everywhere. The password has to meet policy,
+// and is stored hashed by hasher.
+func NewResetPasswordHandler(dbConn *sql.DB, policy password.Policy, hasher password.Hasher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 1. Check the token
+		token := r.PathValue("token")
+		username, err := db.PasswordResetUser(dbConn, token)
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.ErrorHandler(w, http.StatusBadRequest,
+				"This password reset link is invalid, has expired or was already used. You can ask for a new one on the login page.",
+				false, "")
+			return
+		}
+		if err != nil {
+			log.Println("DB error:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", false, "")
+			return
+		}
+		data := ResetPageData{Token: token, Account: username, PasswordHint: policy.Hint()}
+
+		// 2. Show the form on GET
+		if r.Method == http.MethodGet {
+			views.Render(w, r, "reset.html", data)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// 3. Check the new password
+		password := r.FormValue("password")
+		switch {
+		case password == "":
+			data.Error = "Please enter a new password."
+		case password != r.FormValue("confirm"):
+			data.Error = "The two passwords don't match."
+		default:
+			data.Error, data.Suggestions = passwordProblem(policy, password, username)
+		}
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			views.Render(w, r, "reset.html", data)
+			return
+		}
+
+		// 4. Store it, ending every session of the user
+		hash, err := hasher.Hash(password)
+		if err != nil {
+			log.Println("Hash error:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Server error", false, "")
+			return
+		}
+		if err := db.ResetPassword(dbConn, token, hash); err != nil {
+			log.Println("Password reset failed:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Server error", false, "")
+			return
+		}
+		log.Printf("Password of %s was reset", username)
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "", Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "/login?reset=1", http.StatusSeeOther)
+	}
+}
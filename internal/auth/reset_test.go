@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"literary-lions/internal/mail"
+)
+
+// failingMailer fails to send anything.
+type failingMailer struct{}
+
+func (failingMailer) Send(mail.Message) error { return errors.New("SMTP server unreachable") }
+
+// The forgot password form answers the same for members and strangers,
+// whatever the case of the address and even when the mail cannot go out.
+func TestForgotPasswordSameAnswer(t *testing.T) {
+	dbConn := newTestDB(t)
+	hash, err := testHasher.Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggedIn(t, dbConn, "ann", hash)
+	loggedIn(t, dbConn, "bob", hash)
+	loggedIn(t, dbConn, "cy", hash)
+	dir := t.TempDir()
+	working := NewForgotPasswordHandler(dbConn, mail.LogMailer{Dir: dir}, "http://forum.test")
+	failing := NewForgotPasswordHandler(dbConn, failingMailer{}, "http://forum.test")
+
+	tests := []struct {
+		name  string
+		h     http.Handler
+		email string
+	}{
+		{"member", working, "ann@example.com"},
+		{"member, other case", working, "Bob@Example.COM"},
+		{"stranger", working, "nobody@example.com"},
+		{"member, mail failing", failing, "cy@example.com"},
+		{"stranger, mail failing", failing, "nobody@example.com"},
+	}
+	var first string
+	for _, tt := range tests {
+		w := serve(dbConn, tt.h, "/forgot", url.Values{"email": {tt.email}})
+		body := strings.ReplaceAll(w.Body.String(), tt.email, "EMAIL")
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d", tt.name, w.Code)
+		}
+		if first == "" {
+			first = body
+		} else if body != first {
+			t.Errorf("%s: the page differs from a member's:\n%s", tt.name, body)
+		}
+	}
+
+	var resets int
+	dbConn.QueryRow(`SELECT COUNT(*) FROM password_resets`).Scan(&resets)
+	if resets != 3 {
+		t.Errorf("%d reset links issued, want 3", resets)
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/views"
+)
+
+// SessionsPageData holds the sessions page.
+type SessionsPageData struct {
+	models.BasePageData
+	Sessions []models.Session
+	Error    string
+	Notice   string
+}
+
+// NewSessionsHandler returns the handler for /settings/sessions, where
+// users see where they are logged in and log out of sessions they don't
+// recognise.
+//   - GET: List the unexpired sessions, most recently used first.
+//   - POST action=revoke: End the session with the given handle; ending the
+//     current one logs the user out.
+//   - POST action=revoke_all: Log out everywhere, this browser included.
+func NewSessionsHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		current := middleware.CurrentSessionID(r)
+		data := SessionsPageData{BasePageData: models.BasePageData{Username: username, LoggedIn: true}}
+
+		// 1. Apply the requested change; without the current session, log out
+		if r.Method == http.MethodPost {
+			switch r.FormValue("action") {
+			case "revoke":
+				id, err := db.EndSession(dbConn, userID, r.FormValue("session"))
+				switch {
+				case errors.Is(err, sql.ErrNoRows):
+					data.Error = "That session has already ended."
+				case err != nil:
+					log.Println("DB problem:", err)
+					data.Error = "Could not end the session."
+				case id == current:
+					log.Printf("User %s logged out", username)
+					clearSessionCookie(w)
+					http.Redirect(w, r, "/login", http.StatusSeeOther)
+					return
+				default:
+					log.Printf("User %s ended one of their sessions", username)
+					data.Notice = "The session has been logged out."
+				}
+			case "revoke_all":
+				if err := db.EndSessions(dbConn, userID); err != nil {
+					log.Println("DB problem:", err)
+					data.Error = "Could not end the sessions."
+					break
+				}
+				log.Printf("User %s logged out everywhere", username)
+				clearSessionCookie(w)
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			default:
+				data.Error = "Unknown action."
+			}
+		}
+
+		// 2. Load the sessions
+		sessions, err := db.UserSessions(dbConn, userID, current)
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+		for i := range sessions {
+			sessions[i].Device = describeUserAgent(sessions[i].UserAgent)
+		}
+		data.Sessions = sessions
+
+		// 3. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "settings_sessions.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// clearSessionCookie removes the session cookie from the browser.
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// describeUserAgent turns a User-Agent header into something like
+// "Firefox on Windows", good enough to recognise one's own devices.
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown browser"
+	}
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"},
+		{"Safari/", "Safari"}, {"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iPhone"}, {"iPad", "iPad"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			return browser + " on " + o.name
+		}
+	}
+	return browser
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"regexp"
+	"strings"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/mail"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/password"
+	"literary-lions/internal/views"
+)
+
+// validUsername is what a new username may look like: it appears in
+// /u/{username} links.
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,30}$`)
+
+// AccountPageData holds the account settings page.
+type AccountPageData struct {
+	models.BasePageData
+	Email        string
+	PendingEmail string // a new address waiting for confirmation
+	PasswordHint string // what a new password needs
+	HasPassword  bool   // false for members who signed up through a provider
+	Error        string
+	Suggestions  []string // how to pick a stronger password
+	Notice       string
+}
+
+// NewAccountSettingsHandler returns the handler for /settings, where users
+// change their account details. Each change asks for the current password,
+// if the member has one.
+//   - GET: Show the forms.
+//   - POST action=password: Change the password (or, for members who signed
+//     up through a provider, set their first), if it meets policy, and log
+//     out every other session.
+//   - POST action=email: Mail a confirmation link (on baseURL) to the new
+//     address, which replaces the old one once followed; the old address is
+//     told about it.
+//   - POST action=username: Rename the account; links to the old profile
+//     keep working.
+func NewAccountSettingsHandler(dbConn *sql.DB, mailer mail.Mailer, baseURL string, policy password.Policy, hasher password.Hasher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		data := AccountPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: true},
+			PasswordHint: policy.Hint(),
+		}
+
+		// 1. Apply the requested change, once the password checks out
+		if r.Method == http.MethodPost {
+			var (
+				email, hash string
+				err         error
+			)
+			err = dbConn.QueryRow(`SELECT email, password FROM users WHERE id = ?`, userID).Scan(&email, &hash)
+			if err == nil {
+				data.HasPassword = hash != db.NoPassword
+				if data.HasPassword && !hasher.Verify(hash, r.FormValue("current_password")) {
+					data.Error = "Your current password is not right."
+				} else {
+					err = applyAccountChange(dbConn, mailer, baseURL, policy, hasher, r, userID, username, email, &data)
+				}
+			}
+			if err != nil {
+				log.Println("Account change failed:", err)
+				middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not change your account.", true, username)
+				return
+			}
+			// A new name shows on the page at once
+			if data.Error == "" && r.FormValue("action") == "username" {
+				data.Username = strings.TrimSpace(r.FormValue("username"))
+			}
+		}
+
+		// 2. Load the current address and any change waiting for confirmation
+		var hash string
+		err := dbConn.QueryRow(`SELECT email, password FROM users WHERE id = ?`, userID).Scan(&data.Email, &hash)
+		if err == nil {
+			data.HasPassword = hash != db.NoPassword
+			data.PendingEmail, err = db.PendingEmailChange(dbConn, userID)
+		}
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+
+		// 3. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "settings_account.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// applyAccountChange carries out a POST to /settings for the user, whose
+// password (if any) has been checked. Problems with the form become data's error
+// message (with suggestions for a weak password), success its notice.
+func applyAccountChange(dbConn *sql.DB, mailer mail.Mailer, baseURL string, policy password.Policy, hasher password.Hasher, r *http.Request, userID int, username, email string, data *AccountPageData) error {
+	switch r.FormValue("action") {
+	case "password":
+		newPassword := r.FormValue("new_password")
+		if newPassword == "" {
+			data.Error = "Enter a new password."
+			return nil
+		}
+		if newPassword != r.FormValue("confirm_password") {
+			data.Error = "The new passwords don't match."
+			return nil
+		}
+		if msg, suggestions := passwordProblem(policy, newPassword, username, email); msg != "" {
+			data.Error, data.Suggestions = msg, suggestions
+			return nil
+		}
+		hash, err := hasher.Hash(newPassword)
+		if err != nil {
+			return err
+		}
+		if err := db.ChangePassword(dbConn, userID, hash, middleware.CurrentSessionID(r)); err != nil {
+			return err
+		}
+		if !data.HasPassword {
+			log.Printf("User %s set a password", username)
+			data.Notice = "Your password is set: you can now log in with it too. Your other sessions have been logged out."
+			return nil
+		}
+		log.Printf("User %s changed their password", username)
+		data.Notice = "Your password has been changed, and your other sessions logged out."
+		return nil
+
+	case "email":
+		newEmail := strings.TrimSpace(r.FormValue("email"))
+		if addr, err := netmail.ParseAddress(newEmail); err != nil || addr.Address != newEmail ||
+			!strings.Contains(newEmail[strings.LastIndex(newEmail, "@"):], ".") {
+			data.Error = "Invalid email address"
+			return nil
+		}
+		if newEmail == email {
+			data.Error = "That is already your email address."
+			return nil
+		}
+		token, err := db.CreateEmailChange(dbConn, userID, newEmail, verificationTTL)
+		switch {
+		case errors.Is(err, db.ErrEmailTaken):
+			data.Error = "That email address is already in use."
+			return nil
+		case errors.Is(err, db.ErrTooSoon):
+			data.Error = "We sent you a link moments ago. Please wait a minute before asking for another."
+			return nil
+		case err != nil:
+			return err
+		}
+		err = mailer.Send(mail.Message{
+			To:      newEmail,
+			Subject: "Confirm your new email address for Literary Lions",
+			Body: "Hello " + username + ",\n\n" +
+				"To use this address for your account from now on, please open:\n\n" +
+				baseURL + "/verify/" + token + "\n\n" +
+				"Until then your account keeps its old address. The link works for two days.\n" +
+				"If you didn't ask for this, you can ignore this email.\n",
+		})
+		if err != nil {
+			return err
+		}
+		// The old address hears about it, in case someone else is at the controls
+		err = mailer.Send(mail.Message{
+			To:      email,
+			Subject: "Your Literary Lions email address is being changed",
+			Body: "Hello " + username + ",\n\n" +
+				"Someone logged in to your account asked to change its email address to " + newEmail + ".\n" +
+				"It changes once they follow the link we mailed there. If this wasn't you, change your password\n" +
+				"and log out your other sessions at " + baseURL + "/settings/sessions.\n",
+		})
+		if err != nil {
+			log.Printf("Could not tell %s about the address change: %v", email, err)
+		}
+		log.Printf("User %s asked to change their email address", username)
+		data.Notice = "We've mailed a link to " + newEmail + ". Your address changes once you follow it."
+		return nil
+
+	case "username":
+		newName := strings.TrimSpace(r.FormValue("username"))
+		if !validUsername.MatchString(newName) {
+			data.Error = "A username is 3 to 30 letters, digits, dots, dashes or underscores."
+			return nil
+		}
+		err := db.ChangeUsername(dbConn, userID, newName)
+		if errors.Is(err, db.ErrNameTaken) {
+			data.Error = "That username is already in use."
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("User %s is now called %s", username, newName)
+		data.Notice = "You are now called " + newName + ". Links to your old profile lead to the new one."
+		return nil
+	}
+	data.Error = "Unknown action."
+	return nil
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/mail"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/password"
+	"literary-lions/internal/views"
+)
+
+func TestMain(m *testing.M) {
+	// Templates are looked up from the repository root
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	views.InitTemplates()
+	os.Exit(m.Run())
+}
+
+// testHasher is quick, for tests.
+var testHasher = password.Bcrypt{Cost: 4}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbConn, err := db.OpenDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbConn.Close() })
+	if _, err := db.MigrateUp(dbConn); err != nil {
+		t.Fatal(err)
+	}
+	return dbConn
+}
+
+// loggedIn returns a member with the password hash and a session, and the
+// session's ID.
+func loggedIn(t *testing.T, dbConn *sql.DB, name, hash string) (int, string) {
+	t.Helper()
+	var id int
+	err := dbConn.QueryRow(`INSERT INTO users (email, username, password, email_verified_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP) RETURNING id`,
+		name+"@example.com", name, hash).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := db.CreateSession(dbConn, id, "csrf", "test", "192.0.2.1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, session
+}
+
+// serve sends a request to h behind the session middleware, with form as
+// the body of a POST (GET if nil), and the cookies.
+func serve(dbConn *sql.DB, h http.Handler, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if form != nil {
+		r = httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	middleware.NewWithSession(dbConn)(h).ServeHTTP(w, r)
+	return w
+}
+
+func sessionCookie(session string) *http.Cookie {
+	return &http.Cookie{Name: "session_id", Value: session}
+}
+
+// Members who signed up through a provider have no password to give: they
+// set their first one, and change their details, without.
+func TestAccountSettingsNoPassword(t *testing.T) {
+	dbConn := newTestDB(t)
+	h := NewAccountSettingsHandler(dbConn, mail.LogMailer{Dir: t.TempDir()}, "http://forum.test", password.Policy{MinLength: 8}, testHasher)
+	userID, session := loggedIn(t, dbConn, "oidcmember", db.NoPassword)
+
+	w := serve(dbConn, h, "/settings", nil, sessionCookie(session))
+	if body := w.Body.String(); w.Code != http.StatusOK || strings.Contains(body, `name="current_password"`) || !strings.Contains(body, "Set password") {
+		t.Fatalf("GET: status %d, asks for the current password or offers no new one:\n%s", w.Code, body)
+	}
+
+	w = serve(dbConn, h, "/settings", url.Values{"action": {"username"}, "username": {"renamed"}}, sessionCookie(session))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "You are now called renamed") {
+		t.Fatalf("renaming: status %d\n%s", w.Code, w.Body)
+	}
+
+	form := url.Values{"action": {"password"}, "new_password": {"correct horse battery"}, "confirm_password": {"correct horse battery"}}
+	w = serve(dbConn, h, "/settings", form, sessionCookie(session))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Your password is set") {
+		t.Fatalf("setting a password: status %d\n%s", w.Code, w.Body)
+	}
+	var hash string
+	if err := dbConn.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	if !testHasher.Verify(hash, "correct horse battery") {
+		t.Fatal("the new password does not verify")
+	}
+
+	// Now that there is one, it has to be given
+	w = serve(dbConn, h, "/settings", nil, sessionCookie(session))
+	if !strings.Contains(w.Body.String(), `name="current_password"`) {
+		t.Error("GET after setting a password does not ask for it")
+	}
+	form.Set("new_password", "another horse battery")
+	form.Set("confirm_password", "another horse battery")
+	w = serve(dbConn, h, "/settings", form, sessionCookie(session))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "current password is not right") {
+		t.Errorf("changing it without the current one: status %d", w.Code)
+	}
+}
+
+func TestDataNoPassword(t *testing.T) {
+	dbConn := newTestDB(t)
+	h := NewDataHandler(dbConn, 14*24*time.Hour, testHasher)
+	userID, session := loggedIn(t, dbConn, "oidcmember", db.NoPassword)
+
+	w := serve(dbConn, h, "/settings/data", nil, sessionCookie(session))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `name="password"`) {
+		t.Fatalf("GET: status %d, or asks for a password", w.Code)
+	}
+	w = serve(dbConn, h, "/settings/data", url.Values{"action": {"delete"}, "mode": {db.DeleteAnonymize}}, sessionCookie(session))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login?deleting=1" {
+		t.Fatalf("deleting: status %d, location %q\n%s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	if _, _, err := db.AccountDeletion(dbConn, userID); err != nil {
+		t.Errorf("no deletion scheduled: %v", err)
+	}
+
+	// Members with a password still give it
+	hash, err := testHasher.Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, session = loggedIn(t, dbConn, "member", hash)
+	w = serve(dbConn, h, "/settings/data", url.Values{"action": {"delete"}, "mode": {db.DeleteAnonymize}}, sessionCookie(session))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("deleting without the password: status %d", w.Code)
+	}
+}
+
+// Without a password, turning two-factor authentication off takes a code.
+func TestTwoFactorDisableNoPassword(t *testing.T) {
+	dbConn := newTestDB(t)
+	h := NewTwoFactorSettingsHandler(dbConn, testHasher)
+	userID, session := loggedIn(t, dbConn, "oidcmember", db.NoPassword)
+	if _, err := db.StartTOTPEnrolment(dbConn, userID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ConfirmTOTP(dbConn, userID, 100, []string{"aaaa-bbbb"}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(dbConn, h, "/settings/2fa", nil, sessionCookie(session))
+	if body := w.Body.String(); strings.Contains(body, `name="password"`) || !strings.Contains(body, `value="disable"`) {
+		t.Fatalf("GET asks for a password, or has no way to turn it off:\n%s", body)
+	}
+	w = serve(dbConn, h, "/settings/2fa", url.Values{"action": {"disable"}, "code": {"0000-0000"}}, sessionCookie(session))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("a wrong code: status %d", w.Code)
+	}
+	w = serve(dbConn, h, "/settings/2fa", url.Values{"action": {"disable"}, "code": {"aaaa-bbbb"}}, sessionCookie(session))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Two-factor authentication is off.") {
+		t.Fatalf("a recovery code: status %d\n%s", w.Code, w.Body)
+	}
+	if on, err := db.TwoFactorEnabled(dbConn, userID); err != nil || on {
+		t.Errorf("still on: %v, %v", on, err)
+	}
+}
@@ -2,32 +2,42 @@ package auth
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
+	netmail "net/mail"
 	"strings"
 
+	"literary-lions/internal/db"
+	"literary-lions/internal/mail"
 	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/password"
 	"literary-lions/internal/views"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
-// NewSignupHandler returns an HTTP handler for user registration/signup
-func NewSignupHandler(dbConn *sql.DB) http.HandlerFunc {
+// NewSignupHandler returns an HTTP handler for user registration/signup.
+// The password has to meet policy, and is stored hashed by hasher. New members are mailed a link (on
+// baseURL) to confirm their email address, and cannot post until they
+// follow it.
+func NewSignupHandler(dbConn *sql.DB, mailer mail.Mailer, baseURL string, policy password.Policy, hasher password.Hasher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Println("🟡 SignupHandler received request:", r.Method)
 
 		// Struct to hold form data and errors for template rendering
 		type FormData struct {
-			Error    string
-			Email    string
-			Username string
+			models.BasePageData
+			Error        string
+			Suggestions  []string // how to pick a stronger password
+			PasswordHint string
+			Email        string
+			Username     string
 		}
 
 		switch r.Method {
 		case http.MethodGet:
 			// Render signup form for GET requests (show empty form)
-			_ = views.Templates.ExecuteTemplate(w, "signup.html", nil)
+			_ = views.Render(w, r, "signup.html", FormData{PasswordHint: policy.Hint()})
 			return
 
 		case http.MethodPost:
@@ -40,21 +50,37 @@ func NewSignupHandler(dbConn *sql.DB) http.HandlerFunc {
 			if email == "" || username == "" || password == "" {
 				// 400 Bad Request for missing data
 				w.WriteHeader(http.StatusBadRequest)
-				_ = views.Templates.ExecuteTemplate(w, "signup.html", FormData{
-					Error:    "All fields are required",
-					Email:    email,
-					Username: username,
+				_ = views.Render(w, r, "signup.html", FormData{
+					Error:        "All fields are required",
+					PasswordHint: policy.Hint(),
+					Email:        email,
+					Username:     username,
+				})
+				return
+			}
+
+			// Validate email format: a bare address whose domain has a dot
+			if addr, err := netmail.ParseAddress(email); err != nil || addr.Address != email ||
+				!strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = views.Render(w, r, "signup.html", FormData{
+					Error:        "Invalid email address",
+					PasswordHint: policy.Hint(),
+					Email:        email,
+					Username:     username,
 				})
 				return
 			}
 
-			// Validate email format (very basic check)
-			if !strings.Contains(email, "@") || !strings.Contains(email, ".") {
+			// Check the password against the policy (length, strength, breaches)
+			if msg, suggestions := passwordProblem(policy, password, username, email); msg != "" {
 				w.WriteHeader(http.StatusBadRequest)
-				_ = views.Templates.ExecuteTemplate(w, "signup.html", FormData{
-					Error:    "Invalid email address",
-					Email:    email,
-					Username: username,
+				_ = views.Render(w, r, "signup.html", FormData{
+					Error:        msg,
+					Suggestions:  suggestions,
+					PasswordHint: policy.Hint(),
+					Email:        email,
+					Username:     username,
 				})
 				return
 			}
@@ -71,19 +97,20 @@ func NewSignupHandler(dbConn *sql.DB) http.HandlerFunc {
 				middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", false, "")
 				return
 			}
-			if exists > 0 {
-				// 400 Bad Request for duplicate email/username
+			if exists > 0 || db.ReservedUsername(username) {
+				// 400 Bad Request for duplicate email/username (or the deleted user placeholder's)
 				w.WriteHeader(http.StatusBadRequest)
-				_ = views.Templates.ExecuteTemplate(w, "signup.html", FormData{
-					Error:    "Email or username already in use",
-					Email:    email,
-					Username: username,
+				_ = views.Render(w, r, "signup.html", FormData{
+					Error:        "Email or username already in use",
+					PasswordHint: policy.Hint(),
+					Email:        email,
+					Username:     username,
 				})
 				return
 			}
 
-			// --- Hash password securely using bcrypt ---
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			// --- Hash password securely (bcrypt or argon2id, see password.Hasher) ---
+			hashedPassword, err := hasher.Hash(password)
 			if err != nil {
 				log.Println("Hash error:", err)
 				middleware.ErrorHandler(w, http.StatusInternalServerError, "Server error", false, "")
@@ -91,9 +118,9 @@ func NewSignupHandler(dbConn *sql.DB) http.HandlerFunc {
 			}
 
 			// --- Store the new user in the database ---
-			_, err = dbConn.Exec(
+			res, err := dbConn.Exec(
 				"INSERT INTO users (username, email, password) VALUES (?, ?, ?)",
-				username, email, string(hashedPassword),
+				username, email, hashedPassword,
 			)
 			if err != nil {
 				// 500 Internal Server Error if insert fails
@@ -102,9 +129,15 @@ func NewSignupHandler(dbConn *sql.DB) http.HandlerFunc {
 				return
 			}
 
+			// --- Mail the confirmation link (they can ask for another one later) ---
+			userID, _ := res.LastInsertId()
+			if err := sendVerification(dbConn, mailer, baseURL, int(userID), username, email); err != nil {
+				log.Printf("Could not send confirmation mail to %s: %v", email, err)
+			}
+
 			// Log success and redirect to login page
 			log.Printf("✅ User %s registered successfully\n", username)
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			http.Redirect(w, r, "/login?signup=1", http.StatusSeeOther)
 			return
 
 		default:
@@ -113,3 +146,15 @@ func NewSignupHandler(dbConn *sql.DB) http.HandlerFunc {
 		}
 	}
 }
+
+// passwordProblem checks a new password against policy, with the member's
+// username and email address as words it should not lean on. It returns
+// what is wrong for the form, and suggestions; both are empty if the
+// password is fine.
+func passwordProblem(policy password.Policy, pw string, userInputs ...string) (string, []string) {
+	var perr *password.Error
+	if errors.As(policy.Check(pw, userInputs...), &perr) {
+		return perr.Message, perr.Suggestions
+	}
+	return "", nil
+}
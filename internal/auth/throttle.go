@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/oidc"
+)
+
+// ipFactor is how many more failures an IP address is allowed than one
+// account, as several people may log in from behind the same address.
+const ipFactor = 5
+
+// LoginThrottle rate limits logins per client IP address and per account,
+// with the failures kept in the database so that restarts don't reset them.
+// Wrong passwords and wrong second-factor codes both count.
+type LoginThrottle struct {
+	db     *sql.DB
+	limits map[string]db.LoginLimits // by scope; empty if throttling is off
+}
+
+// NewLoginThrottle returns a throttle that locks an account for lockout
+// after maxFailures failures (an IP address after ipFactor times as many).
+// Either being 0 turns throttling off.
+func NewLoginThrottle(dbConn *sql.DB, maxFailures int, lockout time.Duration) LoginThrottle {
+	t := LoginThrottle{db: dbConn, limits: map[string]db.LoginLimits{}}
+	if maxFailures == 0 || lockout == 0 {
+		return t
+	}
+	account := db.LoginLimits{
+		FreeFailures: min(3, maxFailures),
+		MaxFailures:  maxFailures,
+		BaseDelay:    2 * time.Second,
+		MaxDelay:     min(time.Minute, lockout),
+		Lockout:      lockout,
+	}
+	ip := account
+	ip.FreeFailures *= ipFactor
+	ip.MaxFailures *= ipFactor
+	t.limits[db.LoginScopeAccount] = account
+	t.limits[db.LoginScopeIP] = ip
+	return t
+}
+
+// subjects returns what an attempt counts against in each scope.
+func (t LoginThrottle) subjects(r *http.Request, email string) map[string]string {
+	return map[string]string{
+		db.LoginScopeIP:      middleware.ClientIP(r),
+		db.LoginScopeAccount: strings.ToLower(strings.TrimSpace(email)),
+	}
+}
+
+// retryAt returns when the next attempt may be made (zero or past if now),
+// taking the later of the IP and account limits, and whether that is a
+// lockout rather than a short delay.
+func (t LoginThrottle) retryAt(r *http.Request, email string) (at time.Time, locked bool, err error) {
+	for scope, subject := range t.subjects(r, email) {
+		l, ok := t.limits[scope]
+		if !ok {
+			continue
+		}
+		a, lk, err := db.LoginRetryAt(t.db, scope, subject, l)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if a.After(at) {
+			at, locked = a, lk
+		}
+	}
+	return at, locked, nil
+}
+
+// fail records a failed attempt in both scopes.
+func (t LoginThrottle) fail(r *http.Request, email string) {
+	for scope, subject := range t.subjects(r, email) {
+		if l, ok := t.limits[scope]; ok {
+			if err := db.RecordLoginFailure(t.db, scope, subject, l.Lockout); err != nil {
+				log.Printf("Could not record login failure for %s %s: %v", scope, subject, err)
+			}
+		}
+	}
+}
+
+// succeed forgets the account's failures. Those of the IP address are
+// kept, so that one working account doesn't open the way for guessing
+// at others.
+func (t LoginThrottle) succeed(email string) {
+	subject := strings.ToLower(strings.TrimSpace(email))
+	if err := db.ClearLoginFailures(t.db, db.LoginScopeAccount, subject); err != nil {
+		log.Printf("Could not clear login failures for %s: %v", subject, err)
+	}
+}
+
+// refuse answers the request with the login form (with the providers'
+// buttons) and a 429 if an attempt for email comes too soon after failed
+// ones, and reports whether it did.
+func (t LoginThrottle) refuse(w http.ResponseWriter, r *http.Request, providers []*oidc.Provider, email string) bool {
+	retryAt, locked, err := t.retryAt(r, email)
+	if err != nil {
+		log.Printf("Login throttle lookup failed for %s: %v", email, err)
+		http.Error(w, "server error", 500)
+		return true
+	}
+	if !time.Now().Before(retryAt) {
+		return false
+	}
+	log.Printf("Login throttled for %s from %s", email, middleware.ClientIP(r))
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(retryAt).Seconds())+1))
+	w.WriteHeader(http.StatusTooManyRequests)
+	loginError(w, r, providers, retryMessage(retryAt, locked))
+	return true
+}
+
+// retryMessage tells the user when they may try to log in again.
+func retryMessage(at time.Time, locked bool) string {
+	wait := time.Until(at)
+	var in string
+	if wait < time.Minute {
+		in = fmt.Sprintf("%d seconds", int(wait.Seconds())+1)
+	} else {
+		in = fmt.Sprintf("%d minutes", int(wait.Minutes())+1)
+	}
+	if locked {
+		return fmt.Sprintf("Too many failed login attempts. Logging in is locked until %s UTC; please try again in %s.",
+			at.UTC().Format("15:04:05"), in)
+	}
+	return fmt.Sprintf("Too many failed login attempts. Please wait %s before trying again (until %s UTC).",
+		in, at.UTC().Format("15:04:05"))
+}
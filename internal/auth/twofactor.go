@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/oidc"
+	"literary-lions/internal/password"
+	"literary-lions/internal/qrcode"
+	"literary-lions/internal/totp"
+	"literary-lions/internal/views"
+)
+
+const (
+	// loginChallengeTTL is how long the second login step may take.
+	loginChallengeTTL = 5 * time.Minute
+	// challengeCookie carries the login challenge between the two steps.
+	challengeCookie = "login_challenge"
+	// maxChallengeAttempts is how many wrong codes a login challenge takes
+	// before the password has to be entered again.
+	maxChallengeAttempts = 5
+	// recoveryCodeCount is how many recovery codes a user gets.
+	recoveryCodeCount = 10
+	// totpIssuer names the site in authenticator apps.
+	totpIssuer = "Literary Lions"
+)
+
+// setChallengeCookie sets (or, with maxAge -1, clears) the login challenge cookie.
+func setChallengeCookie(w http.ResponseWriter, token string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     challengeCookie,
+		Value:    token,
+		Path:     "/login/2fa",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// TwoFactorLoginPageData holds the second login step's form.
+type TwoFactorLoginPageData struct {
+	models.BasePageData
+	Account string
+	Error   string
+}
+
+// NewTwoFactorLoginHandler returns the handler for /login/2fa, the second
+// login step for users with two-factor authentication on. It takes a code
+// from their authenticator app or one of their recovery codes, and logs
+// them in. Wrong codes count against the login throttle, and after
+// maxChallengeAttempts of them the user has to start again.
+func NewTwoFactorLoginHandler(dbConn *sql.DB, throttle LoginThrottle, providers []*oidc.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 1. Find the login in progress
+		c, err := r.Cookie(challengeCookie)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		userID, username, email, err := db.LoginChallengeUser(dbConn, c.Value)
+		if errors.Is(err, sql.ErrNoRows) {
+			setChallengeCookie(w, "", -1)
+			loginError(w, r, providers, "Your login has expired. Please enter your password again.")
+			return
+		}
+		if err != nil {
+			log.Println("Login challenge lookup failed:", err)
+			http.Error(w, "server error", 500)
+			return
+		}
+		data := TwoFactorLoginPageData{Account: username}
+
+		// 2. Ask for the code on GET
+		if r.Method == http.MethodGet {
+			views.Render(w, r, "login_2fa.html", data)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// 3. Check the code: six digits from the app, anything else a recovery code
+		if throttle.refuse(w, r, providers, email) {
+			return
+		}
+		code := strings.TrimSpace(r.FormValue("code"))
+		ok, usedRecovery, err := checkSecondFactor(dbConn, userID, code)
+		if err != nil {
+			log.Println("Two-factor check failed:", err)
+			http.Error(w, "server error", 500)
+			return
+		}
+		if !ok {
+			log.Printf("Wrong two-factor code for user %s", username)
+			throttle.fail(r, email)
+			left, err := db.FailLoginChallenge(dbConn, c.Value, maxChallengeAttempts)
+			if err != nil {
+				log.Println("Could not count failed login challenge:", err)
+			}
+			if left == 0 {
+				setChallengeCookie(w, "", -1)
+				w.WriteHeader(http.StatusBadRequest)
+				loginError(w, r, providers, "Too many wrong codes. Please log in again.")
+				return
+			}
+			data.Error = "That code is not right. Please try again."
+			w.WriteHeader(http.StatusBadRequest)
+			views.Render(w, r, "login_2fa.html", data)
+			return
+		}
+
+		// 4. Log in; after a recovery code, point out how many are left
+		if err := db.EndLoginChallenge(dbConn, c.Value); err != nil {
+			log.Println("Could not end login challenge:", err)
+		}
+		setChallengeCookie(w, "", -1)
+		throttle.succeed(email)
+		if err := startSession(w, r, dbConn, userID); err != nil {
+			log.Printf("Failed to create session for user %s: %v", username, err)
+			http.Error(w, "server error", 500)
+			return
+		}
+		landing := "/"
+		if usedRecovery {
+			landing = "/settings/2fa?recovery=1"
+		}
+		http.Redirect(w, r, landingPage(dbConn, userID, landing), http.StatusSeeOther)
+	}
+}
+
+// checkSecondFactor checks a code from the user's authenticator app (which
+// then can't be used again) or, failing that, uses up a recovery code.
+func checkSecondFactor(dbConn *sql.DB, userID int, code string) (ok, recovery bool, err error) {
+	secret, err := db.TOTPSecret(dbConn, userID, false)
+	if err != nil {
+		return false, false, err
+	}
+	if step, valid := totp.Verify(secret, code, time.Now()); valid {
+		ok, err := db.UseTOTPStep(dbConn, userID, step)
+		return ok, false, err
+	}
+	ok, err = db.UseRecoveryCode(dbConn, userID, code)
+	return ok, ok, err
+}
+
+// newRecoveryCodes returns a fresh set of recovery codes, like "k3f9q-x2mz7".
+func newRecoveryCodes() ([]string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789" // no look-alikes
+	codes := make([]string, recoveryCodeCount)
+	b := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+	return codes, nil
+}
+
+// TwoFactorPageData holds the two-factor settings page.
+type TwoFactorPageData struct {
+	models.BasePageData
+	Enabled       bool
+	Required      bool     // the site requires it of this user (staff)
+	HasPassword   bool     // false for members who signed up through a provider
+	Secret        string   // while enrolling, for typing in by hand
+	CodesLeft     int      // unused recovery codes
+	RecoveryCodes []string // new codes, shown only once
+	Error         string
+	Notice        string
+}
+
+// NewTwoFactorSettingsHandler returns the handler for /settings/2fa, where
+// users turn two-factor authentication on and off.
+//   - GET: Show the status or, if it is off, start enrolment: a QR code (see
+//     NewTwoFactorQRHandler) and the secret for the authenticator app.
+//   - POST action=confirm: Turn it on, given a code from the app, and show
+//     the recovery codes.
+//   - POST action=regenerate: Replace the recovery codes, given a code.
+//   - POST action=disable: Turn it off, given the password (or a code, for
+//     members without one); not for staff when the site requires it of them.
+func NewTwoFactorSettingsHandler(dbConn *sql.DB, hasher password.Hasher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		data := TwoFactorPageData{BasePageData: models.BasePageData{Username: username, LoggedIn: true}}
+
+		// 1. Is it on, and must it be?
+		enabled, err := db.TwoFactorEnabled(dbConn, userID)
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+		data.Required, err = staffTwoFactorRequired(dbConn, r)
+		var hash string
+		if err == nil {
+			err = dbConn.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hash)
+		}
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+		data.HasPassword = hash != db.NoPassword
+
+		// 2. Apply the requested change
+		if r.Method == http.MethodPost {
+			data.Error, data.Notice, data.RecoveryCodes, err = applyTwoFactorAction(dbConn, hasher, r, userID, hash, enabled, data.Required)
+			if err != nil {
+				log.Println("Two-factor change failed:", err)
+				middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not change two-factor authentication.", true, username)
+				return
+			}
+			if data.Error == "" {
+				log.Printf("User %s: %s", username, data.Notice)
+			}
+			enabled, _ = db.TwoFactorEnabled(dbConn, userID)
+		} else if r.URL.Query().Get("recovery") == "1" {
+			data.Notice = "You logged in with a recovery code, which now no longer works."
+		}
+		data.Enabled = enabled
+
+		// 3. Load what the page shows: the recovery codes left, or a new enrolment
+		if enabled {
+			data.CodesLeft, err = db.RecoveryCodesLeft(dbConn, userID)
+		} else {
+			var secret string
+			if secret, err = totp.NewSecret(); err == nil {
+				data.Secret, err = db.StartTOTPEnrolment(dbConn, userID, secret)
+			}
+		}
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+
+		// 4. Render
+		if data.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.Render(w, r, "settings_2fa.html", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// staffTwoFactorRequired reports whether the site requires two-factor
+// authentication of the logged-in user, for being a moderator or admin.
+func staffTwoFactorRequired(dbConn *sql.DB, r *http.Request) (bool, error) {
+	if !models.RoleAtLeast(middleware.CurrentRole(r), models.RoleModerator) {
+		return false, nil
+	}
+	v, err := db.Setting(dbConn, db.SettingRequireStaff2FA)
+	return v == "1", err
+}
+
+// applyTwoFactorAction carries out a POST to /settings/2fa for the user,
+// whose password hash is hash. Problems with the form come back as the
+// page's error message, success as its notice.
+func applyTwoFactorAction(dbConn *sql.DB, hasher password.Hasher, r *http.Request, userID int, hash string, enabled, required bool) (formErr, notice string, codes []string, err error) {
+	code := r.FormValue("code")
+	switch action := r.FormValue("action"); {
+	case action == "confirm" && !enabled:
+		secret, err := db.TOTPSecret(dbConn, userID, true)
+		if err != nil {
+			return "", "", nil, err
+		}
+		step, ok := totp.Verify(secret, code, time.Now())
+		if !ok {
+			return "That code is not right. Check the time on your device and try again.", "", nil, nil
+		}
+		if codes, err = newRecoveryCodes(); err != nil {
+			return "", "", nil, err
+		}
+		if err := db.ConfirmTOTP(dbConn, userID, step, codes); err != nil {
+			return "", "", nil, err
+		}
+		return "", "Two-factor authentication is on.", codes, nil
+
+	case action == "regenerate" && enabled:
+		ok, _, err := checkSecondFactor(dbConn, userID, code)
+		if err != nil || !ok {
+			return "That code is not right.", "", nil, err
+		}
+		if codes, err = newRecoveryCodes(); err != nil {
+			return "", "", nil, err
+		}
+		if err := db.ReplaceRecoveryCodes(dbConn, userID, codes); err != nil {
+			return "", "", nil, err
+		}
+		return "", "New recovery codes made; the old ones no longer work.", codes, nil
+
+	case action == "disable" && enabled:
+		if required {
+			return "Moderators and admins must keep two-factor authentication on.", "", nil, nil
+		}
+		if hash == db.NoPassword {
+			// Members who signed up through a provider have a code to give instead
+			ok, _, err := checkSecondFactor(dbConn, userID, code)
+			if err != nil || !ok {
+				return "That code is not right.", "", nil, err
+			}
+		} else if !hasher.Verify(hash, r.FormValue("password")) {
+			return "That password is not right.", "", nil, nil
+		}
+		if err := db.DisableTwoFactor(dbConn, userID); err != nil {
+			return "", "", nil, err
+		}
+		return "", "Two-factor authentication is off.", nil, nil
+	}
+	return "Unknown action.", "", nil, nil
+}
+
+// NewTwoFactorQRHandler returns the handler for /settings/2fa/qr.png: the
+// QR code of the logged-in user's enrolment in progress, for scanning with
+// an authenticator app.
+func NewTwoFactorQRHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.NotFound(w, r)
+			return
+		}
+		secret, err := db.TOTPSecret(dbConn, userID, true)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		code, err := qrcode.Encode([]byte(totp.URI(totpIssuer, username, secret)))
+		if err != nil {
+			log.Println("QR code failed:", err)
+			http.Error(w, "server error", 500)
+			return
+		}
+		img, err := code.PNG(5)
+		if err != nil {
+			log.Println("QR code failed:", err)
+			http.Error(w, "server error", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(img)
+	}
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/mail"
+	"literary-lions/internal/middleware"
+)
+
+// verificationTTL is how long an email confirmation link works.
+const verificationTTL = 48 * time.Hour
+
+// sendVerification mails the user a link (on baseURL) confirming that
+// email is theirs. Returns db.ErrTooSoon if one was sent moments ago.
+func sendVerification(dbConn *sql.DB, mailer mail.Mailer, baseURL string, userID int, username, email string) error {
+	token, err := db.CreateEmailVerification(dbConn, userID, email, verificationTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Confirm your email address for Literary Lions",
+		Body: "Hello " + username + ",\n\n" +
+			"Please confirm that this is your email address by opening:\n\n" +
+			baseURL + "/verify/" + token + "\n\n" +
+			"You can read the forum meanwhile, and post once it is confirmed. The link works for two days;\n" +
+			"you can ask for a new one on your profile page. If you didn't sign up, you can ignore this email.\n",
+	})
+}
+
+// NewVerifyEmailHandler returns a handler for /verify/{token}, where the
+// link from the confirmation mail leads. It marks the address as confirmed
+// and sends the user to their profile (or to the login page).
+func NewVerifyEmailHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, sessionUsername, loggedIn := middleware.CurrentUser(r)
+		username, err := db.VerifyEmail(dbConn, r.PathValue("token"))
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.ErrorHandler(w, http.StatusBadRequest,
+				"This confirmation link is invalid or has expired. You can get a new one from your profile page.",
+				loggedIn, sessionUsername)
+			return
+		}
+		if errors.Is(err, db.ErrEmailTaken) {
+			middleware.ErrorHandler(w, http.StatusConflict,
+				"This email address has been taken by another account meanwhile.", loggedIn, sessionUsername)
+			return
+		}
+		if err != nil {
+			log.Println("Email verification failed:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", loggedIn, sessionUsername)
+			return
+		}
+		log.Printf("Email address of %s confirmed", username)
+		if loggedIn && sessionUsername == username {
+			http.Redirect(w, r, "/u/"+username+"?verified=1", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/login?verified=1", http.StatusSeeOther)
+	}
+}
+
+// NewResendVerificationHandler returns a handler for POST /verify/resend,
+// which mails the logged-in user a new confirmation link.
+func NewResendVerificationHandler(dbConn *sql.DB, mailer mail.Mailer, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 1. Only logged-in users
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		// 2. Nothing to do if the address is already confirmed
+		email, unverified, err := db.UnverifiedEmail(dbConn, userID)
+		if err != nil {
+			log.Println("DB error:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Database error", true, username)
+			return
+		}
+		if !unverified {
+			http.Redirect(w, r, "/u/"+username, http.StatusSeeOther)
+			return
+		}
+
+		// 3. Send a new link (at most one a minute)
+		err = sendVerification(dbConn, mailer, baseURL, userID, username, email)
+		if err != nil && !errors.Is(err, db.ErrTooSoon) {
+			log.Printf("Could not send confirmation mail to %s: %v", email, err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "We could not send the email. Please try again later.", true, username)
+			return
+		}
+		http.Redirect(w, r, "/u/"+username+"?sent=1", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,179 @@
+// Package config holds the server settings. Every value has a sensible
+// default and can be overridden with a LIONS_* environment variable.
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the full set of server settings.
+type Config struct {
+	Addr   string // HTTP listen address (LIONS_ADDR)
+	DBPath string // SQLite database file (LIONS_DB)
+
+	// CommentMaxDepth is how many reply levels are shown under a comment
+	// before a "continue this thread" link (LIONS_COMMENT_MAX_DEPTH), at
+	// least 1.
+	CommentMaxDepth int
+	// CommentCollapseDepth is the reply level from which branches start
+	// collapsed (LIONS_COMMENT_COLLAPSE_DEPTH).
+	CommentCollapseDepth int
+
+	// PageSize is how many posts the home, category, tag, profile and search
+	// listings show per page (LIONS_PAGE_SIZE).
+	PageSize int
+
+	// LoginMaxFailures is how many failed logins lock an account for
+	// LoginLockout (LIONS_LOGIN_MAX_FAILURES); an IP address gets five
+	// times as many. LoginLockout is set in minutes (LIONS_LOGIN_LOCKOUT_MINUTES).
+	// Setting either to 0 turns login rate limiting off.
+	LoginMaxFailures int
+	LoginLockout     time.Duration
+
+	// New passwords need at least PasswordMinLength characters
+	// (LIONS_PASSWORD_MIN_LENGTH) and a strength score of PasswordMinScore,
+	// from 0 to 4 (LIONS_PASSWORD_MIN_SCORE). They are also checked against
+	// the leaked password hashes at BreachedPasswords
+	// (LIONS_BREACHED_PASSWORDS), a file or a directory of range files;
+	// without it that check is skipped.
+	PasswordMinLength int
+	PasswordMinScore  int
+	BreachedPasswords string
+
+	// PasswordHash is the algorithm new password hashes use, "bcrypt" or
+	// "argon2id" (LIONS_PASSWORD_HASH); bcrypt hashes use BcryptCost
+	// (LIONS_BCRYPT_COST). Hashes made otherwise, or with weaker
+	// parameters, are replaced when their owner next logs in.
+	PasswordHash string
+	BcryptCost   int
+
+	// OIDCProviders are the OpenID Connect identity providers members can
+	// log in with, named in LIONS_OIDC_PROVIDERS (comma separated, e.g.
+	// "google,work"). Each is set up with LIONS_OIDC_<NAME>_ISSUER,
+	// _CLIENT_ID, _CLIENT_SECRET and _LABEL (the button text); their
+	// redirect URL is BaseURL/login/oidc/<name>/callback.
+	OIDCProviders []OIDCProvider
+
+	// DeletionGrace is how long after a member asks for their account to
+	// be deleted it is (LIONS_DELETION_GRACE_DAYS); until then they can
+	// change their mind.
+	DeletionGrace time.Duration
+
+	// BaseURL is the address of the site as seen by users, for links in
+	// emails (LIONS_BASE_URL).
+	BaseURL string
+
+	// Outgoing mail goes through the SMTP server at SMTPAddr (LIONS_SMTP_ADDR,
+	// host:port) as MailFrom (LIONS_MAIL_FROM), logging in with SMTPUsername
+	// and SMTPPassword if set (LIONS_SMTP_USERNAME, LIONS_SMTP_PASSWORD).
+	// Without SMTPAddr mail is not sent, but written to files in MailDir
+	// (LIONS_MAIL_DIR) or, if that is empty too, to the log.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	MailDir      string
+}
+
+// OIDCProvider is an OpenID Connect identity provider's settings.
+type OIDCProvider struct {
+	Name         string
+	Label        string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
+
+// Load reads the configuration from the environment, falling back to
+// defaults for anything that is unset or invalid.
+func Load() Config {
+	return Config{
+		Addr:                 envString("LIONS_ADDR", ":8080"),
+		DBPath:               envString("LIONS_DB", "forum.db"),
+		CommentMaxDepth:      envInt("LIONS_COMMENT_MAX_DEPTH", 5),
+		CommentCollapseDepth: envInt("LIONS_COMMENT_COLLAPSE_DEPTH", 3),
+		PageSize:             envInt("LIONS_PAGE_SIZE", 20),
+		LoginMaxFailures:     envInt("LIONS_LOGIN_MAX_FAILURES", 10),
+		LoginLockout:         time.Duration(envInt("LIONS_LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+		PasswordMinLength:    envInt("LIONS_PASSWORD_MIN_LENGTH", 8),
+		PasswordMinScore:     min(envInt("LIONS_PASSWORD_MIN_SCORE", 2), 4),
+		BreachedPasswords:    envString("LIONS_BREACHED_PASSWORDS", ""),
+		PasswordHash:         envString("LIONS_PASSWORD_HASH", "bcrypt"),
+		BcryptCost:           envInt("LIONS_BCRYPT_COST", 12),
+		DeletionGrace:        time.Duration(envInt("LIONS_DELETION_GRACE_DAYS", 14)) * 24 * time.Hour,
+		BaseURL:              strings.TrimSuffix(envString("LIONS_BASE_URL", "http://localhost:8080"), "/"),
+		SMTPAddr:             envString("LIONS_SMTP_ADDR", ""),
+		SMTPUsername:         envString("LIONS_SMTP_USERNAME", ""),
+		SMTPPassword:         envString("LIONS_SMTP_PASSWORD", ""),
+		MailFrom:             envString("LIONS_MAIL_FROM", "Literary Lions <noreply@localhost>"),
+		MailDir:              envString("LIONS_MAIL_DIR", ""),
+		OIDCProviders:        oidcProviders(),
+	}
+}
+
+// Validate reports settings the server cannot run with.
+func (c Config) Validate() error {
+	// At 0 no reply would be shown, nor a link to continue the thread
+	if c.CommentMaxDepth < 1 {
+		return fmt.Errorf("config: LIONS_COMMENT_MAX_DEPTH must be at least 1, not %d", c.CommentMaxDepth)
+	}
+	return nil
+}
+
+// oidcNames are what a provider name may look like: it appears in URLs.
+var oidcNames = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// oidcProviders reads the identity providers named in LIONS_OIDC_PROVIDERS,
+// skipping any that are not fully set up.
+func oidcProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("LIONS_OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "LIONS_OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := OIDCProvider{
+			Name:         name,
+			Label:        envString(prefix+"LABEL", name),
+			Issuer:       envString(prefix+"ISSUER", ""),
+			ClientID:     envString(prefix+"CLIENT_ID", ""),
+			ClientSecret: envString(prefix+"CLIENT_SECRET", ""),
+		}
+		if !oidcNames.MatchString(name) || p.Issuer == "" || p.ClientID == "" {
+			log.Printf("config: ignoring identity provider %q: it needs a name of a-z, 0-9 and -, %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+			continue
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+// envString returns the value of key, or def if it is unset or empty.
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt returns the integer value of key, or def if it is unset or not
+// a non-negative number.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("config: ignoring invalid %s=%q, using %d", key, v, def)
+		return def
+	}
+	return n
+}
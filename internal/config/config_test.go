@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestValidateCommentMaxDepth(t *testing.T) {
+	tests := []struct {
+		env   string
+		depth int
+		ok    bool
+	}{
+		{"", 5, true},
+		{"1", 1, true},
+		{"12", 12, true},
+		{"0", 0, false},
+		{"-1", 5, true}, // invalid, so the default
+		{"deep", 5, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("LIONS_COMMENT_MAX_DEPTH", tt.env)
+		cfg := Load()
+		if cfg.CommentMaxDepth != tt.depth {
+			t.Errorf("LIONS_COMMENT_MAX_DEPTH=%q: depth %d, want %d", tt.env, cfg.CommentMaxDepth, tt.depth)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.ok {
+			t.Errorf("LIONS_COMMENT_MAX_DEPTH=%q: Validate = %v", tt.env, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrNameTaken is returned when a username is already another account's,
+// or reserved (see ReservedUsername).
+var ErrNameTaken = errors.New("username in use")
+
+// ChangePassword sets the user's password hash, uses up any outstanding
+// reset links and ends all their sessions but keepSessionID.
+func ChangePassword(db *sql.DB, userID int, passwordHash, keepSessionID string) error {
+	now := time.Now().UTC().Format(timestampLayout)
+	return inTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE users SET password = ? WHERE id = ?`, passwordHash, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`, now, userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM sessions WHERE user_id = ? AND id != ?`, userID, keepSessionID)
+		return err
+	})
+}
+
+// RehashPassword replaces the user's password hash with a new hash of the
+// same password, made with stronger parameters. Unlike ChangePassword it
+// leaves sessions and reset links alone.
+func RehashPassword(db *sql.DB, userID int, passwordHash string) error {
+	_, err := db.Exec(`UPDATE users SET password = ? WHERE id = ?`, passwordHash, userID)
+	return err
+}
+
+// ChangeUsername renames the user, and keeps their old name redirecting to
+// them (see UsernameRedirect). Returns ErrNameTaken if another account has
+// the new name, or it is reserved.
+func ChangeUsername(db *sql.DB, userID int, username string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		var (
+			old   string
+			taken bool
+		)
+		err := tx.QueryRow(`
+			SELECT username, EXISTS (SELECT 1 FROM users WHERE username = ? AND id != ?)
+			FROM users WHERE id = ?`, username, userID, userID).Scan(&old, &taken)
+		if err != nil {
+			return err
+		}
+		if taken || ReservedUsername(username) {
+			return ErrNameTaken
+		}
+		if old == username {
+			return nil
+		}
+		if _, err := tx.Exec(`UPDATE users SET username = ? WHERE id = ?`, username, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM username_redirects WHERE old_username = ?`, username); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO username_redirects(old_username, user_id) VALUES (?, ?)
+			ON CONFLICT(old_username) DO UPDATE SET user_id = excluded.user_id, created_at = CURRENT_TIMESTAMP`,
+			old, userID)
+		return err
+	})
+}
+
+// UsernameRedirect returns the current name of the user who used to be
+// called old. Returns sql.ErrNoRows if nobody was.
+func UsernameRedirect(db *sql.DB, old string) (string, error) {
+	var username string
+	err := db.QueryRow(`
+		SELECT u.username FROM username_redirects ur JOIN users u ON u.id = ur.user_id
+		WHERE ur.old_username = ?`, old).Scan(&username)
+	return username, err
+}
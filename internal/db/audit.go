@@ -0,0 +1,184 @@
+package db
+
+import (
+	"database/sql"
+	"literary-lions/internal/models"
+	"time"
+)
+
+// Audit log actions, as "<target type>.<verb>".
+const (
+	AuditPostDelete      = "post.delete"
+	AuditPostLock        = "post.lock"
+	AuditPostUnlock      = "post.unlock"
+	AuditCommentDelete   = "comment.delete"
+	AuditUserBan         = "user.ban"
+	AuditUserSuspend     = "user.suspend"
+	AuditUserLift        = "user.lift"
+	AuditUserRole        = "user.role"
+	AuditCategoryCreate  = "category.create"
+	AuditCategoryUpdate  = "category.update"
+	AuditCategoryMove    = "category.move"
+	AuditCategoryArchive = "category.archive"
+	AuditCategoryRestore = "category.restore"
+	AuditCategoryMerge   = "category.merge"
+	AuditReportResolve   = "report.resolve"
+	AuditReportDismiss   = "report.dismiss"
+	AuditSettingUpdate   = "setting.update"
+)
+
+// AuditTargetTypes are the kinds of things audit log entries refer to.
+var AuditTargetTypes = []string{"post", "comment", "user", "category", "setting"}
+
+// AuditActions lists every audit log action, for filtering.
+var AuditActions = []string{
+	AuditPostDelete, AuditPostLock, AuditPostUnlock, AuditCommentDelete,
+	AuditUserBan, AuditUserSuspend, AuditUserLift, AuditUserRole,
+	AuditCategoryCreate, AuditCategoryUpdate, AuditCategoryMove,
+	AuditCategoryArchive, AuditCategoryRestore, AuditCategoryMerge,
+	AuditReportResolve, AuditReportDismiss, AuditSettingUpdate,
+}
+
+// Snapshot queries: each selects one row (by ID) as a JSON object, for the
+// before and after columns of the audit log.
+const (
+	postSnapshot = `
+		SELECT json_object('title', title, 'content', content, 'user_id', user_id,
+			'category_id', category_id, 'locked', locked_at IS NOT NULL)
+		FROM posts WHERE id = ?`
+	commentSnapshot = `
+		SELECT json_object('content', content, 'user_id', user_id, 'post_id', post_id,
+			'deleted', deleted_at IS NOT NULL)
+		FROM comments WHERE id = ?`
+	userSnapshot = `
+		SELECT json_object('username', username, 'role', role,
+			'categories', (SELECT json_group_array(category_id) FROM moderator_categories WHERE user_id = users.id),
+			'sanction', (SELECT json_object('kind', s.kind, 'reason', s.reason, 'expires_at', s.expires_at)
+				FROM user_sanctions s WHERE s.user_id = users.id AND ` + activeSanction + `
+				ORDER BY s.kind = 'ban' DESC, s.expires_at IS NULL DESC, s.expires_at DESC LIMIT 1))
+		FROM users WHERE id = ?`
+	categorySnapshot = `
+		SELECT json_object('name', name, 'description', description, 'position', position,
+			'archived', archived_at IS NOT NULL, 'merged_into_id', merged_into_id,
+			'posts', (SELECT COUNT(*) FROM posts WHERE category_id = categories.id))
+		FROM categories WHERE id = ?`
+	settingSnapshot = `
+		SELECT json_object('key', key, 'value', value)
+		FROM settings WHERE id = ?`
+)
+
+// snapshot runs a snapshot query for id. It returns NULL if the row does
+// not exist (any more).
+func snapshot(tx *sql.Tx, query string, id int) (sql.NullString, error) {
+	var s sql.NullString
+	err := tx.QueryRow(query, id).Scan(&s)
+	if err == sql.ErrNoRows {
+		return s, nil
+	}
+	return s, err
+}
+
+// audit records a staff action in the audit log as part of tx. actorID 0
+// stands for the command line. before and after are JSON snapshots made
+// with snapshot (NULL where there is nothing to show).
+func audit(tx *sql.Tx, actorID int, action, targetType string, targetID int, reason string, before, after sql.NullString) error {
+	_, err := tx.Exec(`
+		INSERT INTO audit_log (actor_id, actor_name, action, target_type, target_id, reason, before, after)
+		VALUES (NULLIF(?, 0), COALESCE((SELECT username FROM users WHERE id = ?), 'command line'), ?, ?, ?, ?, ?, ?)`,
+		actorID, actorID, action, targetType, targetID, reason, before, after)
+	return err
+}
+
+// auditChange records an action on the row targetID, with snapshots of it
+// (taken by the snapshot query q) from before and after change runs.
+func auditChange(tx *sql.Tx, actorID int, action, targetType string, targetID int, reason, q string, change func() error) error {
+	before, err := snapshot(tx, q, targetID)
+	if err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	after, err := snapshot(tx, q, targetID)
+	if err != nil {
+		return err
+	}
+	return audit(tx, actorID, action, targetType, targetID, reason, before, after)
+}
+
+// AuditFilter narrows down the audit log. Zero fields match everything;
+// To is exclusive.
+type AuditFilter struct {
+	Actor      string // actor's name, case-insensitive
+	Action     string
+	TargetType string
+	TargetID   int
+	From, To   time.Time
+}
+
+// conds turns the filter into WHERE conditions and their args.
+func (f AuditFilter) conds() ([]string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	if f.Actor != "" {
+		conds = append(conds, "actor_name = ? COLLATE NOCASE")
+		args = append(args, f.Actor)
+	}
+	if f.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.TargetType != "" {
+		conds = append(conds, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != 0 {
+		conds = append(conds, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, f.From.UTC().Format(timestampLayout))
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, f.To.UTC().Format(timestampLayout))
+	}
+	return conds, args
+}
+
+// FetchAuditLog returns audit log entries matching f, newest first,
+// skipping offset entries and returning at most limit (all if limit <= 0).
+// more tells whether further entries match.
+func FetchAuditLog(db *sql.DB, f AuditFilter, offset, limit int) (entries []models.AuditEntry, more bool, err error) {
+	conds, args := f.conds()
+	query := `
+		SELECT id, COALESCE(actor_id, 0), actor_name, action, target_type, target_id,
+		       reason, COALESCE(before, ''), COALESCE(after, ''), created_at
+		FROM audit_log ` + whereClause(conds) + `
+		ORDER BY id DESC`
+	if limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit+1, offset)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e models.AuditEntry
+		err := rows.Scan(&e.ID, &e.ActorID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID,
+			&e.Reason, &e.Before, &e.After, &e.CreatedAt)
+		if err != nil {
+			return nil, false, err
+		}
+		entries = append(entries, e)
+	}
+	if limit > 0 && len(entries) > limit {
+		entries, more = entries[:limit], true
+	}
+	return entries, more, rows.Err()
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"literary-lions/internal/models"
+)
+
+// ErrCategoryExists is returned when a category name is already taken.
+var ErrCategoryExists = errors.New("a category with this name already exists")
+
+// openCategory selects the category whose ID is given as argument if it
+// takes new posts (it is neither archived nor merged away).
+const openCategory = `
+	SELECT 1 FROM categories
+	WHERE id = ? AND archived_at IS NULL AND merged_into_id IS NULL`
+
+// FetchCategories returns the categories shown in the sidebar and offered
+// for new posts, in their admin-defined order. Archived and merged
+// categories are left out.
+func FetchCategories(db *sql.DB) ([]models.Category, error) {
+	rows, err := db.Query(`
+		SELECT id, name, description FROM categories
+		WHERE archived_at IS NULL AND merged_into_id IS NULL
+		ORDER BY position, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cats []models.Category
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description); err != nil {
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+// FetchAllCategories returns every category that has not been merged away,
+// archived ones included, in order and with their post counts.
+func FetchAllCategories(db *sql.DB) ([]models.Category, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, c.description, c.archived_at IS NOT NULL,
+		       (SELECT COUNT(*) FROM posts p WHERE p.category_id = c.id)
+		FROM categories c
+		WHERE c.merged_into_id IS NULL
+		ORDER BY c.position, c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cats []models.Category
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Archived, &c.Posts); err != nil {
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+// GetCategory returns a category by ID, whether archived or merged.
+// Returns sql.ErrNoRows if there is no such category.
+func GetCategory(db *sql.DB, id int) (models.Category, error) {
+	var c models.Category
+	err := db.QueryRow(`
+		SELECT id, name, description, archived_at IS NOT NULL, COALESCE(merged_into_id, 0)
+		FROM categories WHERE id = ?`, id).
+		Scan(&c.ID, &c.Name, &c.Description, &c.Archived, &c.MergedInto)
+	return c, err
+}
+
+// nameTaken reports whether another category than id is called name
+// (case-insensitively).
+func nameTaken(tx *sql.Tx, name string, id int) (bool, error) {
+	var taken bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE name = ? COLLATE NOCASE AND id != ?)`,
+		name, id).Scan(&taken)
+	return taken, err
+}
+
+// CreateCategory adds a category at the end of the list and returns its ID,
+// or ErrCategoryExists if the name is taken.
+//
+// Like the other category changes below, it is recorded in the audit log as
+// done by actorID.
+func CreateCategory(db *sql.DB, actorID int, name, description string) (int, error) {
+	var id int
+	err := inTx(db, func(tx *sql.Tx) error {
+		if taken, err := nameTaken(tx, name, 0); err != nil || taken {
+			if taken {
+				return ErrCategoryExists
+			}
+			return err
+		}
+		err := tx.QueryRow(`
+			INSERT INTO categories (name, description, position)
+			SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM categories
+			RETURNING id`, name, description).Scan(&id)
+		if err != nil {
+			return err
+		}
+		after, err := snapshot(tx, categorySnapshot, id)
+		if err != nil {
+			return err
+		}
+		return audit(tx, actorID, AuditCategoryCreate, "category", id, "", sql.NullString{}, after)
+	})
+	return id, err
+}
+
+// UpdateCategory renames a category and replaces its description.
+// Returns sql.ErrNoRows if there is no such category, or ErrCategoryExists
+// if the new name is taken.
+func UpdateCategory(db *sql.DB, actorID, id int, name, description string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		if taken, err := nameTaken(tx, name, id); err != nil || taken {
+			if taken {
+				return ErrCategoryExists
+			}
+			return err
+		}
+		return auditChange(tx, actorID, AuditCategoryUpdate, "category", id, "", categorySnapshot, func() error {
+			res, err := tx.Exec(`UPDATE categories SET name = ?, description = ? WHERE id = ?`, name, description, id)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+	})
+}
+
+// MoveCategory swaps a category's position with the one just above it (up)
+// or below it in the list. Moving past either end does nothing.
+// Returns sql.ErrNoRows if there is no such category.
+func MoveCategory(db *sql.DB, actorID, id int, up bool) error {
+	cmp, order := ">", "ASC"
+	if up {
+		cmp, order = "<", "DESC"
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		var (
+			pos  int
+			name string
+		)
+		err := tx.QueryRow(`SELECT position, name FROM categories WHERE id = ? AND merged_into_id IS NULL`, id).Scan(&pos, &name)
+		if err != nil {
+			return err
+		}
+		var otherID, otherPos int
+		err = tx.QueryRow(`
+			SELECT id, position FROM categories
+			WHERE merged_into_id IS NULL AND (position, name) `+cmp+` (?, ?)
+			ORDER BY position `+order+`, name `+order+`
+			LIMIT 1`, pos, name).Scan(&otherID, &otherPos)
+		if err == sql.ErrNoRows {
+			return nil // already first or last
+		}
+		if err != nil {
+			return err
+		}
+		return auditChange(tx, actorID, AuditCategoryMove, "category", id, "", categorySnapshot, func() error {
+			if _, err := tx.Exec(`UPDATE categories SET position = ? WHERE id = ?`, otherPos, id); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`UPDATE categories SET position = ? WHERE id = ?`, pos, otherID)
+			return err
+		})
+	})
+}
+
+// SetCategoryArchived archives or restores a category. Archived categories
+// keep their posts and page but leave the sidebar and take no new posts.
+// Returns sql.ErrNoRows if there is no such category.
+func SetCategoryArchived(db *sql.DB, actorID, id int, archived bool) error {
+	action := AuditCategoryRestore
+	if archived {
+		action = AuditCategoryArchive
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		return auditChange(tx, actorID, action, "category", id, "", categorySnapshot, func() error {
+			res, err := tx.Exec(`
+				UPDATE categories
+				SET archived_at = CASE WHEN ? THEN COALESCE(archived_at, CURRENT_TIMESTAMP) END
+				WHERE id = ? AND merged_into_id IS NULL`, archived, id)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+	})
+}
+
+// MergeCategory moves every post of category from into category into, in
+// one transaction. Moderators of from become moderators of into, and from
+// is archived and marked as merged, so its page redirects to into (as do
+// the pages of categories merged into from earlier).
+// Returns the number of posts moved, or sql.ErrNoRows if either category
+// does not exist, has already been merged, or they are the same.
+func MergeCategory(db *sql.DB, actorID, from, into int) (int, error) {
+	var moved int
+	err := inTx(db, func(tx *sql.Tx) error {
+		var n int
+		err := tx.QueryRow(`
+			SELECT COUNT(*) FROM categories
+			WHERE id IN (?, ?) AND merged_into_id IS NULL`, from, into).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n != 2 {
+			return sql.ErrNoRows
+		}
+
+		return auditChange(tx, actorID, AuditCategoryMerge, "category", from, "", categorySnapshot, func() error {
+			res, err := tx.Exec(`UPDATE posts SET category_id = ? WHERE category_id = ?`, into, from)
+			if err != nil {
+				return err
+			}
+			n64, _ := res.RowsAffected()
+			moved = int(n64)
+
+			for _, q := range []string{
+				`INSERT OR IGNORE INTO moderator_categories (user_id, category_id)
+				 SELECT user_id, ? FROM moderator_categories WHERE category_id = ?`,
+				`UPDATE categories SET merged_into_id = ? WHERE merged_into_id = ?`,
+			} {
+				if _, err := tx.Exec(q, into, from); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec(`DELETE FROM moderator_categories WHERE category_id = ?`, from); err != nil {
+				return err
+			}
+			_, err = tx.Exec(`
+				UPDATE categories
+				SET merged_into_id = ?, archived_at = COALESCE(archived_at, CURRENT_TIMESTAMP)
+				WHERE id = ?`, into, from)
+			return err
+		})
+	})
+	return moved, err
+}
@@ -3,20 +3,18 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"os"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// InitDB opens or creates an SQLite database at the provided path,
-// initializes its schema from "internal/db/schema.sql",
-// and returns the database connection.
-// Returns an error if any step fails
-func InitDB(path string) (*sql.DB, error) {
+// OpenDB opens or creates an SQLite database at the provided path and
+// checks that it is reachable. Foreign keys are enabled on every pooled
+// connection. The schema is left untouched.
+func OpenDB(path string) (*sql.DB, error) {
 	fmt.Println("🔄 Opening database at:", path)
 
 	// Open the SQLite DB (creates if not exist)
-	dbConn, err := sql.Open("sqlite3", path)
+	dbConn, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on")
 	if err != nil {
 		return nil, fmt.Errorf("❌ Failed to open database: %w", err)
 	}
@@ -26,21 +24,36 @@ func InitDB(path string) (*sql.DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("❌ Cannot connect to database: %w", err)
 	}
+	return dbConn, nil
+}
 
-	// Load schema.sql file from project (required tables, indices, etc)
-	fmt.Println("📖 Reading schema file: internal/db/schema.sql")
-	schema, err := os.ReadFile("internal/db/schema.sql")
+// InitDB opens or creates an SQLite database at the provided path,
+// applies any pending migrations embedded in the binary, sets up the
+// full-text search index, and returns the database connection and whether
+// full-text search is available (see EnsureSearchIndex).
+// Returns an error if any step fails
+func InitDB(path string) (*sql.DB, bool, error) {
+	dbConn, err := OpenDB(path)
 	if err != nil {
-		return nil, fmt.Errorf("❌ Failed to read schema.sql: %w", err)
+		return nil, false, err
 	}
 
-	// Run SQL schema commands to create tables (if not exists)
-	fmt.Println("🚀 Executing schema...")
-	_, err = dbConn.Exec(string(schema))
+	// Bring the schema up to date (already-applied migrations are skipped)
+	fmt.Println("🚀 Applying migrations...")
+	applied, err := MigrateUp(dbConn)
 	if err != nil {
-		return nil, fmt.Errorf("❌ Failed to execute schema: %w", err)
+		return nil, false, fmt.Errorf("❌ Failed to migrate database: %w", err)
 	}
 
-	fmt.Println("✅ Database initialized successfully.")
-	return dbConn, nil
+	// Full-text search needs FTS5 (build with -tags sqlite_fts5)
+	fts, err := EnsureSearchIndex(dbConn)
+	if err != nil {
+		return nil, false, fmt.Errorf("❌ Failed to set up the search index: %w", err)
+	}
+	if !fts {
+		fmt.Println("⚠️  SQLite was built without FTS5, search falls back to simple matching.")
+	}
+
+	fmt.Printf("✅ Database initialized successfully (%d migration(s) applied).\n", applied)
+	return dbConn, fts, nil
 }
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB returns a migrated database in a temporary directory, closed
+// when the test ends.
+func newTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	dbConn, err := OpenDB(filepath.Join(tb.TempDir(), "forum.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { dbConn.Close() })
+	if _, err := MigrateUp(dbConn); err != nil {
+		tb.Fatal(err)
+	}
+	return dbConn
+}
+
+// addUser creates a member called name and returns their ID.
+func addUser(tb testing.TB, dbConn *sql.DB, name string) int {
+	tb.Helper()
+	var id int
+	err := dbConn.QueryRow(`INSERT INTO users (email, username, password) VALUES (?, ?, 'x') RETURNING id`,
+		name+"@example.com", name).Scan(&id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return id
+}
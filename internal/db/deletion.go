@@ -0,0 +1,161 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Account deletion modes: erase removes the user's posts and blanks their
+// comments; anonymize keeps both, shown under DeletedUsername.
+const (
+	DeleteErase     = "erase"
+	DeleteAnonymize = "anonymize"
+)
+
+// DeletedUserID and DeletedUsername are the placeholder account that
+// content of deleted accounts is kept under (see migration 0019).
+const (
+	DeletedUserID   = -1
+	DeletedUsername = "deleted user"
+)
+
+// ReservedUsername reports whether members may not take name, because it
+// reads as the placeholder's: case, dots, dashes and underscores aside.
+func ReservedUsername(name string) bool {
+	name = strings.NewReplacer("_", " ", ".", " ", "-", " ").Replace(strings.TrimSpace(name))
+	return strings.EqualFold(name, DeletedUsername)
+}
+
+// ScheduleAccountDeletion has the user's account deleted in the given mode
+// once grace has passed, and logs them out everywhere. Scheduling again
+// replaces the earlier request.
+func ScheduleAccountDeletion(db *sql.DB, userID int, mode string, grace time.Duration) error {
+	if mode != DeleteErase && mode != DeleteAnonymize {
+		return errors.New("unknown deletion mode " + mode)
+	}
+	now := time.Now().UTC()
+	return inTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO account_deletions(user_id, mode, requested_at, due_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET mode = excluded.mode, requested_at = excluded.requested_at, due_at = excluded.due_at`,
+			userID, mode, now.Format(timestampLayout), now.Add(grace).Format(timestampLayout))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+		return err
+	})
+}
+
+// AccountDeletion returns the mode and due time of the user's scheduled
+// account deletion. Returns sql.ErrNoRows if none is scheduled.
+func AccountDeletion(db *sql.DB, userID int) (mode string, due time.Time, err error) {
+	err = db.QueryRow(`SELECT mode, due_at FROM account_deletions WHERE user_id = ?`, userID).Scan(&mode, &due)
+	return mode, due, err
+}
+
+// CancelAccountDeletion keeps the user's account after all.
+func CancelAccountDeletion(db *sql.DB, userID int) error {
+	_, err := db.Exec(`DELETE FROM account_deletions WHERE user_id = ?`, userID)
+	return err
+}
+
+// DeleteDueAccounts deletes the accounts whose deletion is due. It returns
+// how many there were, and the images of erased posts (as stored in
+// posts.image) for the caller to remove from disk.
+func DeleteDueAccounts(db *sql.DB) (int, []string, error) {
+	rows, err := db.Query(`SELECT user_id, mode FROM account_deletions WHERE due_at <= ?`,
+		time.Now().UTC().Format(timestampLayout))
+	if err != nil {
+		return 0, nil, err
+	}
+	type due struct {
+		userID int
+		mode   string
+	}
+	var todo []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.userID, &d.mode); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		todo = append(todo, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	var images []string
+	for i, d := range todo {
+		imgs, err := deleteAccount(db, d.userID, d.mode)
+		if err != nil {
+			return i, images, err
+		}
+		images = append(images, imgs...)
+	}
+	return len(todo), images, nil
+}
+
+// deleteAccount removes the user and everything that is theirs alone. Their
+// comments are handed to the placeholder account rather than removed, so
+// that replies to them keep their place; when erasing, they are blanked
+// like removed comments, and the user's posts go with everything under them.
+func deleteAccount(db *sql.DB, userID int, mode string) ([]string, error) {
+	var images []string
+	err := inTx(db, func(tx *sql.Tx) error {
+		var email string
+		if err := tx.QueryRow(`SELECT email FROM users WHERE id = ?`, userID).Scan(&email); err != nil {
+			return err
+		}
+
+		if mode == DeleteErase {
+			rows, err := tx.Query(`SELECT image FROM posts WHERE user_id = ? AND image IS NOT NULL AND image != ''`, userID)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var img string
+				if err := rows.Scan(&img); err != nil {
+					rows.Close()
+					return err
+				}
+				images = append(images, img)
+			}
+			rows.Close()
+			if _, err := tx.Exec(`DELETE FROM posts WHERE user_id = ?`, userID); err != nil {
+				return err
+			}
+			_, err = tx.Exec(`
+				UPDATE comments SET content = '', deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP), deleted_by = ?
+				WHERE user_id = ?`, DeletedUserID, userID)
+			if err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Exec(`UPDATE posts SET user_id = ? WHERE user_id = ?`, DeletedUserID, userID); err != nil {
+				return err
+			}
+		}
+
+		// Comments survive the account; the deleter's own removals are credited to the placeholder
+		if _, err := tx.Exec(`UPDATE comments SET deleted_by = ? WHERE deleted_by = ? AND user_id = ?`, DeletedUserID, userID, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE comments SET user_id = ? WHERE user_id = ?`, DeletedUserID, userID); err != nil {
+			return err
+		}
+		// Failed logins are kept by address rather than by user
+		_, err := tx.Exec(`DELETE FROM login_failures WHERE scope = ? AND subject = ?`, LoginScopeAccount, strings.ToLower(email))
+		if err != nil {
+			return err
+		}
+		// The rest (likes, sessions, reports, ...) goes with the user
+		_, err = tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+		return err
+	})
+	return images, err
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReservedUsername(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"deleted user", true},
+		{"Deleted User", true},
+		{" DELETED USER ", true},
+		{"deleted.user", true},
+		{"Deleted_User", true},
+		{"deleted-user", true},
+		{"deleted user2", false},
+		{"deleteduser", false},
+		{"ann", false},
+	}
+	for _, tt := range tests {
+		if got := ReservedUsername(tt.name); got != tt.want {
+			t.Errorf("ReservedUsername(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A member who took the placeholder's name before it was reserved is
+// renamed, and keeps their content when someone else's account is deleted.
+func TestDeletedUserMigration(t *testing.T) {
+	dbConn := newTestDB(t)
+	migrateTo(t, dbConn, 18) // before 0019
+	if _, err := dbConn.Exec(`DELETE FROM users WHERE id = ?`, DeletedUserID); err != nil {
+		t.Fatal(err)
+	}
+	impostor := addUser(t, dbConn, "Deleted.User")
+	if _, err := MigrateUp(dbConn); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	if err := dbConn.QueryRow(`SELECT username FROM users WHERE id = ?`, impostor).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if ReservedUsername(name) {
+		t.Errorf("member still called %q", name)
+	}
+	if err := dbConn.QueryRow(`SELECT username FROM users WHERE id = ?`, DeletedUserID).Scan(&name); err != nil || name != DeletedUsername {
+		t.Fatalf("placeholder is %q, %v", name, err)
+	}
+
+	// Migrating down and up again keeps the one placeholder
+	migrateTo(t, dbConn, 18)
+	if _, err := MigrateUp(dbConn); err != nil {
+		t.Fatal(err)
+	}
+
+	ann := addUser(t, dbConn, "ann")
+	var category int
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	postID, err := CreatePost(dbConn, ann, category, "Title", "Text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddComment(dbConn, postID, ann, 0, "Comment"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ScheduleAccountDeletion(dbConn, ann, DeleteAnonymize, -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if n, _, err := DeleteDueAccounts(dbConn); err != nil || n != 1 {
+		t.Fatalf("DeleteDueAccounts = %d, %v", n, err)
+	}
+	for _, table := range []string{"posts", "comments"} {
+		var placeholder, other int
+		err := dbConn.QueryRow(`SELECT COUNT(*) FILTER (WHERE user_id = ?), COUNT(*) FILTER (WHERE user_id = ?) FROM `+table,
+			DeletedUserID, impostor).Scan(&placeholder, &other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if placeholder != 1 || other != 0 {
+			t.Errorf("%s: %d under the placeholder and %d under the renamed member, want 1 and 0", table, placeholder, other)
+		}
+	}
+}
+
+func TestDeletedUsernameReserved(t *testing.T) {
+	dbConn := newTestDB(t)
+	ann := addUser(t, dbConn, "ann")
+	for _, name := range []string{"deleted user", "Deleted_User"} {
+		if err := ChangeUsername(dbConn, ann, name); !errors.Is(err, ErrNameTaken) {
+			t.Errorf("ChangeUsername(%q) = %v, want ErrNameTaken", name, err)
+		}
+	}
+	_, name, err := CreateIdentityUser(dbConn, "mock", "sub-1", "Deleted.User", "du@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Deleted.User2" {
+		t.Errorf("CreateIdentityUser named the member %q, want Deleted.User2", name)
+	}
+}
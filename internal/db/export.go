@@ -0,0 +1,225 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserExport is everything the site keeps about a user that they wrote or
+// did themselves, for the personal data export.
+type UserExport struct {
+	Profile      ExportProfile
+	Posts        []ExportPost
+	Comments     []ExportComment
+	PostLikes    []ExportLike
+	CommentLikes []ExportLike
+}
+
+// ExportProfile is the user's account, without the password hash.
+type ExportProfile struct {
+	Username        string           `json:"username"`
+	Email           string           `json:"email"`
+	EmailVerifiedAt *time.Time       `json:"email_verified_at,omitempty"`
+	Role            string           `json:"role"`
+	CreatedAt       time.Time        `json:"created_at"`
+	TwoFactor       bool             `json:"two_factor_enabled"`
+	FormerUsernames []string         `json:"former_usernames"`
+	Identities      []ExportIdentity `json:"sign_in_providers"`
+}
+
+// ExportIdentity is an account at an identity provider the user logs in with.
+type ExportIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"connected_at"`
+}
+
+// ExportPost is one of the user's posts, with its earlier versions.
+type ExportPost struct {
+	ID        int              `json:"id"`
+	Category  string           `json:"category"`
+	Title     string           `json:"title"`
+	Content   string           `json:"content"`
+	Image     string           `json:"image,omitempty"` // path within the export
+	Hashtags  []string         `json:"hashtags"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt *time.Time       `json:"updated_at,omitempty"`
+	Revisions []ExportRevision `json:"revisions"`
+
+	ImageURL string `json:"-"` // as stored in posts.image
+}
+
+// ExportRevision is an earlier version of a post.
+type ExportRevision struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportComment is one of the user's comments.
+type ExportComment struct {
+	ID        int        `json:"id"`
+	PostID    int        `json:"post_id"`
+	ParentID  *int       `json:"parent_comment_id,omitempty"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ExportLike is a like (1) or dislike (-1) the user gave a post or comment.
+type ExportLike struct {
+	PostID    int `json:"post_id"`
+	CommentID int `json:"comment_id,omitempty"`
+	Value     int `json:"value"`
+}
+
+// nullTime turns a nullable time into a pointer for JSON.
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// ExportUser gathers the user's data for the personal data export.
+func ExportUser(db *sql.DB, userID int) (UserExport, error) {
+	var (
+		x        UserExport
+		verified sql.NullTime
+	)
+	p := &x.Profile
+	err := db.QueryRow(`
+		SELECT username, email, email_verified_at, role, created_at,
+		       EXISTS (SELECT 1 FROM user_totp WHERE user_id = users.id AND confirmed_at IS NOT NULL)
+		FROM users WHERE id = ?`, userID).
+		Scan(&p.Username, &p.Email, &verified, &p.Role, &p.CreatedAt, &p.TwoFactor)
+	if err != nil {
+		return x, err
+	}
+	p.EmailVerifiedAt = nullTime(verified)
+	p.FormerUsernames = []string{}
+	err = queryRows(db, `SELECT old_username FROM username_redirects WHERE user_id = ? ORDER BY created_at`,
+		[]any{userID}, func(rows *sql.Rows) error {
+			var name string
+			err := rows.Scan(&name)
+			p.FormerUsernames = append(p.FormerUsernames, name)
+			return err
+		})
+	if err != nil {
+		return x, err
+	}
+	p.Identities = []ExportIdentity{}
+	err = queryRows(db, `SELECT provider, subject, email, created_at FROM user_identities WHERE user_id = ? ORDER BY provider`,
+		[]any{userID}, func(rows *sql.Rows) error {
+			var id ExportIdentity
+			err := rows.Scan(&id.Provider, &id.Subject, &id.Email, &id.CreatedAt)
+			p.Identities = append(p.Identities, id)
+			return err
+		})
+	if err != nil {
+		return x, err
+	}
+
+	// Posts, each with its hashtags and earlier versions
+	err = queryRows(db, `
+		SELECT p.id, COALESCE(c.name, ''), p.title, p.content, COALESCE(p.image, ''), p.created_at, p.updated_at
+		FROM posts p LEFT JOIN categories c ON c.id = p.category_id
+		WHERE p.user_id = ? ORDER BY p.id`, []any{userID}, func(rows *sql.Rows) error {
+		var (
+			post    ExportPost
+			updated sql.NullTime
+		)
+		err := rows.Scan(&post.ID, &post.Category, &post.Title, &post.Content, &post.ImageURL, &post.CreatedAt, &updated)
+		post.UpdatedAt = nullTime(updated)
+		post.Hashtags, post.Revisions = []string{}, []ExportRevision{}
+		x.Posts = append(x.Posts, post)
+		return err
+	})
+	if err != nil {
+		return x, err
+	}
+	for i := range x.Posts {
+		post := &x.Posts[i]
+		err := queryRows(db, `
+			SELECT h.name FROM post_hashtags ph JOIN hashtags h ON h.id = ph.hashtag_id
+			WHERE ph.post_id = ? ORDER BY h.name`, []any{post.ID}, func(rows *sql.Rows) error {
+			var tag string
+			err := rows.Scan(&tag)
+			post.Hashtags = append(post.Hashtags, tag)
+			return err
+		})
+		if err != nil {
+			return x, err
+		}
+		err = queryRows(db, `SELECT title, content, created_at FROM post_revisions WHERE post_id = ? ORDER BY id`,
+			[]any{post.ID}, func(rows *sql.Rows) error {
+				var rev ExportRevision
+				err := rows.Scan(&rev.Title, &rev.Content, &rev.CreatedAt)
+				post.Revisions = append(post.Revisions, rev)
+				return err
+			})
+		if err != nil {
+			return x, err
+		}
+	}
+
+	// Comments, including removed ones
+	err = queryRows(db, `
+		SELECT id, post_id, parent_comment_id, content, created_at, updated_at, deleted_at
+		FROM comments WHERE user_id = ? ORDER BY id`, []any{userID}, func(rows *sql.Rows) error {
+		var (
+			c                ExportComment
+			parent           sql.NullInt64
+			updated, deleted sql.NullTime
+		)
+		err := rows.Scan(&c.ID, &c.PostID, &parent, &c.Content, &c.CreatedAt, &updated, &deleted)
+		if parent.Valid {
+			id := int(parent.Int64)
+			c.ParentID = &id
+		}
+		c.UpdatedAt, c.DeletedAt = nullTime(updated), nullTime(deleted)
+		x.Comments = append(x.Comments, c)
+		return err
+	})
+	if err != nil {
+		return x, err
+	}
+
+	// Likes and dislikes
+	err = queryRows(db, `SELECT post_id, value FROM post_likes WHERE user_id = ? ORDER BY id`,
+		[]any{userID}, func(rows *sql.Rows) error {
+			var l ExportLike
+			err := rows.Scan(&l.PostID, &l.Value)
+			x.PostLikes = append(x.PostLikes, l)
+			return err
+		})
+	if err != nil {
+		return x, err
+	}
+	err = queryRows(db, `
+		SELECT c.post_id, cl.comment_id, cl.value FROM comment_likes cl JOIN comments c ON c.id = cl.comment_id
+		WHERE cl.user_id = ? ORDER BY cl.id`, []any{userID}, func(rows *sql.Rows) error {
+		var l ExportLike
+		err := rows.Scan(&l.PostID, &l.CommentID, &l.Value)
+		x.CommentLikes = append(x.CommentLikes, l)
+		return err
+	})
+	return x, err
+}
+
+// queryRows runs query and calls scan for each row.
+func queryRows(db *sql.DB, query string, args []any, scan func(*sql.Rows) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
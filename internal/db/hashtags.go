@@ -0,0 +1,141 @@
+package db
+
+import (
+	"database/sql"
+	"literary-lions/internal/models"
+	"strings"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// SetPostHashtags replaces the hashtags linked to a post with the given
+// (already normalised) names, creating hashtag rows as needed.
+func SetPostHashtags(ex execer, postID int, tags []string) error {
+	if _, err := ex.Exec(`DELETE FROM post_hashtags WHERE post_id = ?`, postID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := ex.Exec(`INSERT OR IGNORE INTO hashtags(name) VALUES (?)`, tag); err != nil {
+			return err
+		}
+		_, err := ex.Exec(`
+			INSERT OR IGNORE INTO post_hashtags(post_id, hashtag_id)
+			SELECT ?, id FROM hashtags WHERE name = ?`, postID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchPostHashtags returns the hashtag names of one post, alphabetically.
+func FetchPostHashtags(db *sql.DB, postID int) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT h.name
+		FROM post_hashtags ph
+		JOIN hashtags h ON h.id = ph.hashtag_id
+		WHERE ph.post_id = ?
+		ORDER BY h.name`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
+
+// AttachHashtags fills in the Tags field of every post in the slice
+// with a single query.
+func AttachHashtags(db *sql.DB, posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(posts))
+	args := make([]any, 0, len(posts))
+	for i, p := range posts {
+		index[p.ID] = i
+		args = append(args, p.ID)
+	}
+
+	rows, err := db.Query(`
+		SELECT ph.post_id, h.name
+		FROM post_hashtags ph
+		JOIN hashtags h ON h.id = ph.hashtag_id
+		WHERE ph.post_id IN (`+placeholders(len(args))+`)
+		ORDER BY h.name`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			postID int
+			name   string
+		)
+		if err := rows.Scan(&postID, &name); err != nil {
+			return err
+		}
+		i := index[postID]
+		posts[i].Tags = append(posts[i].Tags, name)
+	}
+	return rows.Err()
+}
+
+// FetchTagCloud returns the most used hashtags (up to limit), alphabetically,
+// each with a Weight from 1 (rarely used) to 5 (most used) for sizing.
+func FetchTagCloud(db *sql.DB, limit int) ([]models.Tag, error) {
+	rows, err := db.Query(`
+		SELECT name, uses FROM (
+			SELECT h.name, COUNT(*) AS uses
+			FROM hashtags h
+			JOIN post_hashtags ph ON ph.hashtag_id = h.id
+			GROUP BY h.id
+			ORDER BY uses DESC, h.name
+			LIMIT ?
+		) ORDER BY name`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	maxUses := 0
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.Name, &t.Count); err != nil {
+			return nil, err
+		}
+		maxUses = max(maxUses, t.Count)
+		tags = append(tags, t)
+	}
+	for i := range tags {
+		tags[i].Weight = 1 + 4*tags[i].Count/maxUses
+	}
+	return tags, rows.Err()
+}
+
+// FetchPostsByHashtag returns one page of the posts tagged with name,
+// newest first, with like and comment counts and the viewer's own like value.
+func FetchPostsByHashtag(db *sql.DB, name string, viewerID int, opts PageOpts) (PostPage, error) {
+	return listPosts(db, viewerID, []string{hashtagCond}, []any{name}, opts)
+}
+
+// placeholders returns "?, ?, ?" with n question marks.
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
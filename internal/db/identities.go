@@ -0,0 +1,201 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"literary-lions/internal/models"
+)
+
+// NoPassword is the password hash of accounts that cannot log in with a
+// password: the deleted user placeholder, and members who signed up through
+// an identity provider and have not set one.
+const NoPassword = "!"
+
+var (
+	// ErrIdentityTaken is returned when a provider account is already
+	// connected to another member.
+	ErrIdentityTaken = errors.New("identity linked to another user")
+	// ErrProviderLinked is returned when a member already has another
+	// account at the same provider connected.
+	ErrProviderLinked = errors.New("provider already linked")
+	// ErrLastLogin is returned when disconnecting a provider would leave a
+	// member without a way to log in.
+	ErrLastLogin = errors.New("last way to log in")
+)
+
+// CreateOIDCLogin records a login on its way through provider, with the
+// nonce and PKCE verifier it has to come back with, for ttl. linkUserID is
+// the member connecting the provider, or 0 when logging in. It returns the
+// state parameter that identifies the login (only its hash is kept).
+func CreateOIDCLogin(db *sql.DB, provider, nonce, verifier string, linkUserID int, ttl time.Duration) (string, error) {
+	state, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	var link any
+	if linkUserID != 0 {
+		link = linkUserID
+	}
+	now := time.Now().UTC()
+	err = inTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM oidc_logins WHERE expires_at <= ?`, now.Format(timestampLayout)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO oidc_logins(state_hash, provider, nonce, verifier, link_user_id, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			hash, provider, nonce, verifier, link, now.Add(ttl).Format(timestampLayout))
+		return err
+	})
+	return state, err
+}
+
+// TakeOIDCLogin looks up and uses up the login with state. Returns
+// sql.ErrNoRows if it is unknown, used or expired.
+func TakeOIDCLogin(db *sql.DB, state string) (provider, nonce, verifier string, linkUserID int, err error) {
+	var link sql.NullInt64
+	err = db.QueryRow(`
+		DELETE FROM oidc_logins WHERE state_hash = ? AND expires_at > ?
+		RETURNING provider, nonce, verifier, link_user_id`,
+		hashToken(state), time.Now().UTC().Format(timestampLayout)).Scan(&provider, &nonce, &verifier, &link)
+	return provider, nonce, verifier, int(link.Int64), err
+}
+
+// IdentityLogin returns the member the provider account subject is
+// connected to, and notes the login and the address the provider gave.
+// Returns sql.ErrNoRows if the account is not connected to anyone.
+func IdentityLogin(db *sql.DB, provider, subject, email string) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		UPDATE user_identities SET last_login_at = ?, email = ?
+		WHERE provider = ? AND subject = ?
+		RETURNING user_id`,
+		time.Now().UTC().Format(timestampLayout), email, provider, subject).Scan(&userID)
+	return userID, err
+}
+
+// LinkIdentity connects the provider account subject to the member.
+// Returns ErrIdentityTaken if it is connected to someone else, and
+// ErrProviderLinked if the member has another account there connected.
+func LinkIdentity(db *sql.DB, userID int, provider, subject, email string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		var owner int
+		err := tx.QueryRow(`SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?`,
+			provider, subject).Scan(&owner)
+		switch {
+		case err == nil && owner == userID:
+			return nil
+		case err == nil:
+			return ErrIdentityTaken
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		var linked bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = ? AND provider = ?)`,
+			userID, provider).Scan(&linked)
+		if err != nil {
+			return err
+		}
+		if linked {
+			return ErrProviderLinked
+		}
+		_, err = tx.Exec(`INSERT INTO user_identities(provider, subject, user_id, email) VALUES (?, ?, ?, ?)`,
+			provider, subject, userID, email)
+		return err
+	})
+}
+
+// UnlinkIdentity disconnects the member's account at provider. Returns
+// ErrLastLogin if they have no password and no other provider to log in
+// with, and sql.ErrNoRows if nothing was connected.
+func UnlinkIdentity(db *sql.DB, userID int, provider string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		var (
+			hash   string
+			others int
+		)
+		err := tx.QueryRow(`
+			SELECT password, (SELECT COUNT(*) FROM user_identities WHERE user_id = users.id AND provider != ?)
+			FROM users WHERE id = ?`, provider, userID).Scan(&hash, &others)
+		if err != nil {
+			return err
+		}
+		if hash == NoPassword && others == 0 {
+			return ErrLastLogin
+		}
+		res, err := tx.Exec(`DELETE FROM user_identities WHERE user_id = ? AND provider = ?`, userID, provider)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// UserIdentities lists the provider accounts connected to the member.
+func UserIdentities(db *sql.DB, userID int) ([]models.Identity, error) {
+	var ids []models.Identity
+	err := queryRows(db, `
+		SELECT provider, email, created_at, last_login_at FROM user_identities
+		WHERE user_id = ? ORDER BY provider`, []any{userID}, func(rows *sql.Rows) error {
+		var (
+			id   models.Identity
+			last sql.NullTime
+		)
+		err := rows.Scan(&id.Provider, &id.Email, &id.CreatedAt, &last)
+		id.LastLoginAt = nullTime(last)
+		ids = append(ids, id)
+		return err
+	})
+	return ids, err
+}
+
+// CreateIdentityUser signs up a member through a provider: the account has
+// no password, the given email address (confirmed if the provider says so)
+// and username, or if that is taken or reserved the first of username2, username3, ...
+// that is free. It returns the new member's ID and name.
+func CreateIdentityUser(db *sql.DB, provider, subject, username, email string, emailVerified bool) (int, string, error) {
+	var (
+		userID int
+		name   string
+	)
+	var verifiedAt any
+	if emailVerified {
+		verifiedAt = time.Now().UTC().Format(timestampLayout)
+	}
+	err := inTx(db, func(tx *sql.Tx) error {
+		for n := 1; ; n++ {
+			name = username
+			if n > 1 {
+				suffix := fmt.Sprint(n)
+				name = username[:min(len(username), 30-len(suffix))] + suffix
+			}
+			var taken bool
+			err := tx.QueryRow(`
+				SELECT EXISTS (SELECT 1 FROM users WHERE username = ?)
+				    OR EXISTS (SELECT 1 FROM username_redirects WHERE old_username = ?)`, name, name).Scan(&taken)
+			if err != nil {
+				return err
+			}
+			if !taken && !ReservedUsername(name) {
+				break
+			}
+		}
+		err := tx.QueryRow(`
+			INSERT INTO users(username, email, password, email_verified_at) VALUES (?, ?, ?, ?)
+			RETURNING id`, name, email, NoPassword, verifiedAt).Scan(&userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO user_identities(provider, subject, user_id, email, last_login_at) VALUES (?, ?, ?, ?, ?)`,
+			provider, subject, userID, email, time.Now().UTC().Format(timestampLayout))
+		return err
+	})
+	return userID, name, err
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Scopes of recorded login failures: per client IP address and per account
+// (the email address that was tried, whether or not it exists).
+const (
+	LoginScopeIP      = "ip"
+	LoginScopeAccount = "account"
+)
+
+// LoginLimits are the thresholds of the login rate limiter. Failures are
+// counted over a sliding window as long as Lockout: the first FreeFailures
+// cost nothing, each one after that makes the next attempt wait twice as
+// long as the last (from BaseDelay up to MaxDelay), and at MaxFailures no
+// attempt is allowed until Lockout has passed since the last failure.
+type LoginLimits struct {
+	FreeFailures int
+	MaxFailures  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Lockout      time.Duration
+}
+
+// LoginRetryAt returns when the next login attempt for subject may be made,
+// given the failures recorded for it within the last l.Lockout. The time is
+// zero or in the past if an attempt may be made now; locked reports whether
+// the subject has reached l.MaxFailures.
+func LoginRetryAt(db *sql.DB, scope, subject string, l LoginLimits) (retryAt time.Time, locked bool, err error) {
+	var (
+		n    int
+		last sql.NullString
+	)
+	since := time.Now().Add(-l.Lockout).UTC().Format(timestampLayout)
+	err = db.QueryRow(`
+		SELECT COUNT(*), MAX(created_at) FROM login_failures
+		WHERE scope = ? AND subject = ? AND created_at > ?`,
+		scope, subject, since).Scan(&n, &last)
+	if err != nil || n < l.FreeFailures || !last.Valid {
+		return time.Time{}, false, err
+	}
+	lastAt, err := time.Parse(timestampLayout, last.String)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if n >= l.MaxFailures {
+		return lastAt.Add(l.Lockout), true, nil
+	}
+	delay := l.BaseDelay
+	for i := l.FreeFailures; i < n && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+	return lastAt.Add(min(delay, l.MaxDelay)), false, nil
+}
+
+// RecordLoginFailure records a failed login for subject, and forgets
+// failures older than keep.
+func RecordLoginFailure(db *sql.DB, scope, subject string, keep time.Duration) error {
+	now := time.Now().UTC()
+	return inTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM login_failures WHERE created_at <= ?`,
+			now.Add(-keep).Format(timestampLayout))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO login_failures(scope, subject, created_at) VALUES (?, ?, ?)`,
+			scope, subject, now.Format(timestampLayout))
+		return err
+	})
+}
+
+// ClearLoginFailures forgets the failures recorded for subject, after a
+// successful login.
+func ClearLoginFailures(db *sql.DB, scope, subject string) error {
+	_, err := db.Exec(`DELETE FROM login_failures WHERE scope = ? AND subject = ?`, scope, subject)
+	return err
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginRetryAt(t *testing.T) {
+	limits := LoginLimits{FreeFailures: 3, MaxFailures: 10, BaseDelay: time.Second, MaxDelay: 8 * time.Second, Lockout: 15 * time.Minute}
+	last := time.Now().UTC().Truncate(time.Second).Add(-10 * time.Second)
+	tests := []struct {
+		failures int
+		age      time.Duration // of the failures before the last one
+		wait     time.Duration // retryAt - last, 0 for none
+		locked   bool
+	}{
+		{0, 0, 0, false},
+		{2, time.Second, 0, false},
+		{3, time.Second, time.Second, false},
+		{4, time.Second, 2 * time.Second, false},
+		{5, time.Second, 4 * time.Second, false},
+		{6, time.Second, 8 * time.Second, false},
+		{9, time.Second, 8 * time.Second, false}, // capped at MaxDelay
+		{10, time.Second, 15 * time.Minute, true},
+		// Only failures within the lockout window count
+		{10, 16 * time.Minute, 0, false},
+		{10, 14 * time.Minute, 15 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		dbConn := newTestDB(t)
+		for i := 0; i < tt.failures; i++ {
+			at := last
+			if i < tt.failures-1 {
+				at = last.Add(-tt.age)
+			}
+			_, err := dbConn.Exec(`INSERT INTO login_failures(scope, subject, created_at) VALUES (?, ?, ?)`,
+				LoginScopeAccount, "a@example.com", at.Format(timestampLayout))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Another subject's failures don't count
+		if err := RecordLoginFailure(dbConn, LoginScopeAccount, "b@example.com", limits.Lockout); err != nil {
+			t.Fatal(err)
+		}
+
+		retryAt, locked, err := LoginRetryAt(dbConn, LoginScopeAccount, "a@example.com", limits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want time.Time
+		if tt.wait != 0 {
+			want = last.Add(tt.wait)
+		}
+		if !retryAt.Equal(want) || locked != tt.locked {
+			t.Errorf("%d failures (%v old): retry at %v (locked %v), want %v (locked %v)",
+				tt.failures, tt.age, retryAt, locked, want, tt.locked)
+		}
+	}
+}
+
+func TestClearLoginFailures(t *testing.T) {
+	dbConn := newTestDB(t)
+	limits := LoginLimits{FreeFailures: 1, MaxFailures: 2, BaseDelay: time.Minute, MaxDelay: time.Minute, Lockout: time.Hour}
+	for i := 0; i < 2; i++ {
+		if err := RecordLoginFailure(dbConn, LoginScopeIP, "192.0.2.1", limits.Lockout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, locked, err := LoginRetryAt(dbConn, LoginScopeIP, "192.0.2.1", limits); err != nil || !locked {
+		t.Fatalf("after 2 failures: locked = %v, %v", locked, err)
+	}
+	if err := ClearLoginFailures(dbConn, LoginScopeIP, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if retryAt, _, err := LoginRetryAt(dbConn, LoginScopeIP, "192.0.2.1", limits); err != nil || !retryAt.IsZero() {
+		t.Errorf("after clearing: retry at %v, %v", retryAt, err)
+	}
+}
@@ -0,0 +1,289 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds every numbered migration shipped with the binary.
+// Files are named NNNN_description.up.sql / NNNN_description.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is a single numbered schema change with its up and down SQL.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState describes whether a known migration has been applied.
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads the embedded migration files and returns them
+// sorted by version. Every version must have both an up and a down file.
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		file := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %q", file)
+		}
+
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		num, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %q has no name", file)
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %q has a bad version: %w", file, err)
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var list []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s is missing its up or down file", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// ensureMigrationsTable creates the bookkeeping table that records
+// which migrations have been applied.
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	return err
+}
+
+// appliedMigrations returns the applied_at time of every applied version.
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version int
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every known migration and whether it has been applied.
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		states = append(states, MigrationState{Migration: m, Applied: ok, AppliedAt: at})
+	}
+	return states, nil
+}
+
+// MigrateUp applies every pending migration in version order, each in its
+// own transaction. It returns the number of migrations applied.
+func MigrateUp(db *sql.DB) (int, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, s := range states {
+		if s.Applied {
+			continue
+		}
+		err := runMigration(db, s.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`INSERT INTO schema_migrations(version, name) VALUES (?, ?)`, s.Version, s.Name)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s failed: %w", s.Version, s.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown rolls back the most recently applied migrations, newest
+// first, each in its own transaction. It returns the number rolled back.
+func MigrateDown(db *sql.DB, steps int) (int, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(states) - 1; i >= 0 && count < steps; i-- {
+		s := states[i]
+		if !s.Applied {
+			continue
+		}
+		err := runMigration(db, s.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, s.Version)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("rollback of %04d_%s failed: %w", s.Version, s.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// foreignKeysOff starts the SQL of migrations that rebuild a table other
+// tables refer to. Dropping the old table with foreign keys on would
+// cascade its deletes, and SQLite cannot turn them off inside a
+// transaction, so such a migration runs on one connection with foreign keys
+// off, and is checked with PRAGMA foreign_key_check before it commits.
+const foreignKeysOff = "-- migrate: foreign keys off"
+
+// runMigration runs the SQL of one migration step, then record, in a
+// transaction.
+func runMigration(db *sql.DB, query string, record func(tx *sql.Tx) error) error {
+	step := func(tx *sql.Tx) error {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+		return record(tx)
+	}
+	if !strings.HasPrefix(query, foreignKeysOff) {
+		return inTx(db, step)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err == nil {
+		err = step(tx)
+		if err == nil {
+			err = checkForeignKeys(tx)
+		}
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}
+	// The connection goes back to the pool, so foreign keys go back on,
+	// or the connection is thrown away
+	if _, onErr := conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`); onErr != nil {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		if err == nil {
+			err = onErr
+		}
+	}
+	return err
+}
+
+// checkForeignKeys returns an error if any row refers to one that does not
+// exist.
+func checkForeignKeys(tx *sql.Tx) error {
+	var (
+		table, parent string
+		rowID         sql.NullInt64
+		fk            int
+	)
+	err := tx.QueryRow(`PRAGMA foreign_key_check`).Scan(&table, &rowID, &parent, &fk)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("row %d of %s refers to a missing row of %s", rowID.Int64, table, parent)
+}
+
+// inTx runs fn inside a transaction, committing on success and rolling
+// back if fn returns an error.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// schemaVersion is the newest migration applied to dbConn, or 0.
+func schemaVersion(tb testing.TB, dbConn *sql.DB) int {
+	tb.Helper()
+	var v int
+	if err := dbConn.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v); err != nil {
+		tb.Fatal(err)
+	}
+	return v
+}
+
+// schema lists every table, index and trigger definition in dbConn.
+func schema(tb testing.TB, dbConn *sql.DB) []string {
+	tb.Helper()
+	rows, err := dbConn.Query(`SELECT type || ' ' || name || ': ' || COALESCE(sql, '') FROM sqlite_master ORDER BY type, name`)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rows.Close()
+	var defs []string
+	for rows.Next() {
+		var def string
+		if err := rows.Scan(&def); err != nil {
+			tb.Fatal(err)
+		}
+		defs = append(defs, def)
+	}
+	if err := rows.Err(); err != nil {
+		tb.Fatal(err)
+	}
+	return defs
+}
+
+// A fresh database migrates all the way up, all the way down and up again,
+// ending with the same schema.
+func TestMigrateUpDownUp(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+	dbConn, err := OpenDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbConn.Close() })
+
+	if n, err := MigrateUp(dbConn); err != nil || n != len(migrations) {
+		t.Fatalf("first MigrateUp = %d, %v; want %d", n, err, len(migrations))
+	}
+	if v := schemaVersion(t, dbConn); v != latest {
+		t.Fatalf("after migrating up: version %d, want %d", v, latest)
+	}
+	up := schema(t, dbConn)
+	if n, err := MigrateUp(dbConn); err != nil || n != 0 {
+		t.Errorf("MigrateUp when up to date = %d, %v", n, err)
+	}
+
+	if n, err := MigrateDown(dbConn, len(migrations)); err != nil || n != len(migrations) {
+		t.Fatalf("MigrateDown = %d, %v; want %d", n, err, len(migrations))
+	}
+	if v := schemaVersion(t, dbConn); v != 0 {
+		t.Errorf("after migrating down: version %d, want 0", v)
+	}
+	for _, def := range schema(t, dbConn) {
+		if !strings.HasPrefix(def, "table schema_migrations:") && !strings.HasPrefix(def, "table sqlite_sequence:") {
+			t.Errorf("left after migrating down: %s", def)
+		}
+	}
+
+	if n, err := MigrateUp(dbConn); err != nil || n != len(migrations) {
+		t.Fatalf("second MigrateUp = %d, %v; want %d", n, err, len(migrations))
+	}
+	if v := schemaVersion(t, dbConn); v != latest {
+		t.Errorf("after migrating up again: version %d, want %d", v, latest)
+	}
+	if again := schema(t, dbConn); !slices.Equal(again, up) {
+		t.Errorf("the schema differs the second time up:\n%s\nwant\n%s", strings.Join(again, "\n"), strings.Join(up, "\n"))
+	}
+}
+
+// 0021 rebuilds users with foreign keys off: nothing that refers to a
+// member is lost, and foreign keys are back on afterwards.
+func TestEmailNoCaseMigration(t *testing.T) {
+	dbConn := newTestDB(t)
+	// One connection, so the checks below see the one the migrations used
+	dbConn.SetMaxOpenConns(1)
+	migrateTo(t, dbConn, 20)
+
+	ann := addUser(t, dbConn, "ann")
+	gone := addUser(t, dbConn, "gone")
+	if _, err := dbConn.Exec(`UPDATE users SET email = 'Ann@Example.com' WHERE id = ?`, ann); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateSession(dbConn, ann, "csrf", "test", "192.0.2.1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var category int
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreatePost(dbConn, ann, category, "Title", "Text", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbConn.Exec(`DELETE FROM users WHERE id = ?`, gone); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateUp(dbConn); err != nil {
+		t.Fatal(err)
+	}
+	var sessions, posts int
+	dbConn.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = ?`, ann).Scan(&sessions)
+	dbConn.QueryRow(`SELECT COUNT(*) FROM posts WHERE user_id = ?`, ann).Scan(&posts)
+	if sessions != 1 || posts != 1 {
+		t.Fatalf("after the rebuild ann has %d sessions and %d posts", sessions, posts)
+	}
+	var found int
+	if err := dbConn.QueryRow(`SELECT id FROM users WHERE email = ?`, "ann@example.COM").Scan(&found); err != nil || found != ann {
+		t.Errorf("looking up the address in another case: %d, %v", found, err)
+	}
+	if _, err := dbConn.Exec(`INSERT INTO users (email, username, password) VALUES ('ANN@example.com', 'ann2', 'x')`); err == nil {
+		t.Error("a second account got the address in another case")
+	}
+	if next := addUser(t, dbConn, "next"); next <= gone {
+		t.Errorf("new member got ID %d, a deleted member had %d", next, gone)
+	}
+
+	var fks int
+	dbConn.QueryRow(`PRAGMA foreign_keys`).Scan(&fks)
+	if fks != 1 {
+		t.Fatal("foreign keys are off after the migration")
+	}
+	if _, err := dbConn.Exec(`DELETE FROM users WHERE id = ?`, ann); err != nil {
+		t.Fatal(err)
+	}
+	dbConn.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = ?`, ann).Scan(&sessions)
+	if sessions != 0 {
+		t.Error("deleting a member no longer deletes their sessions")
+	}
+}
+
+// Addresses that differ only in case stop the migration, which changes
+// nothing.
+func TestEmailNoCaseMigrationConflict(t *testing.T) {
+	dbConn := newTestDB(t)
+	migrateTo(t, dbConn, 20)
+	addUser(t, dbConn, "bob")
+	if _, err := dbConn.Exec(`INSERT INTO users (email, username, password) VALUES ('BOB@example.com', 'bob2', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateUp(dbConn); err == nil {
+		t.Fatal("MigrateUp went through")
+	}
+	var users, version int
+	dbConn.QueryRow(`SELECT COUNT(*) FROM users WHERE email LIKE 'bob@example.com'`).Scan(&users)
+	dbConn.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if users != 2 || version != 20 {
+		t.Errorf("%d accounts left at version %d", users, version)
+	}
+}
+
+// tableExists reports whether dbConn has a table of that name.
+func tableExists(tb testing.TB, dbConn *sql.DB, name string) bool {
+	tb.Helper()
+	var n int
+	if err := dbConn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n); err != nil {
+		tb.Fatal(err)
+	}
+	return n > 0
+}
+
+// Bans only ever lived in 0011's user_sanctions, which comes and goes with it.
+func TestSanctionsMigration(t *testing.T) {
+	dbConn := newTestDB(t)
+	migrateTo(t, dbConn, 11)
+	for version := 11; version >= 8; version-- {
+		if version < 11 {
+			if _, err := MigrateDown(dbConn, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tableExists(t, dbConn, "user_bans") {
+			t.Errorf("version %d has user_bans", version)
+		}
+		if got, want := tableExists(t, dbConn, "user_sanctions"), version >= 11; got != want {
+			t.Errorf("version %d: user_sanctions exists = %v, want %v", version, got, want)
+		}
+	}
+	if _, err := MigrateUp(dbConn); err != nil {
+		t.Fatal(err)
+	}
+	if !tableExists(t, dbConn, "user_sanctions") || tableExists(t, dbConn, "user_bans") {
+		t.Error("migrating up again did not bring back user_sanctions alone")
+	}
+}
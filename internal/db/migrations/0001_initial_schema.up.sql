@@ -1,5 +1,3 @@
-PRAGMA foreign_keys = ON;
-
 -- USERS
 CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -81,4 +79,4 @@ CREATE TABLE IF NOT EXISTS comment_likes (
     UNIQUE(user_id, comment_id),
     FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE,
     FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
@@ -0,0 +1,14 @@
+-- Last time the post's title or content changed (NULL = never edited)
+ALTER TABLE posts ADD COLUMN updated_at DATETIME;
+
+-- POST REVISIONS: every prior version of a post, oldest first by id
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME NOT NULL, -- when this version was originally written
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post ON post_revisions(post_id, id);
@@ -0,0 +1,5 @@
+-- Before this migration deleting a comment removed the row
+DELETE FROM comments WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE comments DROP COLUMN deleted_at;
+ALTER TABLE comments DROP COLUMN updated_at;
@@ -0,0 +1,6 @@
+-- Last time the author edited the comment (NULL = never edited)
+ALTER TABLE comments ADD COLUMN updated_at DATETIME;
+
+-- Soft deletion: the row, its likes and its place in the thread are kept,
+-- readers see a tombstone and moderators can still read the original text
+ALTER TABLE comments ADD COLUMN deleted_at DATETIME;
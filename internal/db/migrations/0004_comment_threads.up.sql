@@ -0,0 +1,6 @@
+-- Threaded replies: NULL for top-level comments, otherwise the comment being
+-- replied to (always on the same post). Comments are never hard-deleted on
+-- their own, so no FK is declared; replies go away with their post.
+ALTER TABLE comments ADD COLUMN parent_comment_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_comment_id);
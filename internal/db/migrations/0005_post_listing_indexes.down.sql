@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_user_created;
+DROP INDEX IF EXISTS idx_posts_category_created;
+DROP INDEX IF EXISTS idx_posts_created;
@@ -0,0 +1,5 @@
+-- Listings page through posts newest first with a (created_at, id) cursor;
+-- these indexes let every listing seek straight to the cursor position.
+CREATE INDEX IF NOT EXISTS idx_posts_created ON posts(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_posts_category_created ON posts(category_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_posts_user_created ON posts(user_id, created_at, id);
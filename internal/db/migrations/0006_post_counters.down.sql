@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS comments_count_delete;
+DROP TRIGGER IF EXISTS comments_count_insert;
+DROP TRIGGER IF EXISTS post_likes_count_delete;
+DROP TRIGGER IF EXISTS post_likes_count_update;
+DROP TRIGGER IF EXISTS post_likes_count_insert;
+
+DROP INDEX IF EXISTS idx_comment_likes_comment;
+DROP INDEX IF EXISTS idx_comments_post;
+
+ALTER TABLE posts DROP COLUMN comment_count;
+ALTER TABLE posts DROP COLUMN dislike_count;
+ALTER TABLE posts DROP COLUMN like_count;
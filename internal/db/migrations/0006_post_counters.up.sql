@@ -0,0 +1,50 @@
+-- Denormalized reaction and comment counts, so listings don't have to count
+-- post_likes and comments rows for every post they show. The triggers below
+-- keep them in sync; comment_count includes removed (tombstoned) comments,
+-- as they still take their place in the thread.
+ALTER TABLE posts ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN dislike_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;
+
+-- The post page lists comments by post and counts comment reactions
+CREATE INDEX IF NOT EXISTS idx_comments_post ON comments(post_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comment_likes_comment ON comment_likes(comment_id, value);
+
+UPDATE posts SET
+    like_count    = (SELECT COUNT(*) FROM post_likes WHERE post_id = posts.id AND value = 1),
+    dislike_count = (SELECT COUNT(*) FROM post_likes WHERE post_id = posts.id AND value = -1),
+    comment_count = (SELECT COUNT(*) FROM comments WHERE post_id = posts.id);
+
+CREATE TRIGGER IF NOT EXISTS post_likes_count_insert AFTER INSERT ON post_likes
+BEGIN
+    UPDATE posts SET
+        like_count    = like_count + (NEW.value = 1),
+        dislike_count = dislike_count + (NEW.value = -1)
+    WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_likes_count_update AFTER UPDATE OF value ON post_likes
+BEGIN
+    UPDATE posts SET
+        like_count    = like_count - (OLD.value = 1) + (NEW.value = 1),
+        dislike_count = dislike_count - (OLD.value = -1) + (NEW.value = -1)
+    WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_likes_count_delete AFTER DELETE ON post_likes
+BEGIN
+    UPDATE posts SET
+        like_count    = like_count - (OLD.value = 1),
+        dislike_count = dislike_count - (OLD.value = -1)
+    WHERE id = OLD.post_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS comments_count_insert AFTER INSERT ON comments
+BEGIN
+    UPDATE posts SET comment_count = comment_count + 1 WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS comments_count_delete AFTER DELETE ON comments
+BEGIN
+    UPDATE posts SET comment_count = comment_count - 1 WHERE id = OLD.post_id;
+END;
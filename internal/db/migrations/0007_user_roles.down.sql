@@ -0,0 +1,4 @@
+ALTER TABLE comments DROP COLUMN deleted_by;
+ALTER TABLE posts DROP COLUMN locked_at;
+DROP TABLE IF EXISTS moderator_categories;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,19 @@
+-- Roles: members write and react; moderators also delete and lock content in
+-- the categories assigned to them; admins moderate everything and manage roles.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member'
+    CHECK (role IN ('member', 'moderator', 'admin'));
+
+CREATE TABLE IF NOT EXISTS moderator_categories (
+    user_id INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    PRIMARY KEY(user_id, category_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- A locked post takes no new comments or replies (NULL = open)
+ALTER TABLE posts ADD COLUMN locked_at DATETIME;
+
+-- Who removed a comment: its author, or a moderator (NULL for comments
+-- removed before this was recorded, which were all removed by their authors)
+ALTER TABLE comments ADD COLUMN deleted_by INTEGER;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_categories_position;
+ALTER TABLE categories DROP COLUMN merged_into_id;
+ALTER TABLE categories DROP COLUMN archived_at;
+ALTER TABLE categories DROP COLUMN position;
+ALTER TABLE categories DROP COLUMN description;
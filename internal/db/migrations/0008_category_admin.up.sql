@@ -0,0 +1,16 @@
+-- Categories are managed from /admin/categories: they get a description and
+-- an explicit sidebar position, can be archived (hidden from the sidebar and
+-- closed to new posts, but still readable) and merged into another category.
+ALTER TABLE categories ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE categories ADD COLUMN archived_at DATETIME;
+-- The category this one was merged into; /category/{id} redirects there.
+-- (No REFERENCES clause, so that the down migration can drop the column.)
+ALTER TABLE categories ADD COLUMN merged_into_id INTEGER;
+
+-- Keep the current alphabetical order as the starting position
+UPDATE categories SET position = (
+    SELECT COUNT(*) FROM categories c2 WHERE c2.name < categories.name
+) + 1;
+
+CREATE INDEX IF NOT EXISTS idx_categories_position ON categories(position);
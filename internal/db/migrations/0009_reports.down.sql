@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_reports_status;
+DROP INDEX IF EXISTS idx_reports_open_target;
+DROP TABLE IF EXISTS reports;
@@ -0,0 +1,28 @@
+-- Every moderator and admin action, for the record. Rows are never changed
+-- or removed (see the triggers below). actor_id and target_id are plain
+-- numbers rather than foreign keys, so that entries outlive what they refer
+-- to; actor_name keeps the actor's name at the time.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor_id INTEGER,              -- NULL for the command line
+    actor_name TEXT NOT NULL,
+    action TEXT NOT NULL,          -- e.g. post.delete, user.ban, category.merge
+    target_type TEXT NOT NULL,     -- post, comment, user or category
+    target_id INTEGER NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    before TEXT,                   -- JSON snapshot of the target before the action
+    after TEXT,                    -- ... and after it (NULL if it is gone)
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
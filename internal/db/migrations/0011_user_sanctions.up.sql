@@ -0,0 +1,21 @@
+-- Sanctions on members. A ban logs the user out everywhere and keeps
+-- them from logging in; a suspension lets them read but not post, comment or
+-- like. Either may expire (expires_at, NULL = until lifted) or be lifted early.
+-- notified_at is set once the user has seen the notice about it.
+CREATE TABLE IF NOT EXISTS user_sanctions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('ban', 'suspension')),
+    reason TEXT NOT NULL DEFAULT '',
+    created_by INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    lifted_at DATETIME,
+    lifted_by INTEGER,
+    notified_at DATETIME,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY(lifted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sanctions_user ON user_sanctions(user_id, lifted_at);
@@ -0,0 +1,4 @@
+-- Each session gets a secret that its forms must send back (see
+-- middleware.RequireCSRF). Sessions that already exist get one here.
+ALTER TABLE sessions ADD COLUMN csrf_token TEXT NOT NULL DEFAULT '';
+UPDATE sessions SET csrf_token = lower(hex(randomblob(32)));
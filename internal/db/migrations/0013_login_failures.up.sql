@@ -0,0 +1,13 @@
+-- Failed logins, for rate limiting. Each failure is recorded twice: once
+-- for the client's IP address (scope 'ip') and once for the email address
+-- that was tried (scope 'account'). Rows older than the lockout period are
+-- of no more use and are removed as new failures come in.
+CREATE TABLE IF NOT EXISTS login_failures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope TEXT NOT NULL CHECK (scope IN ('ip', 'account')),
+    subject TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_subject ON login_failures(scope, subject, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_failures_created ON login_failures(created_at);
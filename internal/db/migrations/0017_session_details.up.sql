@@ -0,0 +1,11 @@
+-- What the sessions page (/settings/sessions) shows about each session:
+-- the browser and address it was last used from, and when. Sessions that
+-- already exist count as started and last seen now.
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN created_at DATETIME;
+ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME;
+UPDATE sessions SET created_at = CURRENT_TIMESTAMP, last_seen_at = CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions(expires_at);
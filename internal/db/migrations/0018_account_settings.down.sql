@@ -0,0 +1,2 @@
+ALTER TABLE email_verifications DROP COLUMN change_email;
+DROP TABLE IF EXISTS username_redirects;
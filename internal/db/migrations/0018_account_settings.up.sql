@@ -0,0 +1,11 @@
+-- Old usernames, so that /u/{old} links keep working after a rename. A
+-- name taken again by someone (or given back) loses its redirect.
+CREATE TABLE IF NOT EXISTS username_redirects (
+    old_username TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A confirmation link with change_email set is for a new address the user wants
+-- to switch to; the account keeps its old address until it is followed.
+ALTER TABLE email_verifications ADD COLUMN change_email INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- The placeholder account stays: content of deleted accounts belongs to it.
+DROP TABLE IF EXISTS account_deletions;
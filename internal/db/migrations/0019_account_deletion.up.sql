@@ -0,0 +1,22 @@
+-- Members can delete their account. The deletion happens once due_at has
+-- passed, and can be cancelled until then. mode: erase removes their posts
+-- and blanks their comments; anonymize keeps both under the placeholder
+-- account below.
+CREATE TABLE IF NOT EXISTS account_deletions (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    mode TEXT NOT NULL CHECK (mode IN ('erase', 'anonymize')),
+    requested_at DATETIME NOT NULL,
+    due_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_deletions_due ON account_deletions(due_at);
+
+-- The placeholder that content of deleted accounts is shown under. It has
+-- the fixed ID -1, which AUTOINCREMENT never hands out, and a password that
+-- is no hash, so nobody can log in as it. Members who took its name before
+-- it was reserved are renamed, so that nobody passes for it; a member with
+-- its address makes the migration fail.
+UPDATE users SET username = username || '-' || id
+WHERE lower(replace(replace(replace(username, '_', ' '), '.', ' '), '-', ' ')) = 'deleted user' AND id != -1;
+INSERT INTO users (id, email, username, password) VALUES (-1, 'deleted-user@invalid', 'deleted user', '!')
+ON CONFLICT(id) DO NOTHING;
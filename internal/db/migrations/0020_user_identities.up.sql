@@ -0,0 +1,28 @@
+-- Accounts at OpenID Connect providers that members log in with. subject is
+-- the provider's ID for the account (the "sub" claim); email is what the
+-- provider last said the address was. A member has at most one account per
+-- provider.
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_login_at DATETIME,
+    PRIMARY KEY (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+-- Logins on their way through a provider. state_hash is the hash of the
+-- state parameter (also kept in the browser's oidc_state cookie); nonce
+-- must come back in the ID token and verifier is the PKCE code verifier.
+-- link_user_id is set when a logged-in member is connecting the provider
+-- rather than logging in.
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    state_hash TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    verifier TEXT NOT NULL,
+    link_user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    expires_at DATETIME NOT NULL
+);
@@ -0,0 +1,21 @@
+-- migrate: foreign keys off
+-- Back to matching email addresses exactly (see the up migration).
+CREATE TABLE users_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL UNIQUE,
+    username TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    role TEXT NOT NULL DEFAULT 'member'
+        CHECK (role IN ('member', 'moderator', 'admin')),
+    email_verified_at DATETIME
+);
+
+INSERT INTO users_new (id, email, username, password, created_at, role, email_verified_at)
+SELECT id, email, username, password, created_at, role, email_verified_at FROM users;
+
+DELETE FROM sqlite_sequence WHERE name = 'users_new';
+UPDATE sqlite_sequence SET name = 'users_new' WHERE name = 'users';
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
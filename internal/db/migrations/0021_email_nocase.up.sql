@@ -0,0 +1,29 @@
+-- migrate: foreign keys off
+-- Email addresses are matched regardless of case, for logging in, signing
+-- up, password resets and everywhere else. SQLite cannot change a column's
+-- collation in place, so users is rebuilt (see "Making Other Kinds Of Table
+-- Schema Changes" in the SQLite ALTER TABLE docs) with foreign keys off, so
+-- dropping the old table does not cascade.
+--
+-- This fails if two accounts have the same address in different case; give
+-- one of them another address first.
+CREATE TABLE users_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    username TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    role TEXT NOT NULL DEFAULT 'member'
+        CHECK (role IN ('member', 'moderator', 'admin')),
+    email_verified_at DATETIME
+);
+
+INSERT INTO users_new (id, email, username, password, created_at, role, email_verified_at)
+SELECT id, email, username, password, created_at, role, email_verified_at FROM users;
+
+-- Keep the ID counter, so IDs of deleted accounts are not handed out again
+DELETE FROM sqlite_sequence WHERE name = 'users_new';
+UPDATE sqlite_sequence SET name = 'users_new' WHERE name = 'users';
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
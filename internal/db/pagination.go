@@ -0,0 +1,205 @@
+package db
+
+import (
+	"database/sql"
+	"literary-lions/internal/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor marks a post's place in a newest-first listing. Listings are ordered
+// by (created_at, id), so the id settles ties between posts from the same second.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// timestampLayout is how SQLite's CURRENT_TIMESTAMP stores created_at.
+const timestampLayout = "2006-01-02 15:04:05"
+
+// String encodes the cursor for a URL as "<unix seconds>-<id>".
+func (c Cursor) String() string {
+	return strconv.FormatInt(c.CreatedAt.Unix(), 10) + "-" + strconv.Itoa(c.ID)
+}
+
+// ParseCursor decodes a cursor made by Cursor.String. Anything else,
+// including another spelling of the same cursor or a time created_at can't
+// hold, is rejected.
+func ParseCursor(s string) (Cursor, bool) {
+	secs, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return Cursor{}, false
+	}
+	unix, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return Cursor{}, false
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil || n <= 0 {
+		return Cursor{}, false
+	}
+	c := Cursor{CreatedAt: time.Unix(unix, 0).UTC(), ID: n}
+	if y := c.CreatedAt.Year(); y < 1 || y > 9999 || c.String() != s {
+		return Cursor{}, false
+	}
+	return c, true
+}
+
+// PageOpts selects one page of a listing: the Limit posts just older than
+// Before, just newer than After, or the newest ones if neither is set.
+type PageOpts struct {
+	Before *Cursor
+	After  *Cursor
+	Limit  int
+}
+
+// PostPage is one page of a listing, newest first. Newer and Older are the
+// cursors for the neighbouring pages (pass them as After and Before);
+// they are nil at either end of the list.
+type PostPage struct {
+	Posts []models.Post
+	Newer *Cursor
+	Older *Cursor
+}
+
+// postColumns and postJoins are the common part of every post listing query
+// over "posts p". The post_likes join takes the viewer's user ID as argument.
+const (
+	postColumns = `
+		p.id, p.user_id, p.category_id, p.title, p.content,
+		COALESCE(p.image, ''), p.created_at, u.username, c.name,
+		p.like_count, p.dislike_count, p.comment_count,
+		COALESCE(l.value, 0)`
+	postJoins = `
+		JOIN users u ON p.user_id = u.id
+		JOIN categories c ON p.category_id = c.id
+		LEFT JOIN post_likes l ON l.post_id = p.id AND l.user_id = ?`
+)
+
+// scanPost reads a row selected with postColumns, followed by any extra
+// columns into dest.
+func scanPost(rows *sql.Rows, dest ...any) (models.Post, error) {
+	var p models.Post
+	err := rows.Scan(append([]any{
+		&p.ID, &p.UserID, &p.CategoryID, &p.Title, &p.Content,
+		&p.Image, &p.CreatedAt, &p.Author, &p.Category,
+		&p.Likes, &p.Dislikes, &p.Comments, &p.UserLikeValue,
+	}, dest...)...)
+	return p, err
+}
+
+// listPosts runs a paged, newest-first post listing. conds are extra WHERE
+// conditions (ANDed together) with their args; they may only refer to the
+// posts table as "p", so they can be reused to look for neighbouring pages.
+// Each post comes with its like, dislike and comment counts, the viewer's
+// like value and its hashtags.
+func listPosts(db *sql.DB, viewerID int, conds []string, args []any, opts PageOpts) (PostPage, error) {
+	var page PostPage
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+
+	// Walk newest-first from Before, or oldest-first from After and flip the result
+	order := "DESC"
+	where := slices.Clone(conds)
+	pageArgs := append([]any{viewerID}, args...)
+	switch {
+	case opts.Before != nil:
+		where = append(where, "(p.created_at, p.id) < (?, ?)")
+		pageArgs = append(pageArgs, opts.Before.CreatedAt.UTC().Format(timestampLayout), opts.Before.ID)
+	case opts.After != nil:
+		where = append(where, "(p.created_at, p.id) > (?, ?)")
+		pageArgs = append(pageArgs, opts.After.CreatedAt.UTC().Format(timestampLayout), opts.After.ID)
+		order = "ASC"
+	}
+	// One extra row tells whether there is more beyond this page
+	pageArgs = append(pageArgs, opts.Limit+1)
+
+	rows, err := db.Query(`
+		SELECT `+postColumns+`
+		FROM posts p `+postJoins+`
+		`+whereClause(where)+`
+		ORDER BY p.created_at `+order+`, p.id `+order+`
+		LIMIT ?`, pageArgs...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return page, err
+		}
+		page.Posts = append(page.Posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	more := len(page.Posts) > opts.Limit
+	if more {
+		page.Posts = page.Posts[:opts.Limit]
+	}
+	if opts.After != nil {
+		slices.Reverse(page.Posts)
+	}
+	if len(page.Posts) == 0 {
+		return page, nil
+	}
+	first := cursorOf(page.Posts[0])
+	last := cursorOf(page.Posts[len(page.Posts)-1])
+
+	// The direction we walked is settled by the extra row; the way we came
+	// from needs a quick look, as posts may have been deleted since.
+	switch {
+	case opts.After != nil:
+		if more {
+			page.Newer = &first
+		}
+		if page.Older, err = neighbour(db, conds, args, "<", last); err != nil {
+			return page, err
+		}
+	case opts.Before != nil:
+		if more {
+			page.Older = &last
+		}
+		if page.Newer, err = neighbour(db, conds, args, ">", first); err != nil {
+			return page, err
+		}
+	default:
+		if more {
+			page.Older = &last
+		}
+	}
+
+	return page, AttachHashtags(db, page.Posts)
+}
+
+// neighbour returns &c if any post matching conds lies beyond c in the given
+// direction ("<" older, ">" newer), or nil if c is at the end of the list.
+func neighbour(db *sql.DB, conds []string, args []any, op string, c Cursor) (*Cursor, error) {
+	where := append(slices.Clone(conds), "(p.created_at, p.id) "+op+" (?, ?)")
+	args = append(slices.Clone(args), c.CreatedAt.UTC().Format(timestampLayout), c.ID)
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM posts p `+whereClause(where)+`)`, args...).Scan(&exists)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// cursorOf returns the listing position of p.
+func cursorOf(p models.Post) Cursor {
+	return Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+}
+
+// whereClause joins conditions into a WHERE clause, or "" if there are none.
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conds, " AND ")
+}
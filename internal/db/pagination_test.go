@@ -0,0 +1,116 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// Paging through posts that share a second, either way, shows every post
+// once and in order.
+func TestFetchPostsPaging(t *testing.T) {
+	dbConn := newTestDB(t)
+	ann := addUser(t, dbConn, "ann")
+	var category int
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	// Three seconds with 3, 4 and 2 posts; ids don't follow the time
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var want []Cursor
+	for i, sec := range []int{1, 0, 1, 2, 0, 1, 0, 1, 2} {
+		createdAt := base.Add(time.Duration(sec) * time.Second)
+		var id int
+		err := dbConn.QueryRow(`INSERT INTO posts (user_id, category_id, title, content, created_at) VALUES (?, ?, ?, 'Text', ?) RETURNING id`,
+			ann, category, "Post", createdAt.Format(timestampLayout)).Scan(&id)
+		if err != nil {
+			t.Fatalf("post %d: %v", i, err)
+		}
+		want = append(want, Cursor{CreatedAt: createdAt, ID: id})
+	}
+	// Newest first
+	slices.SortFunc(want, func(a, b Cursor) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return b.ID - a.ID
+	})
+
+	for limit := 1; limit <= len(want)+1; limit++ {
+		// Older and older from the first page
+		var older []Cursor
+		var last PostPage
+		opts := PageOpts{Limit: limit}
+		for pages := 0; ; pages++ {
+			page, err := FetchPosts(dbConn, ann, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pages == 0 && page.Newer != nil {
+				t.Errorf("limit %d: the first page links to newer posts", limit)
+			}
+			for _, p := range page.Posts {
+				older = append(older, cursorOf(p))
+			}
+			last = page
+			if page.Older == nil || pages > len(want) {
+				break
+			}
+			opts = PageOpts{Before: page.Older, Limit: limit}
+		}
+		if !equalCursors(older, want) {
+			t.Fatalf("limit %d, going back: %v, want %v", limit, older, want)
+		}
+
+		// And newer and newer from the last one
+		newer := cursorsOf(last)
+		for pages := 0; last.Newer != nil && pages <= len(want); pages++ {
+			page, err := FetchPosts(dbConn, ann, PageOpts{After: last.Newer, Limit: limit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Older == nil {
+				t.Errorf("limit %d: a page going forward has no link back", limit)
+			}
+			newer = append(cursorsOf(page), newer...)
+			last = page
+		}
+		if !equalCursors(newer, want) {
+			t.Fatalf("limit %d, going forward: %v, want %v", limit, newer, want)
+		}
+	}
+}
+
+func cursorsOf(page PostPage) []Cursor {
+	var cs []Cursor
+	for _, p := range page.Posts {
+		cs = append(cs, cursorOf(p))
+	}
+	return cs
+}
+
+func equalCursors(a, b []Cursor) bool {
+	return slices.EqualFunc(a, b, func(x, y Cursor) bool {
+		return x.ID == y.ID && x.CreatedAt.Equal(y.CreatedAt)
+	})
+}
+
+func TestParseCursor(t *testing.T) {
+	c := Cursor{CreatedAt: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), ID: 42}
+	if got, ok := ParseCursor(c.String()); !ok || got != c {
+		t.Errorf("ParseCursor(%q) = %v, %v", c.String(), got, ok)
+	}
+	for _, s := range []string{
+		"", "1748779200", "1748779200-", "-42", "x-42", "1748779200-x",
+		"1748779200-0", "1748779200--1", "1748779200-42-1", "1748779200-4.2",
+		"+1748779200-42", "01748779200-42", "1748779200-042",
+		"1748779200-99999999999999999999",
+		"-62135596801-1", // before year 1
+		"253402300800-1", // after year 9999
+		"9223372036854775807-1",
+	} {
+		if got, ok := ParseCursor(s); ok {
+			t.Errorf("ParseCursor(%q) = %v, want it rejected", s, got)
+		}
+	}
+}
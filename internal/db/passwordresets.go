@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTooSoon is returned by CreatePasswordReset and CreateEmailVerification
+// when the user was sent such a link very recently.
+var ErrTooSoon = errors.New("a link was sent moments ago")
+
+// linkInterval is the least time between two reset or verification links
+// for one user.
+const linkInterval = time.Minute
+
+// validReset is the condition for a usable reset over "pr"; it takes the
+// token hash and the current time as arguments.
+const validReset = `pr.token_hash = ? AND pr.used_at IS NULL AND pr.expires_at > ?`
+
+// CreatePasswordReset issues a reset token for the user, valid for ttl,
+// and returns it (only its hash is kept). Returns ErrTooSoon if one was
+// issued less than a minute ago.
+func CreatePasswordReset(db *sql.DB, userID int, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	err = inTx(db, func(tx *sql.Tx) error {
+		var recent bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM password_resets WHERE user_id = ? AND created_at > ?)`,
+			userID, now.Add(-linkInterval).Format(timestampLayout)).Scan(&recent)
+		if err != nil {
+			return err
+		}
+		if recent {
+			return ErrTooSoon
+		}
+		_, err = tx.Exec(`
+			INSERT INTO password_resets(user_id, token_hash, created_at, expires_at)
+			VALUES (?, ?, ?, ?)`,
+			userID, hash, now.Format(timestampLayout), now.Add(ttl).Format(timestampLayout))
+		return err
+	})
+	return token, err
+}
+
+// PasswordResetUser returns the name of the user a reset token is for.
+// Returns sql.ErrNoRows if the token is unknown, used or expired.
+func PasswordResetUser(db *sql.DB, token string) (string, error) {
+	var username string
+	err := db.QueryRow(`
+		SELECT u.username FROM password_resets pr JOIN users u ON u.id = pr.user_id
+		WHERE `+validReset,
+		hashToken(token), time.Now().UTC().Format(timestampLayout)).Scan(&username)
+	return username, err
+}
+
+// ResetPassword sets the password hash of the user a reset token is for,
+// uses up that token and any other outstanding ones, and ends all the
+// user's sessions. Returns sql.ErrNoRows if the token is unknown, used or
+// expired.
+func ResetPassword(db *sql.DB, token, passwordHash string) error {
+	now := time.Now().UTC().Format(timestampLayout)
+	return inTx(db, func(tx *sql.Tx) error {
+		var userID int
+		err := tx.QueryRow(`SELECT pr.user_id FROM password_resets pr WHERE `+validReset,
+			hashToken(token), now).Scan(&userID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE users SET password = ? WHERE id = ?`, passwordHash, userID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`, now, userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+		return err
+	})
+}
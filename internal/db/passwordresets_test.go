@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPasswordReset(t *testing.T) {
+	dbConn := newTestDB(t)
+	userID := addUser(t, dbConn, "ann")
+	if _, err := CreateSession(dbConn, userID, "csrf", "test", "192.0.2.1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := CreatePasswordReset(dbConn, userID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored int
+	dbConn.QueryRow(`SELECT COUNT(*) FROM password_resets WHERE token_hash = ?`, token).Scan(&stored)
+	if stored != 0 {
+		t.Error("the token is stored as is, not hashed")
+	}
+	if _, err := CreatePasswordReset(dbConn, userID, time.Hour); !errors.Is(err, ErrTooSoon) {
+		t.Errorf("second link within a minute: %v, want ErrTooSoon", err)
+	}
+
+	for _, bad := range []string{"", "nonsense", token + "x"} {
+		if _, err := PasswordResetUser(dbConn, bad); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("PasswordResetUser(%q): %v, want sql.ErrNoRows", bad, err)
+		}
+	}
+	if name, err := PasswordResetUser(dbConn, token); err != nil || name != "ann" {
+		t.Fatalf("PasswordResetUser = %q, %v", name, err)
+	}
+
+	if err := ResetPassword(dbConn, token, "new-hash"); err != nil {
+		t.Fatal(err)
+	}
+	var hash string
+	var sessions int
+	dbConn.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hash)
+	dbConn.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = ?`, userID).Scan(&sessions)
+	if hash != "new-hash" || sessions != 0 {
+		t.Errorf("after the reset: password %q and %d sessions", hash, sessions)
+	}
+	// A token works once
+	if err := ResetPassword(dbConn, token, "other-hash"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("reusing the token: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPasswordResetExpiry(t *testing.T) {
+	dbConn := newTestDB(t)
+	userID := addUser(t, dbConn, "ann")
+	token, err := CreatePasswordReset(dbConn, userID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expires time.Duration // from now
+		valid   bool
+	}{
+		{time.Hour, true},
+		{2 * time.Second, true},
+		{0, false},
+		{-time.Second, false},
+	}
+	for _, tt := range tests {
+		at := time.Now().UTC().Add(tt.expires).Format(timestampLayout)
+		if _, err := dbConn.Exec(`UPDATE password_resets SET expires_at = ?`, at); err != nil {
+			t.Fatal(err)
+		}
+		_, err := PasswordResetUser(dbConn, token)
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("expiring in %v: valid = %v (%v), want %v", tt.expires, valid, err, tt.valid)
+		}
+	}
+}
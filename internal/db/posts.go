@@ -2,85 +2,25 @@ package db
 
 import (
 	"database/sql"
+	"literary-lions/internal/hashtag"
 	"literary-lions/internal/models"
 	"time"
 )
 
-// FetchPosts fetches the latest 20 posts, each with its author, category,
-// and the requesting user's like/dislike value for each post (if any)
-// Returns a slice of Post structs, or an error
-func FetchPosts(db *sql.DB, userID int) ([]models.Post, error) {
-	rows, err := db.Query(`
-		SELECT 
-			p.id, p.user_id, p.category_id, p.title, p.content, 
-			COALESCE(p.image, ''),    
-			p.created_at, 
-			u.username, c.name,
-			COALESCE(l.value, 0) -- like/dislike for this user, 0 if none
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		JOIN categories c ON p.category_id = c.id
-		LEFT JOIN post_likes l ON l.post_id = p.id AND l.user_id = ?
-		ORDER BY p.created_at DESC
-		LIMIT 20
-	`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var createdAt string
-		err := rows.Scan(
-			&post.ID,
-			&post.UserID,
-			&post.CategoryID,
-			&post.Title,
-			&post.Content,
-			&post.Image,
-			&createdAt,
-			&post.Author,
-			&post.Category,
-			&post.UserLikeValue,
-		)
-		if err != nil {
-			return nil, err
-		}
-		// Robust handling of date parsing (support for legacy/alternative formats)
-		post.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt)
-		if err != nil {
-			post.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
-			if err != nil {
-				post.CreatedAt = time.Now()
-			}
-		}
-		posts = append(posts, post)
-	}
-	return posts, nil
-}
-
-// CountLikesByPostID returns the total number of likes (value = 1)
-// for a given post ID. Returns 0 if none, or an error if the query fails
-func CountLikesByPostID(db *sql.DB, postID int) (int, error) {
-	var count int
-	err := db.QueryRow(`SELECT COUNT(*) FROM post_likes WHERE post_id = ? AND value = 1`, postID).Scan(&count)
-	return count, err
+// FetchPosts returns one page of the home feed, newest first, each post with
+// its author, category, like and comment counts, and the requesting user's
+// like/dislike value (if any).
+func FetchPosts(db *sql.DB, userID int, opts PageOpts) (PostPage, error) {
+	return listPosts(db, userID, nil, nil, opts)
 }
 
-// CountCommentsByPostID returns the total number of comments for a given post
-func CountCommentsByPostID(db *sql.DB, postID int) (int, error) {
-	var count int
-	err := db.QueryRow(`SELECT COUNT(*) FROM comments WHERE post_id = ?`, postID).Scan(&count)
-	return count, err
-}
-
-// GetPost returns a Post struct by postID, along with the current user's like/dislike value.
+// GetPost returns a Post struct by postID, with its like, dislike and comment
+// counts and the current user's like/dislike value.
 // Uses both classic and RFC3339 date formats for robustness.
 func GetPost(db *sql.DB, postID int, viewerID int) (models.Post, error) {
 	var p models.Post
 	var createdAt string
+	var updatedAt sql.NullTime
 	err := db.QueryRow(`
         SELECT 
 			p.id, 
@@ -90,8 +30,13 @@ func GetPost(db *sql.DB, postID int, viewerID int) (models.Post, error) {
 			p.content,
             COALESCE(p.image, ''), 
 			p.created_at, 
+			p.updated_at,
 			u.username, 
 			c.name,
+			p.like_count,
+			p.dislike_count,
+			p.comment_count,
+			p.locked_at IS NOT NULL,
             COALESCE((SELECT value FROM post_likes WHERE post_id = p.id AND user_id = ?), 0)
         FROM posts p
         JOIN users u ON p.user_id = u.id
@@ -106,8 +51,13 @@ func GetPost(db *sql.DB, postID int, viewerID int) (models.Post, error) {
 			&p.Content,
 			&p.Image,
 			&createdAt,
+			&updatedAt,
 			&p.Author,
 			&p.Category,
+			&p.Likes,
+			&p.Dislikes,
+			&p.Comments,
+			&p.Locked,
 			&p.UserLikeValue,
 		)
 	if err != nil {
@@ -122,6 +72,9 @@ func GetPost(db *sql.DB, postID int, viewerID int) (models.Post, error) {
 			p.CreatedAt = time.Now() // fallback — чтоб не было мусора
 		}
 	}
+	if updatedAt.Valid {
+		p.UpdatedAt = updatedAt.Time
+	}
 	return p, nil
 }
 
@@ -133,9 +86,13 @@ func GetComments(db *sql.DB, postID int, viewerID int) ([]models.Comment, error)
 			c.id,
 			c.post_id,
 			c.user_id,
+			COALESCE(c.parent_comment_id, 0),         -- 0 = top-level
 			u.username,                               -- author
 			c.content,
 			c.created_at,
+			c.updated_at,
+			c.deleted_at IS NOT NULL                  AS deleted,
+			COALESCE(c.deleted_by != c.user_id, 0)    AS deleted_by_moderator,
 			/* total likes for this comment */
 			(SELECT COUNT(*) FROM comment_likes
 			  WHERE comment_id = c.id AND value = 1)  AS likes,
@@ -147,7 +104,7 @@ func GetComments(db *sql.DB, postID int, viewerID int) ([]models.Comment, error)
 		FROM comments c
 		JOIN users u ON u.id = c.user_id
 		WHERE c.post_id = ?
-		ORDER BY c.created_at DESC;
+		ORDER BY c.created_at DESC, c.id DESC;
 	`, viewerID, postID)
 	if err != nil {
 		return nil, err
@@ -157,87 +114,101 @@ func GetComments(db *sql.DB, postID int, viewerID int) ([]models.Comment, error)
 	var list []models.Comment
 	for rows.Next() {
 		var cm models.Comment
+		var updatedAt sql.NullTime
 		if err := rows.Scan(
 			&cm.ID,
 			&cm.PostID,
 			&cm.UserID,
+			&cm.ParentID,
 			&cm.Author,
 			&cm.Content,
 			&cm.CreatedAt,
+			&updatedAt,
+			&cm.Deleted,
+			&cm.DeletedByModerator,
 			&cm.Likes,         // ← add these fields in models.Comment
 			&cm.UserLikeValue, // ← 1 / -1 / 0
 		); err != nil {
 			// Skip any broken row, but keep processing
 			continue
 		}
+		if updatedAt.Valid {
+			cm.UpdatedAt = updatedAt.Time
+		}
 		list = append(list, cm)
 	}
 	return list, nil
 }
 
+// CreatePost inserts a new post and links the hashtags found in its title
+// and content, in one transaction. Returns the new post's ID, or
+// sql.ErrNoRows if the category does not exist or is archived.
+func CreatePost(db *sql.DB, userID, categoryID int, title, content, image string) (int, error) {
+	var postID int
+	err := inTx(db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`
+			INSERT INTO posts (user_id, category_id, title, content, image)
+			SELECT ?, ?, ?, ?, ?
+			WHERE EXISTS (`+openCategory+`)
+			RETURNING id`,
+			userID, categoryID, title, content, image, categoryID,
+		).Scan(&postID)
+		if err != nil {
+			return err
+		}
+		return SetPostHashtags(tx, postID, hashtag.Parse(title, content))
+	})
+	return postID, err
+}
+
 // AddComment inserts a new comment for a given postID and userID with the given text.
-// Returns an error if the insert fails
-func AddComment(db *sql.DB, postID, userID int, text string) error {
-	_, err := db.Exec(`INSERT INTO comments(post_id,user_id,content)
-                       VALUES(?,?,?)`, postID, userID, text)
-	return err
+// parentID is the comment being replied to, or 0 for a top-level comment; it must
+// belong to the same post and not be deleted.
+// Returns the new comment's ID, sql.ErrNoRows if the post is locked or the
+// parent is invalid, or an error if the insert fails
+func AddComment(db *sql.DB, postID, userID, parentID int, text string) (int, error) {
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO comments(post_id, user_id, content, parent_comment_id)
+		SELECT ?, ?, ?, NULLIF(?, 0)
+		WHERE NOT EXISTS (SELECT 1 FROM posts WHERE id = ? AND locked_at IS NOT NULL)
+		AND (? = 0 OR EXISTS (
+			SELECT 1 FROM comments
+			WHERE id = ? AND post_id = ? AND deleted_at IS NULL
+		))
+		RETURNING id`,
+		postID, userID, text, parentID, postID, parentID, parentID, postID).Scan(&id)
+	return id, err
 }
 
-// FetchPostsByCategory fetches up to 50 posts for the given categoryID.
-// Returns posts in newest-first order, or an error.
-func FetchPostsByCategory(db *sql.DB, categoryID int) ([]models.Post, error) {
-	rows, err := db.Query(`
-        SELECT p.id, p.user_id, p.category_id, p.title, p.content, COALESCE(p.image,''), p.created_at, u.username, c.name
-        FROM posts p
-        JOIN users u ON p.user_id = u.id
-        JOIN categories c ON p.category_id = c.id
-        WHERE p.category_id = ?
-        ORDER BY p.created_at DESC
-        LIMIT 50
-    `, categoryID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var createdAt time.Time
-		_ = rows.Scan(&post.ID, &post.UserID, &post.CategoryID, &post.Title, &post.Content, &post.Image, &createdAt, &post.Author, &post.Category)
-		post.CreatedAt = createdAt
-		posts = append(posts, post)
-	}
-	return posts, nil
+// FetchPostsByCategory returns one page of the posts in the given category,
+// newest first.
+func FetchPostsByCategory(db *sql.DB, categoryID, viewerID int, opts PageOpts) (PostPage, error) {
+	return listPosts(db, viewerID, []string{"p.category_id = ?"}, []any{categoryID}, opts)
 }
 
-// FetchCategories returns all categories sorted alphabetically.
-func FetchCategories(db *sql.DB) ([]models.Category, error) {
-	rows, err := db.Query("SELECT id, name FROM categories ORDER BY name ASC")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var cats []models.Category
-	for rows.Next() {
-		var c models.Category
-		rows.Scan(&c.ID, &c.Name)
-		cats = append(cats, c)
-	}
-	return cats, nil
+// FetchPostsByUser returns one page of the posts written by userID, newest first.
+func FetchPostsByUser(db *sql.DB, userID, viewerID int, opts PageOpts) (PostPage, error) {
+	return listPosts(db, viewerID, []string{"p.user_id = ?"}, []any{userID}, opts)
 }
 
-// FetchPopularPosts returns the most-liked posts up to the specified limit.
-// Each post includes its author and category names.
+// FetchPostsLikedBy returns one page of the posts userID has liked, newest first.
+func FetchPostsLikedBy(db *sql.DB, userID, viewerID int, opts PageOpts) (PostPage, error) {
+	return listPosts(db, viewerID,
+		[]string{"p.id IN (SELECT post_id FROM post_likes WHERE user_id = ? AND value = 1)"},
+		[]any{userID}, opts)
+}
+
+// FetchPopularPosts returns the best-rated posts (likes minus dislikes) up to
+// the specified limit. Each post includes its author and category names.
 func FetchPopularPosts(db *sql.DB, limit int) ([]models.Post, error) {
 	rows, err := db.Query(`
 		SELECT p.id, p.user_id, p.category_id, p.title, p.content, p.image, p.created_at, u.username, c.name, 
-		       IFNULL(SUM(pl.value), 0) as likes
+		       p.like_count - p.dislike_count AS score
 		  FROM posts p
 		  JOIN users u ON p.user_id = u.id
 		  JOIN categories c ON p.category_id = c.id
-		  LEFT JOIN post_likes pl ON p.id = pl.post_id
-		 GROUP BY p.id
-		 ORDER BY likes DESC, p.created_at DESC
+		 ORDER BY score DESC, p.created_at DESC
 		 LIMIT ?`, limit)
 	if err != nil {
 		return nil, err
@@ -258,30 +229,81 @@ func FetchPopularPosts(db *sql.DB, limit int) ([]models.Post, error) {
 	return posts, nil
 }
 
-// DeleteCommentByID deletes a comment by its ID, only if it belongs to the given user.
-// Returns sql.ErrNoRows if no such comment or not the owner.
-func DeleteCommentByID(db *sql.DB, commentID, userID int) error {
-	res, err := db.Exec(`DELETE FROM comments WHERE id = ? AND user_id = ?`, commentID, userID)
-	if err != nil {
+// DeleteCommentByID soft-deletes a comment by its ID, only if it belongs to the given
+// user or the user moderates the post's category. Removals by a moderator are
+// recorded in the audit log with the given reason.
+// The row stays in place (with its likes and position) and is shown as a tombstone.
+// Returns the comment's post ID, or sql.ErrNoRows if no such comment, not allowed
+// or already deleted.
+func DeleteCommentByID(db *sql.DB, commentID, userID int, reason string) (int, error) {
+	var postID int
+	err := inTx(db, func(tx *sql.Tx) error {
+		var err error
+		postID, err = deleteComment(tx, commentID, userID, reason)
 		return err
+	})
+	return postID, err
+}
+
+func deleteComment(tx *sql.Tx, commentID, userID int, reason string) (int, error) {
+	before, err := snapshot(tx, commentSnapshot, commentID)
+	if err != nil {
+		return 0, err
+	}
+	var postID, authorID int
+	err = tx.QueryRow(`
+		UPDATE comments SET deleted_at = CURRENT_TIMESTAMP, deleted_by = ?
+		WHERE id = ? AND deleted_at IS NULL
+		  AND (user_id = ? OR `+canModerate("(SELECT category_id FROM posts WHERE id = comments.post_id)")+`)
+		RETURNING post_id, user_id`, userID, commentID, userID, userID).Scan(&postID, &authorID)
+	if err != nil || authorID == userID {
+		return postID, err // sql.ErrNoRows: not found, not allowed or already deleted
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return sql.ErrNoRows // not found or not owner
+	after, err := snapshot(tx, commentSnapshot, commentID)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return postID, audit(tx, userID, AuditCommentDelete, "comment", commentID, reason, before, after)
 }
 
-// DeletePostByID deletes a post by its ID, only if it belongs to the given user.
-// Returns sql.ErrNoRows if no such post or not the owner.
-func DeletePostByID(db *sql.DB, postID, userID int) error {
-	res, err := db.Exec(`DELETE FROM posts WHERE id = ? AND user_id = ?`, postID, userID)
+// UpdateComment replaces the text of a comment, only if it belongs to the given
+// user, has not been deleted and its post is not locked (as for AddComment).
+// Returns the comment's post ID, or sql.ErrNoRows.
+func UpdateComment(db *sql.DB, commentID, userID int, text string) (int, error) {
+	var postID int
+	err := db.QueryRow(`
+		UPDATE comments SET content = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM posts WHERE id = comments.post_id AND locked_at IS NOT NULL)
+		RETURNING post_id`, text, commentID, userID).Scan(&postID)
+	return postID, err // sql.ErrNoRows: not found, not owner, deleted or locked
+}
+
+// DeletePostByID deletes a post by its ID, only if it belongs to the given user
+// or the user moderates its category. Deletions by a moderator are recorded in
+// the audit log with the given reason.
+// Returns sql.ErrNoRows if no such post or not allowed.
+func DeletePostByID(db *sql.DB, postID, userID int, reason string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		return deletePost(tx, postID, userID, reason)
+	})
+}
+
+func deletePost(tx *sql.Tx, postID, userID int, reason string) error {
+	var authorID int
+	err := tx.QueryRow(`
+		SELECT user_id FROM posts
+		WHERE id = ? AND (user_id = ? OR `+canModerate("posts.category_id")+`)`,
+		postID, userID, userID).Scan(&authorID)
 	if err != nil {
-		return err
+		return err // sql.ErrNoRows: not found or not allowed
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return sql.ErrNoRows // Not found or not owner
+	if authorID == userID {
+		_, err := tx.Exec(`DELETE FROM posts WHERE id = ?`, postID)
+		return err
 	}
-	return nil
+	return auditChange(tx, userID, AuditPostDelete, "post", postID, reason, postSnapshot, func() error {
+		_, err := tx.Exec(`DELETE FROM posts WHERE id = ?`, postID)
+		return err
+	})
 }
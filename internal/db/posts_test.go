@@ -0,0 +1,371 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"literary-lions/internal/models"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// seedPosts fills dbConn with posts by a handful of members, each post with
+// up to three reactions and three comments.
+func seedPosts(b *testing.B, dbConn *sql.DB, posts int) {
+	b.Helper()
+	const members = 50
+	rng := rand.New(rand.NewSource(1))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := inTx(dbConn, func(tx *sql.Tx) error {
+		users := make([]int, members)
+		for i := range users {
+			if err := tx.QueryRow(`INSERT INTO users (email, username, password) VALUES (?, ?, 'x') RETURNING id`,
+				fmt.Sprintf("m%d@example.com", i), fmt.Sprintf("m%d", i)).Scan(&users[i]); err != nil {
+				return err
+			}
+		}
+		var category int64
+		if err := tx.QueryRow(`INSERT INTO categories (name) VALUES ('Bench') RETURNING id`).Scan(&category); err != nil {
+			return err
+		}
+		post, err := tx.Prepare(`INSERT INTO posts (user_id, category_id, title, content, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id`)
+		if err != nil {
+			return err
+		}
+		like, err := tx.Prepare(`INSERT INTO post_likes (post_id, user_id, value) VALUES (?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		comment, err := tx.Prepare(`INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, 'Nice')`)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < posts; i++ {
+			var id int64
+			createdAt := start.Add(time.Duration(i) * time.Minute).Format(timestampLayout)
+			if err := post.QueryRow(users[i%members], category, fmt.Sprintf("Post %d", i), "Text", createdAt).Scan(&id); err != nil {
+				return err
+			}
+			for _, u := range rng.Perm(members)[:rng.Intn(4)] {
+				if _, err := like.Exec(id, users[u], []int{1, 1, -1}[rng.Intn(3)]); err != nil {
+					return err
+				}
+			}
+			for n := rng.Intn(4); n > 0; n-- {
+				if _, err := comment.Exec(id, users[rng.Intn(members)]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+// migrateTo rolls dbConn back to the given schema version.
+func migrateTo(tb testing.TB, dbConn *sql.DB, version int) {
+	tb.Helper()
+	migrations, err := LoadMigrations()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := MigrateDown(dbConn, migrations[len(migrations)-1].Version-version); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// fetchPostsCounting loads a home page with the listing query as it was
+// before 0006_post_counters, counting each post's likes and comments in
+// correlated subqueries.
+func fetchPostsCounting(dbConn *sql.DB, viewerID int, before *Cursor) ([]models.Post, error) {
+	where, args := "", []any{viewerID}
+	if before != nil {
+		where = "WHERE (p.created_at, p.id) < (?, ?)"
+		args = append(args, before.CreatedAt.UTC().Format(timestampLayout), before.ID)
+	}
+	rows, err := dbConn.Query(`
+		SELECT
+			p.id, p.user_id, p.category_id, p.title, p.content,
+			COALESCE(p.image, ''), p.created_at, u.username, c.name,
+			(SELECT COUNT(*) FROM post_likes WHERE post_id = p.id AND value = 1),
+			(SELECT COUNT(*) FROM comments WHERE post_id = p.id),
+			COALESCE(l.value, 0)
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		JOIN categories c ON p.category_id = c.id
+		LEFT JOIN post_likes l ON l.post_id = p.id AND l.user_id = ?
+		`+where+`
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT 21`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []models.Post
+	for rows.Next() {
+		var p models.Post
+		err := rows.Scan(
+			&p.ID, &p.UserID, &p.CategoryID, &p.Title, &p.Content,
+			&p.Image, &p.CreatedAt, &p.Author, &p.Category,
+			&p.Likes, &p.Comments, &p.UserLikeValue,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, AttachHashtags(dbConn, posts)
+}
+
+// BenchmarkFetchPosts compares loading a home page whose counts are read
+// from the posts table (0006_post_counters) with the listing query from
+// before it, on a database at schema version 5, over 100k posts each.
+func BenchmarkFetchPosts(b *testing.B) {
+	deepCursor := func(dbConn *sql.DB) *Cursor {
+		var c Cursor
+		err := dbConn.QueryRow(`SELECT created_at, id FROM posts ORDER BY created_at DESC, id DESC LIMIT 1 OFFSET 70000`).
+			Scan(&c.CreatedAt, &c.ID)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return &c
+	}
+
+	dbConn := newTestDB(b)
+	seedPosts(b, dbConn, 100_000)
+	deep := deepCursor(dbConn)
+	b.Run("counters", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := FetchPosts(dbConn, 1, PageOpts{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("counters/deep", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := FetchPosts(dbConn, 1, PageOpts{Before: deep}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	oldConn := newTestDB(b)
+	migrateTo(b, oldConn, 5)
+	seedPosts(b, oldConn, 100_000)
+	oldDeep := deepCursor(oldConn)
+	b.Run("before-0006", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := fetchPostsCounting(oldConn, 1, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("before-0006/deep", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := fetchPostsCounting(oldConn, 1, oldDeep); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// The 0006 triggers keep the counters right as reactions are given,
+// changed and taken back, and comments added and deleted.
+func TestPostCounters(t *testing.T) {
+	dbConn := newTestDB(t)
+	ann, bob, cy := addUser(t, dbConn, "ann"), addUser(t, dbConn, "bob"), addUser(t, dbConn, "cy")
+	var category int
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	postID, err := CreatePost(dbConn, ann, category, "Title", "Text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := CreatePost(dbConn, ann, category, "Other", "Text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// React the way the like handler does
+	react := func(userID, value int) func() error {
+		return exec(dbConn, `INSERT INTO post_likes (post_id, user_id, value) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, post_id) DO UPDATE SET value = excluded.value`, postID, userID, value)
+	}
+	unreact := func(userID int) func() error {
+		return exec(dbConn, `DELETE FROM post_likes WHERE post_id = ? AND user_id = ?`, postID, userID)
+	}
+	var commentID int
+
+	steps := []struct {
+		name                      string
+		do                        func() error
+		likes, dislikes, comments int
+	}{
+		{"like", react(ann, 1), 1, 0, 0},
+		{"another like", react(bob, 1), 2, 0, 0},
+		{"dislike", react(cy, -1), 2, 1, 0},
+		{"like flipped to dislike", react(bob, -1), 1, 2, 0},
+		{"dislike flipped to like", react(cy, 1), 2, 1, 0},
+		{"same reaction again", react(cy, 1), 2, 1, 0},
+		{"like taken back", unreact(ann), 1, 1, 0},
+		{"dislike taken back", unreact(bob), 1, 0, 0},
+		{"comment", func() error {
+			var err error
+			commentID, err = AddComment(dbConn, postID, bob, 0, "First")
+			return err
+		}, 1, 0, 1},
+		{"reply", func() error {
+			_, err := AddComment(dbConn, postID, ann, commentID, "Reply")
+			return err
+		}, 1, 0, 2},
+		{"comment removed", func() error {
+			_, err := DeleteCommentByID(dbConn, commentID, bob, "")
+			return err
+		}, 1, 0, 2},
+		{"comment deleted", func() error { return exec(dbConn, `DELETE FROM comments WHERE id = ?`, commentID)() }, 1, 0, 1},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		var likes, dislikes, comments, countedLikes, countedDislikes, countedComments int
+		err := dbConn.QueryRow(`
+			SELECT like_count, dislike_count, comment_count,
+			       (SELECT COUNT(*) FROM post_likes WHERE post_id = posts.id AND value = 1),
+			       (SELECT COUNT(*) FROM post_likes WHERE post_id = posts.id AND value = -1),
+			       (SELECT COUNT(*) FROM comments WHERE post_id = posts.id)
+			FROM posts WHERE id = ?`, postID).
+			Scan(&likes, &dislikes, &comments, &countedLikes, &countedDislikes, &countedComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if likes != step.likes || dislikes != step.dislikes || comments != step.comments {
+			t.Errorf("after %s: %d likes, %d dislikes, %d comments; want %d, %d, %d",
+				step.name, likes, dislikes, comments, step.likes, step.dislikes, step.comments)
+		}
+		if likes != countedLikes || dislikes != countedDislikes || comments != countedComments {
+			t.Errorf("after %s: counters %d/%d/%d, rows %d/%d/%d",
+				step.name, likes, dislikes, comments, countedLikes, countedDislikes, countedComments)
+		}
+	}
+
+	var other int
+	dbConn.QueryRow(`SELECT like_count + dislike_count + comment_count FROM posts WHERE id = ?`, otherID).Scan(&other)
+	if other != 0 {
+		t.Errorf("another post's counters moved: %d", other)
+	}
+}
+
+// exec returns a step running query.
+func exec(dbConn *sql.DB, query string, args ...any) func() error {
+	return func() error {
+		_, err := dbConn.Exec(query, args...)
+		return err
+	}
+}
+
+// Comments from the same second come newest first by ID, the same on
+// every load.
+func TestGetCommentsOrder(t *testing.T) {
+	dbConn := newTestDB(t)
+	ann := addUser(t, dbConn, "ann")
+	var category int
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	postID, err := CreatePost(dbConn, ann, category, "Title", "Text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, text := range []string{"one", "two", "three"} {
+		id, err := AddComment(dbConn, postID, ann, 0, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append([]int{id}, ids...)
+	}
+	if _, err := dbConn.Exec(`UPDATE comments SET created_at = '2025-01-01 12:00:00'`); err != nil {
+		t.Fatal(err)
+	}
+	comments, err := GetComments(dbConn, postID, ann)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, c := range comments {
+		got = append(got, c.ID)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(ids) {
+		t.Errorf("comment IDs in order %v, want %v", got, ids)
+	}
+}
+
+// Editing a comment is refused where adding one is: on someone else's
+// comment, a removed one, or in a locked discussion.
+func TestUpdateComment(t *testing.T) {
+	dbConn := newTestDB(t)
+	ann := addUser(t, dbConn, "ann")
+	bob := addUser(t, dbConn, "bob")
+	admin := addUser(t, dbConn, "admin")
+	if _, err := dbConn.Exec(`UPDATE users SET role = 'admin' WHERE id = ?`, admin); err != nil {
+		t.Fatal(err)
+	}
+	var category int
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	postID, err := CreatePost(dbConn, ann, category, "Title", "Text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment, err := AddComment(dbConn, postID, ann, 0, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := AddComment(dbConn, postID, ann, 0, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteCommentByID(dbConn, removed, ann, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := UpdateComment(dbConn, comment, ann, "edited"); err != nil || got != postID {
+		t.Fatalf("UpdateComment = %d, %v", got, err)
+	}
+	if _, err := UpdateComment(dbConn, comment, bob, "bob's"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("someone else's comment: %v, want sql.ErrNoRows", err)
+	}
+	if _, err := UpdateComment(dbConn, removed, ann, "back"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("removed comment: %v, want sql.ErrNoRows", err)
+	}
+
+	if err := SetPostLocked(dbConn, postID, admin, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddComment(dbConn, postID, ann, 0, "third"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("AddComment when locked: %v, want sql.ErrNoRows", err)
+	}
+	if _, err := UpdateComment(dbConn, comment, ann, "locked"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpdateComment when locked: %v, want sql.ErrNoRows", err)
+	}
+	var content string
+	dbConn.QueryRow(`SELECT content FROM comments WHERE id = ?`, comment).Scan(&content)
+	if content != "edited" {
+		t.Errorf("the comment reads %q", content)
+	}
+
+	if err := SetPostLocked(dbConn, postID, admin, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateComment(dbConn, comment, ann, "unlocked"); err != nil {
+		t.Errorf("UpdateComment after unlocking: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"literary-lions/internal/models"
+	"slices"
+)
+
+// Report statuses. A report stays open until a moderator either acts on
+// it (resolved) or decides it needs no action (dismissed).
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// CreateReport records a report about a post (commentID 0) or one of its
+// comments. Reporting the same thing again while the first report is still
+// open does nothing.
+func CreateReport(db *sql.DB, reporterID, postID, commentID int, reason, details string) error {
+	_, err := db.Exec(`
+		INSERT INTO reports (reporter_id, post_id, comment_id, reason, details)
+		SELECT ?, ?, NULLIF(?, 0), ?, ?
+		WHERE EXISTS (SELECT 1 FROM posts WHERE id = ?)
+		  AND (? = 0 OR EXISTS (SELECT 1 FROM comments WHERE id = ? AND post_id = ?))
+		ON CONFLICT DO NOTHING`,
+		reporterID, postID, commentID, reason, details,
+		postID, commentID, commentID, postID)
+	return err
+}
+
+// FetchReportQueue returns the open reports that viewerID may handle (all
+// of them for admins, those in their categories for moderators), grouped
+// by the reported post or comment. The most reported come first.
+func FetchReportQueue(db *sql.DB, viewerID int) ([]models.ReportGroup, error) {
+	rows, err := db.Query(`
+		SELECT r.post_id, COALESCE(r.comment_id, 0),
+		       r.id, r.reporter_id, ru.username, r.reason, r.details, r.created_at,
+		       (SELECT COUNT(*) FROM reports r2 WHERE r2.reporter_id = r.reporter_id),
+		       (SELECT COUNT(*) FROM reports r2 WHERE r2.reporter_id = r.reporter_id AND r2.status = 'dismissed'),
+		       p.title, c.name, au.id, au.username,
+		       COALESCE(cm.content, p.content), cm.deleted_at IS NOT NULL,
+		       EXISTS (SELECT 1 FROM user_sanctions s WHERE s.user_id = au.id AND s.kind = 'ban' AND `+activeSanction+`)
+		FROM reports r
+		JOIN users ru ON ru.id = r.reporter_id
+		JOIN posts p ON p.id = r.post_id
+		JOIN categories c ON c.id = p.category_id
+		LEFT JOIN comments cm ON cm.id = r.comment_id
+		JOIN users au ON au.id = COALESCE(cm.user_id, p.user_id)
+		WHERE r.status = 'open' AND `+canModerate("p.category_id")+`
+		ORDER BY r.post_id, COALESCE(r.comment_id, 0), r.created_at`, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.ReportGroup
+	for rows.Next() {
+		var (
+			g   models.ReportGroup
+			rep models.Report
+		)
+		err := rows.Scan(&g.PostID, &g.CommentID,
+			&rep.ID, &rep.ReporterID, &rep.Reporter, &rep.Reason, &rep.Details, &rep.CreatedAt,
+			&rep.ReporterTotal, &rep.ReporterDismissed,
+			&g.PostTitle, &g.Category, &g.AuthorID, &g.Author,
+			&g.Content, &g.Deleted, &g.Banned)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(groups); n == 0 || groups[n-1].PostID != g.PostID || groups[n-1].CommentID != g.CommentID {
+			groups = append(groups, g)
+		}
+		last := &groups[len(groups)-1]
+		last.Reports = append(last.Reports, rep)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Most reports first, then the most recently reported
+	slices.SortStableFunc(groups, func(a, b models.ReportGroup) int {
+		if len(a.Reports) != len(b.Reports) {
+			return len(b.Reports) - len(a.Reports)
+		}
+		return b.Reports[len(b.Reports)-1].CreatedAt.Compare(a.Reports[len(a.Reports)-1].CreatedAt)
+	})
+	return groups, nil
+}
+
+// CloseReports marks the open reports about a post (commentID 0) or comment
+// as resolved or dismissed by moderatorID, if they may moderate the post's
+// category, and records this in the audit log with the given reason and a
+// snapshot of the reported content. Returns how many reports were closed, or sql.ErrNoRows
+// if none.
+func CloseReports(db *sql.DB, postID, commentID, moderatorID int, status, reason string) (int, error) {
+	var closed int
+	err := inTx(db, func(tx *sql.Tx) error {
+		var err error
+		closed, err = closeReports(tx, postID, commentID, moderatorID, status, reason)
+		return err
+	})
+	return closed, err
+}
+
+// DeleteReported closes the open reports about a post (commentID 0) or one
+// of its comments as resolved, as CloseReports does, and deletes what was
+// reported, in one transaction. A comment that was already removed counts
+// as deleted. Returns how many reports were closed, or sql.ErrNoRows if
+// none.
+func DeleteReported(db *sql.DB, postID, commentID, moderatorID int, reason string) (int, error) {
+	var closed int
+	err := inTx(db, func(tx *sql.Tx) error {
+		// Close the reports first: deleting a post removes its reports
+		var err error
+		closed, err = closeReports(tx, postID, commentID, moderatorID, ReportResolved, reason)
+		if err != nil {
+			return err
+		}
+		if commentID != 0 {
+			_, err = deleteComment(tx, commentID, moderatorID, reason)
+		} else {
+			err = deletePost(tx, postID, moderatorID, reason)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	return closed, err
+}
+
+func closeReports(tx *sql.Tx, postID, commentID, moderatorID int, status, reason string) (int, error) {
+	targetType, targetID, q := "post", postID, postSnapshot
+	if commentID != 0 {
+		targetType, targetID, q = "comment", commentID, commentSnapshot
+	}
+	action := AuditReportResolve
+	if status == ReportDismissed {
+		action = AuditReportDismiss
+	}
+
+	res, err := tx.Exec(`
+		UPDATE reports
+		SET status = ?, handled_by = ?, handled_at = CURRENT_TIMESTAMP
+		WHERE status = 'open' AND post_id = ? AND COALESCE(comment_id, 0) = ?
+		  AND `+canModerate("(SELECT category_id FROM posts WHERE id = reports.post_id)"),
+		status, moderatorID, postID, commentID, moderatorID)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	content, err := snapshot(tx, q, targetID)
+	if err != nil {
+		return 0, err
+	}
+	var outcome sql.NullString
+	err = tx.QueryRow(`SELECT json_object('status', ?, 'reports', ?)`, status, n).Scan(&outcome)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), audit(tx, moderatorID, action, targetType, targetID, reason, content, outcome)
+}
+
+// AuthorOf returns the author of a post (commentID 0) or of one of its
+// comments. Returns sql.ErrNoRows if there is no such post or comment.
+func AuthorOf(db *sql.DB, postID, commentID int) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		SELECT CASE WHEN ? = 0 THEN p.user_id ELSE c.user_id END
+		FROM posts p
+		LEFT JOIN comments c ON c.id = ? AND c.post_id = p.id
+		WHERE p.id = ? AND (? = 0 OR c.id IS NOT NULL)`,
+		commentID, commentID, postID, commentID).Scan(&userID)
+	return userID, err
+}
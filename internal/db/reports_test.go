@@ -0,0 +1,71 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestDeleteReported(t *testing.T) {
+	dbConn := newTestDB(t)
+	author := addUser(t, dbConn, "author")
+	reporter := addUser(t, dbConn, "reporter")
+	admin := addUser(t, dbConn, "admin")
+	if _, err := dbConn.Exec(`UPDATE users SET role = 'admin' WHERE id = ?`, admin); err != nil {
+		t.Fatal(err)
+	}
+	var category int
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	postID, err := CreatePost(dbConn, author, category, "Title", "Text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := AddComment(dbConn, postID, author, 0, "Comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []int{0, commentID} {
+		if err := CreateReport(dbConn, reporter, postID, c, "spam", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(query string, args ...any) int {
+		t.Helper()
+		var n int
+		if err := dbConn.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// Someone who may not moderate changes nothing
+	if _, err := DeleteReported(dbConn, postID, commentID, reporter, "spam"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("DeleteReported by a member: %v, want sql.ErrNoRows", err)
+	}
+	if n := count(`SELECT COUNT(*) FROM reports WHERE status = 'open'`); n != 2 {
+		t.Fatalf("%d open reports after a refused delete, want 2", n)
+	}
+
+	closed, err := DeleteReported(dbConn, postID, commentID, admin, "spam")
+	if err != nil || closed != 1 {
+		t.Fatalf("DeleteReported(comment) = %d, %v", closed, err)
+	}
+	if n := count(`SELECT COUNT(*) FROM comments WHERE id = ? AND deleted_at IS NOT NULL`, commentID); n != 1 {
+		t.Fatal("comment not removed")
+	}
+	if _, err := DeleteReported(dbConn, postID, commentID, admin, "spam"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("second DeleteReported(comment): %v, want sql.ErrNoRows", err)
+	}
+
+	if closed, err := DeleteReported(dbConn, postID, 0, admin, "spam"); err != nil || closed != 1 {
+		t.Fatalf("DeleteReported(post) = %d, %v", closed, err)
+	}
+	if n := count(`SELECT COUNT(*) FROM posts WHERE id = ?`, postID); n != 0 {
+		t.Fatal("post not deleted")
+	}
+	if n := count(`SELECT COUNT(*) FROM audit_log WHERE actor_id = ?`, admin); n != 4 {
+		t.Fatalf("%d audit entries, want 4 (two closings, two removals)", n)
+	}
+}
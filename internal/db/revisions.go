@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+	"literary-lions/internal/hashtag"
+	"literary-lions/internal/models"
+	"time"
+)
+
+// UpdatePost replaces the title and content of a post owned by userID.
+// The version being replaced is first copied into post_revisions, so the
+// full history stays available, and the post's hashtags are re-parsed.
+// Everything runs in one transaction.
+// Returns sql.ErrNoRows if no such post or not the owner.
+func UpdatePost(db *sql.DB, postID, userID int, title, content string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		var (
+			oldTitle, oldContent string
+			createdAt            time.Time
+			updatedAt            sql.NullTime
+		)
+		err := tx.QueryRow(`
+			SELECT title, content, created_at, updated_at
+			FROM posts WHERE id = ? AND user_id = ?`, postID, userID).
+			Scan(&oldTitle, &oldContent, &createdAt, &updatedAt)
+		if err != nil {
+			return err // sql.ErrNoRows: not found or not owner
+		}
+
+		// The current version was written when the post was last edited,
+		// or when it was created if it never was.
+		versionAt := createdAt
+		if updatedAt.Valid {
+			versionAt = updatedAt.Time
+		}
+
+		// Nothing changed: don't record an empty revision
+		if oldTitle == title && oldContent == content {
+			return nil
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO post_revisions (post_id, title, content, created_at)
+			VALUES (?, ?, ?, ?)`, postID, oldTitle, oldContent, versionAt.UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			UPDATE posts SET title = ?, content = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?`, title, content, postID)
+		if err != nil {
+			return err
+		}
+
+		// Re-link hashtags to match the new text
+		return SetPostHashtags(tx, postID, hashtag.Parse(title, content))
+	})
+}
+
+// FetchPostRevisions returns every version of a post, oldest first.
+// The last element is the post as it is now (Current == true).
+func FetchPostRevisions(db *sql.DB, postID int) ([]models.PostRevision, error) {
+	rows, err := db.Query(`
+		SELECT title, content, created_at
+		FROM post_revisions
+		WHERE post_id = ?
+		ORDER BY id ASC`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.PostRevision
+	for rows.Next() {
+		var rev models.PostRevision
+		if err := rows.Scan(&rev.Title, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		rev.Number = len(list) + 1
+		list = append(list, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Append the live version from the posts table
+	current := models.PostRevision{Number: len(list) + 1, Current: true}
+	var updatedAt sql.NullTime
+	err = db.QueryRow(`
+		SELECT title, content, created_at, updated_at
+		FROM posts WHERE id = ?`, postID).
+		Scan(&current.Title, &current.Content, &current.CreatedAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if updatedAt.Valid {
+		current.CreatedAt = updatedAt.Time
+	}
+	return append(list, current), nil
+}
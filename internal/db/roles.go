@@ -0,0 +1,136 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/internal/models"
+	"slices"
+)
+
+// canModerateSQL is a condition that holds when the user whose ID is given
+// as argument may moderate the category %s (a column or subquery): admins
+// anywhere, moderators in the categories assigned to them.
+const canModerateSQL = `EXISTS (
+	SELECT 1 FROM users mu
+	WHERE mu.id = ? AND (mu.role = 'admin' OR (mu.role = 'moderator' AND EXISTS (
+		SELECT 1 FROM moderator_categories mc
+		WHERE mc.user_id = mu.id AND mc.category_id = %s))))`
+
+// canModerate returns canModerateSQL for the given category expression.
+func canModerate(category string) string {
+	return fmt.Sprintf(canModerateSQL, category)
+}
+
+// CanModerate reports whether userID may delete and lock content in
+// categoryID.
+func CanModerate(db *sql.DB, userID, categoryID int) (bool, error) {
+	var ok bool
+	err := db.QueryRow(`SELECT `+canModerate("?"), userID, categoryID).Scan(&ok)
+	return ok, err
+}
+
+// StaffMember is a moderator or admin, with the categories assigned to them.
+type StaffMember struct {
+	models.User
+	Categories []models.Category
+	TwoFactor  bool // two-factor authentication is on
+}
+
+// FetchStaff returns all moderators and admins, admins first, each with
+// the categories they moderate.
+func FetchStaff(db *sql.DB) ([]StaffMember, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.role, c.id, c.name,
+		       EXISTS (SELECT 1 FROM user_totp t WHERE t.user_id = u.id AND t.confirmed_at IS NOT NULL)
+		FROM users u
+		LEFT JOIN moderator_categories mc ON mc.user_id = u.id
+		LEFT JOIN categories c ON c.id = mc.category_id
+		WHERE u.role != 'member'
+		ORDER BY u.role = 'admin' DESC, u.username COLLATE NOCASE, c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var staff []StaffMember
+	for rows.Next() {
+		var (
+			u       models.User
+			catID   sql.NullInt64
+			catName sql.NullString
+			tfa     bool
+		)
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &catID, &catName, &tfa); err != nil {
+			return nil, err
+		}
+		if len(staff) == 0 || staff[len(staff)-1].ID != u.ID {
+			staff = append(staff, StaffMember{User: u, TwoFactor: tfa})
+		}
+		if catID.Valid {
+			last := &staff[len(staff)-1]
+			last.Categories = append(last.Categories, models.Category{ID: int(catID.Int64), Name: catName.String})
+		}
+	}
+	return staff, rows.Err()
+}
+
+// SetUserRole gives the user a role and, for moderators, replaces the
+// categories they moderate (others lose any assignments). The change is
+// recorded in the audit log as done by actorID (0 for the command line).
+// Returns sql.ErrNoRows if there is no such user.
+func SetUserRole(db *sql.DB, actorID int, username, role string, categoryIDs []int) error {
+	if !slices.Contains(models.Roles, role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		var userID int
+		if err := tx.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&userID); err != nil {
+			return err
+		}
+		return auditChange(tx, actorID, AuditUserRole, "user", userID, "", userSnapshot, func() error {
+			if _, err := tx.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, userID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`DELETE FROM moderator_categories WHERE user_id = ?`, userID); err != nil {
+				return err
+			}
+			if role != models.RoleModerator {
+				return nil
+			}
+			for _, id := range categoryIDs {
+				_, err := tx.Exec(`INSERT INTO moderator_categories(user_id, category_id) VALUES (?, ?)`, userID, id)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// SetPostLocked locks or unlocks a post, if userID may moderate its
+// category, and records this in the audit log with the given reason.
+// Returns sql.ErrNoRows if there is no such post or the user may not
+// moderate it.
+func SetPostLocked(db *sql.DB, postID, userID int, locked bool, reason string) error {
+	action := AuditPostUnlock
+	if locked {
+		action = AuditPostLock
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		return auditChange(tx, userID, action, "post", postID, reason, postSnapshot, func() error {
+			res, err := tx.Exec(`
+				UPDATE posts
+				SET locked_at = CASE WHEN ? THEN COALESCE(locked_at, CURRENT_TIMESTAMP) END
+				WHERE id = ? AND `+canModerate("posts.category_id"),
+				locked, postID, userID)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+	})
+}
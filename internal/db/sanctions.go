@@ -0,0 +1,136 @@
+package db
+
+import (
+	"database/sql"
+	"literary-lions/internal/models"
+	"time"
+)
+
+// Sanction kinds. A ban logs the user out everywhere and keeps them from
+// logging in; a suspension lets them read but not post, comment or like.
+const (
+	SanctionBan        = "ban"
+	SanctionSuspension = "suspension"
+)
+
+// activeSanction is the condition for a sanction in force over "s".
+const activeSanction = `s.lifted_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)`
+
+// sanctionColumns and scanSanction read a sanction over "user_sanctions s",
+// joined with its user "u" and the staff member who imposed it "cb".
+const sanctionColumns = `
+	s.id, s.user_id, u.username, s.kind, s.reason, COALESCE(cb.username, ''),
+	s.created_at, s.expires_at, s.notified_at IS NOT NULL`
+
+const sanctionJoins = `
+	JOIN users u ON u.id = s.user_id
+	LEFT JOIN users cb ON cb.id = s.created_by`
+
+func scanSanction(row interface{ Scan(...any) error }) (models.Sanction, error) {
+	var (
+		s       models.Sanction
+		expires sql.NullTime
+	)
+	err := row.Scan(&s.ID, &s.UserID, &s.Username, &s.Kind, &s.Reason, &s.CreatedBy,
+		&s.CreatedAt, &expires, &s.Notified)
+	s.ExpiresAt = expires.Time
+	return s, err
+}
+
+// SanctionUser bans or suspends a member (staff cannot be sanctioned) until
+// expires, or until lifted if expires is zero, and records this in the
+// audit log as done by actorID. The user is logged out by the session
+// middleware on their next request.
+// Returns sql.ErrNoRows if there is no such member.
+func SanctionUser(db *sql.DB, userID, actorID int, kind, reason string, expires time.Time) error {
+	action := AuditUserSuspend
+	if kind == SanctionBan {
+		action = AuditUserBan
+	}
+	var expiresAt any
+	if !expires.IsZero() {
+		expiresAt = expires.UTC().Format(timestampLayout)
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		var isMember bool
+		err := tx.QueryRow(`SELECT role = 'member' FROM users WHERE id = ?`, userID).Scan(&isMember)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return sql.ErrNoRows
+		}
+		return auditChange(tx, actorID, action, "user", userID, reason, userSnapshot, func() error {
+			_, err := tx.Exec(`
+				INSERT INTO user_sanctions (user_id, kind, reason, created_by, expires_at)
+				VALUES (?, ?, ?, ?, ?)`, userID, kind, reason, actorID, expiresAt)
+			return err
+		})
+	})
+}
+
+// ActiveSanction returns the sanction in force for the user, if any: a ban
+// before a suspension, and the longest-lasting of each.
+func ActiveSanction(db *sql.DB, userID int) (models.Sanction, bool, error) {
+	s, err := scanSanction(db.QueryRow(`
+		SELECT `+sanctionColumns+`
+		FROM user_sanctions s `+sanctionJoins+`
+		WHERE s.user_id = ? AND `+activeSanction+`
+		ORDER BY s.kind = 'ban' DESC, s.expires_at IS NULL DESC, s.expires_at DESC
+		LIMIT 1`, userID))
+	if err == sql.ErrNoRows {
+		return s, false, nil
+	}
+	return s, err == nil, err
+}
+
+// FetchActiveSanctions returns every sanction in force, newest first.
+func FetchActiveSanctions(db *sql.DB) ([]models.Sanction, error) {
+	rows, err := db.Query(`
+		SELECT ` + sanctionColumns + `
+		FROM user_sanctions s ` + sanctionJoins + `
+		WHERE ` + activeSanction + `
+		ORDER BY s.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []models.Sanction
+	for rows.Next() {
+		s, err := scanSanction(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// MarkSanctionNotified records that the user has seen the notice about a
+// sanction.
+func MarkSanctionNotified(db *sql.DB, id int) error {
+	_, err := db.Exec(`UPDATE user_sanctions SET notified_at = CURRENT_TIMESTAMP WHERE id = ? AND notified_at IS NULL`, id)
+	return err
+}
+
+// LiftSanction ends a sanction early, if actorID imposed it or is an admin,
+// and records this in the audit log with the given reason.
+// Returns sql.ErrNoRows if there is no such sanction in force or the actor
+// may not lift it.
+func LiftSanction(db *sql.DB, id, actorID int, reason string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		var userID int
+		err := tx.QueryRow(`
+			SELECT s.user_id FROM user_sanctions s
+			WHERE s.id = ? AND `+activeSanction+`
+			  AND (s.created_by = ? OR EXISTS (SELECT 1 FROM users WHERE id = ? AND role = 'admin'))`,
+			id, actorID, actorID).Scan(&userID)
+		if err != nil {
+			return err
+		}
+		return auditChange(tx, actorID, AuditUserLift, "user", userID, reason, userSnapshot, func() error {
+			_, err := tx.Exec(`UPDATE user_sanctions SET lifted_at = CURRENT_TIMESTAMP, lifted_by = ? WHERE id = ?`, actorID, id)
+			return err
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestActiveSanctionExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires string // SQLite datetime modifier relative to now, "" for none
+		lifted  bool
+		active  bool
+	}{
+		{"until lifted", "", false, true},
+		{"lifted", "", true, false},
+		{"expires in a minute", "+60 seconds", false, true},
+		{"expires in two seconds", "+2 seconds", false, true},
+		{"expires now", "+0 seconds", false, false},
+		{"expired a second ago", "-1 seconds", false, false},
+		{"expired yesterday", "-1 days", false, false},
+		{"lifted before expiring", "+1 days", true, false},
+	}
+	dbConn := newTestDB(t)
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := addUser(t, dbConn, fmt.Sprintf("member%d", i))
+			_, err := dbConn.Exec(`
+				INSERT INTO user_sanctions (user_id, kind, expires_at, lifted_at)
+				VALUES (?1, 'suspension',
+				        CASE WHEN ?2 = '' THEN NULL ELSE datetime('now', ?2) END,
+				        CASE WHEN ?3 THEN CURRENT_TIMESTAMP END)`,
+				userID, tt.expires, tt.lifted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, active, err := ActiveSanction(dbConn, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if active != tt.active {
+				t.Errorf("active = %v, want %v", active, tt.active)
+			}
+		})
+	}
+}
+
+func TestSanctionUserExpiry(t *testing.T) {
+	dbConn := newTestDB(t)
+	admin := addUser(t, dbConn, "admin")
+	// Expiry times in any zone are compared with SQLite's UTC clock
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	tests := []struct {
+		name    string
+		expires time.Time
+		active  bool
+	}{
+		{"until lifted", time.Time{}, true},
+		{"in an hour", time.Now().Add(time.Hour).In(zone), true},
+		{"in two seconds", time.Now().Add(2 * time.Second), true},
+		{"a second ago", time.Now().Add(-time.Second).In(zone), false},
+		{"an hour ago", time.Now().Add(-time.Hour), false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := addUser(t, dbConn, fmt.Sprintf("member%d", i))
+			if err := SanctionUser(dbConn, userID, admin, SanctionSuspension, "test", tt.expires); err != nil {
+				t.Fatal(err)
+			}
+			s, active, err := ActiveSanction(dbConn, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if active != tt.active {
+				t.Fatalf("active = %v, want %v", active, tt.active)
+			}
+			if active && !s.ExpiresAt.Equal(tt.expires.Truncate(time.Second)) {
+				t.Errorf("ExpiresAt = %v, want %v", s.ExpiresAt, tt.expires.Truncate(time.Second))
+			}
+		})
+	}
+}
+
+func TestActiveSanctionPrecedence(t *testing.T) {
+	dbConn := newTestDB(t)
+	admin := addUser(t, dbConn, "admin")
+	userID := addUser(t, dbConn, "member")
+	sanction := func(kind string, expires time.Time) {
+		t.Helper()
+		if err := SanctionUser(dbConn, userID, admin, kind, kind, expires); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(kind string, expires time.Time) {
+		t.Helper()
+		s, active, err := ActiveSanction(dbConn, userID)
+		if err != nil || !active {
+			t.Fatalf("ActiveSanction = %v, %v", active, err)
+		}
+		if s.Kind != kind || !s.ExpiresAt.Equal(expires.Truncate(time.Second)) {
+			t.Errorf("got %s until %v, want %s until %v", s.Kind, s.ExpiresAt, kind, expires.Truncate(time.Second))
+		}
+	}
+
+	day := time.Now().Add(24 * time.Hour)
+	week := time.Now().Add(7 * 24 * time.Hour)
+	sanction(SanctionSuspension, week)
+	sanction(SanctionSuspension, day)
+	check(SanctionSuspension, week) // the longest-lasting
+	sanction(SanctionBan, day)
+	check(SanctionBan, day) // a ban before any suspension
+	sanction(SanctionBan, time.Time{})
+	check(SanctionBan, time.Time{}) // until lifted outlasts any date
+}
@@ -0,0 +1,360 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/internal/models"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Full-text search uses an FTS5 table, posts_fts, with one row per post
+// (rowid = post ID) holding its title, its content and the text of all its
+// live comments, kept in sync by triggers. go-sqlite3 only includes FTS5
+// when built with the sqlite_fts5 tag, so the table is set up at startup
+// by EnsureSearchIndex rather than by a migration; without FTS5, search
+// falls back to LIKE matching.
+
+// Search snippets wrap every match in these control characters;
+// views.Highlight turns them into <mark> tags after escaping the text.
+const (
+	SnippetOpen  = "\x02"
+	SnippetClose = "\x03"
+)
+
+// snippetWords is roughly how many words a search snippet shows.
+const snippetWords = 24
+
+const ftsSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+		title, content, comments,
+		tokenize = 'unicode61 remove_diacritics 2'
+	)`
+
+// liveComments is the text indexed for a post's comments; removed comments
+// are left out.
+const liveComments = `COALESCE((
+	SELECT group_concat(content, ' ') FROM comments
+	WHERE post_id = %s AND deleted_at IS NULL), '')`
+
+var ftsTriggerNames = []string{
+	"posts_fts_insert", "posts_fts_update", "posts_fts_delete",
+	"comments_fts_insert", "comments_fts_update", "comments_fts_delete",
+}
+
+var ftsTriggers = `
+	CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+		INSERT INTO posts_fts(rowid, title, content, comments)
+		VALUES (NEW.id, NEW.title, NEW.content, '');
+	END;
+	CREATE TRIGGER posts_fts_update AFTER UPDATE OF title, content ON posts BEGIN
+		UPDATE posts_fts SET title = NEW.title, content = NEW.content WHERE rowid = NEW.id;
+	END;
+	CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+		DELETE FROM posts_fts WHERE rowid = OLD.id;
+	END;
+	CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments BEGIN
+		UPDATE posts_fts SET comments = ` + fmt.Sprintf(liveComments, "NEW.post_id") + `
+		WHERE rowid = NEW.post_id;
+	END;
+	CREATE TRIGGER comments_fts_update AFTER UPDATE OF content, deleted_at ON comments BEGIN
+		UPDATE posts_fts SET comments = ` + fmt.Sprintf(liveComments, "NEW.post_id") + `
+		WHERE rowid = NEW.post_id;
+	END;
+	CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments BEGIN
+		UPDATE posts_fts SET comments = ` + fmt.Sprintf(liveComments, "OLD.post_id") + `
+		WHERE rowid = OLD.post_id;
+	END;`
+
+// EnsureSearchIndex sets up the full-text index and its triggers. If the
+// triggers were missing (first start, or the server last ran without FTS5)
+// the index is rebuilt from scratch. Without FTS5 it drops the triggers, so
+// writing posts and comments keeps working, and search uses LIKE instead.
+// Reports whether full-text search is available.
+func EnsureSearchIndex(db *sql.DB) (bool, error) {
+	var hasFTS5 bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&hasFTS5); err != nil {
+		return false, err
+	}
+	if !hasFTS5 {
+		return false, dropSearchTriggers(db)
+	}
+
+	if _, err := db.Exec(ftsSchema); err != nil {
+		return false, err
+	}
+	names := make([]any, len(ftsTriggerNames))
+	for i, name := range ftsTriggerNames {
+		names[i] = name
+	}
+	var n int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'trigger' AND name IN (`+placeholders(len(names))+`)`, names...).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	if n != len(ftsTriggerNames) {
+		err := inTx(db, func(tx *sql.Tx) error {
+			if err := dropSearchTriggers(tx); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ftsTriggers); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`DELETE FROM posts_fts`); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`
+				INSERT INTO posts_fts(rowid, title, content, comments)
+				SELECT p.id, p.title, p.content, ` + fmt.Sprintf(liveComments, "p.id") + `
+				FROM posts p`)
+			return err
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// dropSearchTriggers removes the triggers feeding posts_fts.
+func dropSearchTriggers(ex execer) error {
+	for _, name := range ftsTriggerNames {
+		if _, err := ex.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchOpts selects one page of search results; Page counts from 1.
+// Relevance order has no stable key to seek from, so unlike the other
+// listings search results are paged by offset. FullText is what
+// EnsureSearchIndex reported: whether posts_fts can be searched.
+type SearchOpts struct {
+	Page     int
+	Limit    int
+	FullText bool
+}
+
+// SearchResults is one page of search results, and whether more follow.
+type SearchResults struct {
+	Posts []models.Post
+	More  bool
+}
+
+// PostSearch is what to search for. Every field that is set must match.
+type PostSearch struct {
+	Words    []string  // each appears (as a word prefix) in the title, content or a comment
+	Phrases  []string  // each appears as-is in the title, content or a comment
+	Tags     []string  // hashtags the post carries
+	Author   string    // author's username, case-insensitive
+	Category string    // category name, case-insensitive
+	Before   time.Time // created before this instant
+	After    time.Time // created at or after this instant
+	LikesOp  string    // compare the like count: > >= < <= =
+	Likes    int
+	Sort     string // "relevance" (the default), "new", "old" or "top"
+}
+
+// likesOps are the comparisons allowed in PostSearch.LikesOp.
+var likesOps = map[string]bool{">": true, ">=": true, "<": true, "<=": true, "=": true}
+
+// SearchPosts finds the posts matching s. With full-text search and some
+// words or phrases, the best matches come first by default, each with a
+// Snippet of its content (or of a comment, if only a comment matched);
+// otherwise "relevance" means newest first and snippets come from the content.
+func SearchPosts(db *sql.DB, s PostSearch, viewerID int, opts SearchOpts) (SearchResults, error) {
+	var res SearchResults
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+	offset := max(opts.Page-1, 0) * opts.Limit
+	useFTS := opts.FullText && len(s.Words)+len(s.Phrases) > 0
+
+	args := []any{viewerID}
+	var conds []string
+	if useFTS {
+		conds = append(conds, "posts_fts MATCH ?")
+		args = append(args, ftsQuery(s.Words, s.Phrases))
+	} else {
+		for _, w := range append(slices.Clone(s.Words), s.Phrases...) {
+			conds = append(conds, `(
+				p.title LIKE ? ESCAPE '\' OR p.content LIKE ? ESCAPE '\'
+				OR EXISTS (
+					SELECT 1 FROM comments cm
+					WHERE cm.post_id = p.id AND cm.deleted_at IS NULL
+					  AND cm.content LIKE ? ESCAPE '\'))`)
+			pattern := "%" + likeEscaper.Replace(w) + "%"
+			args = append(args, pattern, pattern, pattern)
+		}
+	}
+	conds, args = appendTagConds(conds, args, s.Tags)
+	if s.Author != "" {
+		conds = append(conds, "p.user_id IN (SELECT id FROM users WHERE username = ? COLLATE NOCASE)")
+		args = append(args, s.Author)
+	}
+	if s.Category != "" {
+		conds = append(conds, "p.category_id IN (SELECT COALESCE(merged_into_id, id) FROM categories WHERE name = ? COLLATE NOCASE)")
+		args = append(args, s.Category)
+	}
+	if !s.Before.IsZero() {
+		conds = append(conds, "p.created_at < ?")
+		args = append(args, s.Before.UTC().Format(timestampLayout))
+	}
+	if !s.After.IsZero() {
+		conds = append(conds, "p.created_at >= ?")
+		args = append(args, s.After.UTC().Format(timestampLayout))
+	}
+	if s.LikesOp != "" {
+		if !likesOps[s.LikesOp] {
+			return res, fmt.Errorf("invalid likes comparison %q", s.LikesOp)
+		}
+		conds = append(conds, "p.like_count "+s.LikesOp+" ?")
+		args = append(args, s.Likes)
+	}
+
+	var order string
+	switch s.Sort {
+	case "new":
+		order = "p.created_at DESC, p.id DESC"
+	case "old":
+		order = "p.created_at ASC, p.id ASC"
+	case "top":
+		order = "p.like_count DESC, p.created_at DESC, p.id DESC"
+	case "", "relevance":
+		order = "p.created_at DESC, p.id DESC"
+		if useFTS {
+			order = "bm25(posts_fts, 10.0, 4.0, 1.0), p.id DESC"
+		}
+	default:
+		return res, fmt.Errorf("invalid sort order %q", s.Sort)
+	}
+
+	var query string
+	if useFTS {
+		query = `
+			SELECT ` + postColumns + `,
+				snippet(posts_fts, 1, char(2), char(3), '…', ` + strconv.Itoa(snippetWords) + `),
+				snippet(posts_fts, 2, char(2), char(3), '…', ` + strconv.Itoa(snippetWords) + `)
+			FROM posts_fts
+			JOIN posts p ON p.id = posts_fts.rowid ` + postJoins
+	} else {
+		query = `
+			SELECT ` + postColumns + `, '', ''
+			FROM posts p ` + postJoins
+	}
+	query += `
+		` + whereClause(conds) + `
+		ORDER BY ` + order + `
+		LIMIT ? OFFSET ?`
+	// One extra row tells whether there is another page
+	args = append(args, opts.Limit+1, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contentSnippet, commentSnippet string
+		p, err := scanPost(rows, &contentSnippet, &commentSnippet)
+		if err != nil {
+			return res, err
+		}
+		switch {
+		case strings.Contains(contentSnippet, SnippetOpen):
+			p.Snippet = contentSnippet
+		case strings.Contains(commentSnippet, SnippetOpen):
+			p.Snippet = commentSnippet
+			p.SnippetInComment = true
+		case contentSnippet != "":
+			p.Snippet = contentSnippet
+		default:
+			p.Snippet = likeSnippet(p.Content, append(slices.Clone(s.Words), s.Phrases...))
+		}
+		res.Posts = append(res.Posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+	if len(res.Posts) > opts.Limit {
+		res.Posts = res.Posts[:opts.Limit]
+		res.More = true
+	}
+	return res, AttachHashtags(db, res.Posts)
+}
+
+// hashtagCond restricts a listing to posts carrying the hashtag given as argument.
+const hashtagCond = `p.id IN (
+	SELECT ph.post_id FROM post_hashtags ph JOIN hashtags h ON h.id = ph.hashtag_id
+	WHERE h.name = ?)`
+
+// appendTagConds adds one hashtagCond per tag.
+func appendTagConds(conds []string, args []any, tags []string) ([]string, []any) {
+	for _, t := range tags {
+		conds = append(conds, hashtagCond)
+		args = append(args, t)
+	}
+	return conds, args
+}
+
+// ftsQuery turns search words and phrases into an FTS5 query matching posts
+// that contain all the words as word prefixes and all the phrases as-is.
+// Everything is quoted, so FTS5 syntax typed by users is searched for
+// literally instead of causing errors.
+func ftsQuery(words, phrases []string) string {
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` }
+	var terms []string
+	for _, w := range words {
+		terms = append(terms, quote(w)+"*")
+	}
+	for _, p := range phrases {
+		terms = append(terms, quote(p))
+	}
+	return strings.Join(terms, " ")
+}
+
+// likeEscaper escapes LIKE wildcards for use with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likeSnippet cuts about snippetWords words out of text around the first
+// occurrence of any of words, marking every occurrence, like FTS5's snippet().
+func likeSnippet(text string, words []string) string {
+	fields := strings.Fields(text)
+	var re *regexp.Regexp
+	if len(words) > 0 {
+		quoted := make([]string, len(words))
+		for i, w := range words {
+			quoted[i] = regexp.QuoteMeta(w)
+		}
+		re = regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	}
+
+	start := 0
+	if re != nil {
+		for i, f := range fields {
+			if re.MatchString(f) {
+				start = max(i-snippetWords/4, 0)
+				break
+			}
+		}
+	}
+	end := min(start+snippetWords, len(fields))
+	s := strings.Join(fields[start:end], " ")
+	if re != nil {
+		s = re.ReplaceAllString(s, SnippetOpen+"$0"+SnippetClose)
+	}
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(fields) {
+		s += "…"
+	}
+	return s
+}
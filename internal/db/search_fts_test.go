@@ -0,0 +1,72 @@
+//go:build sqlite_fts5
+
+package db
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchPostsFullText(t *testing.T) {
+	dbConn := newTestDB(t)
+	fts, err := EnsureSearchIndex(dbConn)
+	if err != nil || !fts {
+		t.Fatalf("EnsureSearchIndex = %v, %v", fts, err)
+	}
+	ann := addUser(t, dbConn, "ann")
+	var category int
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	newPost := func(title, content string) int {
+		t.Helper()
+		id, err := CreatePost(dbConn, ann, category, title, content, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	// Best match first, so that newest-first order would be the reverse
+	inTitle := newPost("The dragon of the coast", "We sailed along the coast for a week.")
+	inContent := newPost("Notes on a journey", "We met a dragon along the coast for a week.")
+	inComment := newPost("Notes on a voyage", "We sailed along the coast for a week.")
+	newPost("Notes on nothing", "Nothing happened along the coast that week.")
+	if _, err := AddComment(dbConn, inComment, ann, 0, "There was a dragon in the harbour."); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := SearchPosts(dbConn, PostSearch{Words: []string{"drag"}}, ann, SearchOpts{FullText: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, p := range res.Posts {
+		got = append(got, p.ID)
+	}
+	// bm25 weighs the title over the content over the comments
+	if want := []int{inTitle, inContent, inComment}; !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v (title, content, comment)", got, want)
+	}
+
+	highlighted := SnippetOpen + "dragon" + SnippetClose
+	if p := res.Posts[1]; !strings.Contains(p.Snippet, highlighted) || p.SnippetInComment {
+		t.Errorf("content match: snippet %q, in comment %v", p.Snippet, p.SnippetInComment)
+	}
+	if p := res.Posts[2]; !strings.Contains(p.Snippet, highlighted) || !p.SnippetInComment {
+		t.Errorf("comment match: snippet %q, in comment %v", p.Snippet, p.SnippetInComment)
+	}
+	// Only the title matched: the snippet is the start of the content
+	if p := res.Posts[0]; strings.Contains(p.Snippet, SnippetOpen) || !strings.HasPrefix(p.Snippet, "We sailed") {
+		t.Errorf("title match: snippet %q", p.Snippet)
+	}
+
+	// A phrase matches its words in order only
+	res, err = SearchPosts(dbConn, PostSearch{Phrases: []string{"met a dragon"}}, ann, SearchOpts{FullText: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Posts) != 1 || res.Posts[0].ID != inContent {
+		t.Errorf("phrase: %d results", len(res.Posts))
+	}
+}
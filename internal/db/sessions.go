@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+	"literary-lions/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxUserAgent is how much of the User-Agent header is kept.
+const maxUserAgent = 255
+
+// CreateSession logs the user in from the given browser and address until
+// ttl from now, and returns the new session's ID. csrfToken is the secret
+// its forms must send back.
+func CreateSession(db *sql.DB, userID int, csrfToken, userAgent, ip string, ttl time.Duration) (string, error) {
+	if len(userAgent) > maxUserAgent {
+		userAgent = userAgent[:maxUserAgent]
+	}
+	id := uuid.NewString()
+	_, err := db.Exec(`
+		INSERT INTO sessions(id, user_id, expires_at, csrf_token, user_agent, ip, created_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		id, userID, time.Now().Add(ttl), csrfToken, userAgent, ip)
+	return id, err
+}
+
+// TouchSession records that the session was just used from ip.
+func TouchSession(db *sql.DB, id, ip string) error {
+	_, err := db.Exec(`UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP, ip = ? WHERE id = ?`, ip, id)
+	return err
+}
+
+// sessionHandle returns the handle that stands for a session ID in pages
+// and forms, so that the ID (which logs its holder in) is never shown.
+func sessionHandle(id string) string {
+	return hashToken(id)[:32]
+}
+
+// UserSessions returns the user's unexpired sessions, most recently used
+// first, marking currentID as the current one.
+func UserSessions(db *sql.DB, userID int, currentID string) ([]models.Session, error) {
+	rows, err := db.Query(`
+		SELECT id, user_agent, ip, created_at, last_seen_at, expires_at
+		FROM sessions WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var (
+			s                 models.Session
+			id                string
+			created, lastSeen sql.NullTime
+		)
+		if err := rows.Scan(&id, &s.UserAgent, &s.IP, &created, &lastSeen, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		s.Handle = sessionHandle(id)
+		s.CreatedAt, s.LastSeenAt = created.Time, lastSeen.Time
+		s.Current = id == currentID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// EndSession logs the user out of the session with the given handle (see
+// UserSessions) and returns its ID. Returns sql.ErrNoRows if the user has
+// no such session.
+func EndSession(db *sql.DB, userID int, handle string) (string, error) {
+	rows, err := db.Query(`SELECT id FROM sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return "", err
+	}
+	var found string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return "", err
+		}
+		if sessionHandle(id) == handle {
+			found = id
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", sql.ErrNoRows
+	}
+	_, err = db.Exec(`DELETE FROM sessions WHERE id = ?`, found)
+	return found, err
+}
+
+// EndSessions logs a user out everywhere.
+func EndSessions(db *sql.DB, userID int) error {
+	_, err := db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+// PurgeExpiredSessions removes sessions that have expired, and returns how
+// many there were.
+func PurgeExpiredSessions(db *sql.DB) (int64, error) {
+	res, err := db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,38 @@
+package db
+
+import "database/sql"
+
+// Site settings (see the settings table).
+const (
+	// SettingRequireStaff2FA is "1" when moderators and admins must use
+	// two-factor authentication.
+	SettingRequireStaff2FA = "require_staff_2fa"
+)
+
+// Setting returns the value of a site setting ("" if it is not set).
+func Setting(db *sql.DB, key string) (string, error) {
+	var v string
+	err := db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return v, err
+}
+
+// SetSetting changes a site setting and records this in the audit log as
+// done by actorID.
+func SetSetting(db *sql.DB, actorID int, key, value string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRow(`
+			INSERT INTO settings(key, value) VALUES (?, '') ON CONFLICT(key) DO UPDATE SET key = key
+			RETURNING id`, key).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return auditChange(tx, actorID, AuditSettingUpdate, "setting", id, "", settingSnapshot, func() error {
+			_, err := tx.Exec(`UPDATE settings SET value = ? WHERE id = ?`, value, id)
+			return err
+		})
+	})
+}
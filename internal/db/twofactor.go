@@ -0,0 +1,199 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// TwoFactorEnabled reports whether the user has confirmed TOTP enrolment.
+func TwoFactorEnabled(db *sql.DB, userID int) (bool, error) {
+	var on bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = ? AND confirmed_at IS NOT NULL)`,
+		userID).Scan(&on)
+	return on, err
+}
+
+// StartTOTPEnrolment returns the secret of the user's unconfirmed
+// enrolment, starting one with the given secret if there is none.
+// Returns sql.ErrNoRows if two-factor authentication is already on.
+func StartTOTPEnrolment(db *sql.DB, userID int, secret string) (string, error) {
+	var pending string
+	err := inTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO user_totp(user_id, secret) VALUES (?, ?) ON CONFLICT(user_id) DO NOTHING`,
+			userID, secret)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRow(`SELECT secret FROM user_totp WHERE user_id = ? AND confirmed_at IS NULL`, userID).
+			Scan(&pending)
+	})
+	return pending, err
+}
+
+// TOTPSecret returns the secret of the user's confirmed or, if pending is
+// set, unconfirmed enrolment. Returns sql.ErrNoRows if there is none.
+func TOTPSecret(db *sql.DB, userID int, pending bool) (string, error) {
+	var secret string
+	err := db.QueryRow(`SELECT secret FROM user_totp WHERE user_id = ? AND (confirmed_at IS NULL) = ?`,
+		userID, pending).Scan(&secret)
+	return secret, err
+}
+
+// ConfirmTOTP turns on two-factor authentication for the user, whose
+// enrolment was confirmed with the code of the given time step, and sets
+// their recovery codes. Returns sql.ErrNoRows if there is no enrolment
+// waiting for confirmation.
+func ConfirmTOTP(db *sql.DB, userID int, step int64, recoveryCodes []string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			UPDATE user_totp SET confirmed_at = CURRENT_TIMESTAMP, last_step = ?
+			WHERE user_id = ? AND confirmed_at IS NULL`, step, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return setRecoveryCodes(tx, userID, recoveryCodes)
+	})
+}
+
+// UseTOTPStep records that a code of the given time step was accepted for
+// the user. It reports false if a code of that step or a later one was
+// accepted before, so a code seen by someone else can't be replayed.
+func UseTOTPStep(db *sql.DB, userID int, step int64) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE user_totp SET last_step = ?
+		WHERE user_id = ? AND confirmed_at IS NOT NULL AND last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DisableTwoFactor turns off two-factor authentication for the user and
+// removes their recovery codes.
+func DisableTwoFactor(db *sql.DB, userID int) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+		return err
+	})
+}
+
+// normalizeRecoveryCode makes typing mistakes in case, spaces and dashes
+// not matter.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
+
+// setRecoveryCodes replaces the user's recovery codes.
+func setRecoveryCodes(tx *sql.Tx, userID int, codes []string) error {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, c := range codes {
+		_, err := tx.Exec(`INSERT INTO recovery_codes(user_id, code_hash) VALUES (?, ?)`,
+			userID, hashToken(normalizeRecoveryCode(c)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes gives the user a new set of recovery codes; the old
+// ones stop working.
+func ReplaceRecoveryCodes(db *sql.DB, userID int, codes []string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		return setRecoveryCodes(tx, userID, codes)
+	})
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes, reporting
+// false if code is not one of them or was used before.
+func UseRecoveryCode(db *sql.DB, userID int, code string) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes the user has.
+func RecoveryCodesLeft(db *sql.DB, userID int) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+// CreateLoginChallenge records that the user got their password right and
+// must now give a second factor, within ttl. It returns the token that
+// identifies the challenge (only its hash is kept).
+func CreateLoginChallenge(db *sql.DB, userID int, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	err = inTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM login_challenges WHERE expires_at <= ?`, now.Format(timestampLayout))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO login_challenges(token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+			hash, userID, now.Add(ttl).Format(timestampLayout))
+		return err
+	})
+	return token, err
+}
+
+// LoginChallengeUser returns the ID, name and email address of the user a
+// login challenge is for. Returns sql.ErrNoRows if it is unknown or has
+// expired.
+func LoginChallengeUser(db *sql.DB, token string) (id int, username, email string, err error) {
+	err = db.QueryRow(`
+		SELECT u.id, u.username, u.email FROM login_challenges lc JOIN users u ON u.id = lc.user_id
+		WHERE lc.token_hash = ? AND lc.expires_at > ?`,
+		hashToken(token), time.Now().UTC().Format(timestampLayout)).Scan(&id, &username, &email)
+	return id, username, email, err
+}
+
+// FailLoginChallenge counts a wrong code against a login challenge and
+// returns how many attempts are left; at none the challenge is removed,
+// and the user has to start again with their password.
+func FailLoginChallenge(db *sql.DB, token string, maxAttempts int) (int, error) {
+	hash := hashToken(token)
+	var attempts int
+	err := inTx(db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ? RETURNING attempts`,
+			hash).Scan(&attempts)
+		if err != nil {
+			return err
+		}
+		if attempts >= maxAttempts {
+			_, err = tx.Exec(`DELETE FROM login_challenges WHERE token_hash = ?`, hash)
+		}
+		return err
+	})
+	return max(maxAttempts-attempts, 0), err
+}
+
+// EndLoginChallenge removes a login challenge once it has been met.
+func EndLoginChallenge(db *sql.DB, token string) error {
+	_, err := db.Exec(`DELETE FROM login_challenges WHERE token_hash = ?`, hashToken(token))
+	return err
+}
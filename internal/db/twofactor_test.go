@@ -0,0 +1,73 @@
+package db
+
+import "testing"
+
+func TestUseTOTPStep(t *testing.T) {
+	dbConn := newTestDB(t)
+	userID := addUser(t, dbConn, "ann")
+	if _, err := StartTOTPEnrolment(dbConn, userID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	// Not usable until the enrolment is confirmed
+	if ok, err := UseTOTPStep(dbConn, userID, 99); err != nil || ok {
+		t.Fatalf("before confirming: %v, %v", ok, err)
+	}
+	if err := ConfirmTOTP(dbConn, userID, 100, []string{"aaaa-bbbb"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		step int64
+		ok   bool
+	}{
+		{100, false}, // the code that confirmed the enrolment
+		{99, false},  // an earlier code
+		{101, true},
+		{101, false}, // replayed
+		{100, false},
+		{103, true},
+		{102, false}, // older than the last one used
+		{104, true},
+	}
+	for _, tt := range tests {
+		ok, err := UseTOTPStep(dbConn, userID, tt.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok {
+			t.Errorf("UseTOTPStep(%d) = %v, want %v", tt.step, ok, tt.ok)
+		}
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	dbConn := newTestDB(t)
+	userID := addUser(t, dbConn, "ann")
+	if _, err := StartTOTPEnrolment(dbConn, userID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConfirmTOTP(dbConn, userID, 1, []string{"abcd-efgh", "ijkl-mnop"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		code string
+		ok   bool
+	}{
+		{"wrong-code", false},
+		{"ABCD EFGH", true},  // typed differently
+		{"abcd-efgh", false}, // used up
+		{"ijkl-mnop", true},
+	}
+	for _, tt := range tests {
+		ok, err := UseRecoveryCode(dbConn, userID, tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok {
+			t.Errorf("UseRecoveryCode(%q) = %v, want %v", tt.code, ok, tt.ok)
+		}
+	}
+	if n, err := RecoveryCodesLeft(dbConn, userID); err != nil || n != 0 {
+		t.Errorf("RecoveryCodesLeft = %d, %v", n, err)
+	}
+}
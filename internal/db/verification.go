@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrEmailTaken is returned when an address is already another account's.
+var ErrEmailTaken = errors.New("email address in use")
+
+// CreateEmailVerification issues a token confirming that email belongs to
+// the user, valid for ttl, and returns it (only its hash is kept).
+// Returns ErrTooSoon if one was issued less than a minute ago.
+func CreateEmailVerification(db *sql.DB, userID int, email string, ttl time.Duration) (string, error) {
+	return createVerification(db, userID, email, false, ttl)
+}
+
+// CreateEmailChange is like CreateEmailVerification, for a new address the
+// user wants to switch to: following the link makes it the account's
+// (confirmed) address. Returns ErrEmailTaken if another account has it.
+func CreateEmailChange(db *sql.DB, userID int, email string, ttl time.Duration) (string, error) {
+	return createVerification(db, userID, email, true, ttl)
+}
+
+func createVerification(db *sql.DB, userID int, email string, change bool, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	err = inTx(db, func(tx *sql.Tx) error {
+		var recent, taken bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM email_verifications WHERE user_id = ? AND created_at > ?),
+			       EXISTS (SELECT 1 FROM users WHERE email = ? AND id != ?)`,
+			userID, now.Add(-linkInterval).Format(timestampLayout), email, userID).Scan(&recent, &taken)
+		if err != nil {
+			return err
+		}
+		if recent {
+			return ErrTooSoon
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+		_, err = tx.Exec(`
+			INSERT INTO email_verifications(user_id, email, token_hash, created_at, expires_at, change_email)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			userID, email, hash, now.Format(timestampLayout), now.Add(ttl).Format(timestampLayout), change)
+		return err
+	})
+	return token, err
+}
+
+// VerifyEmail marks the address a verification token was sent to as
+// confirmed (making it the user's address, for a change of address), and
+// uses up the user's outstanding tokens. Returns the user's name, or
+// sql.ErrNoRows if the token is unknown or expired, or the user's address
+// has changed since it was sent, or ErrEmailTaken if another account has
+// taken the new address meanwhile.
+func VerifyEmail(db *sql.DB, token string) (string, error) {
+	var username string
+	now := time.Now().UTC().Format(timestampLayout)
+	err := inTx(db, func(tx *sql.Tx) error {
+		var (
+			userID int
+			email  string
+			change bool
+		)
+		err := tx.QueryRow(`
+			SELECT u.id, u.username, ev.email, ev.change_email FROM email_verifications ev
+			JOIN users u ON u.id = ev.user_id AND (u.email = ev.email OR ev.change_email)
+			WHERE ev.token_hash = ? AND ev.expires_at > ?`,
+			hashToken(token), now).Scan(&userID, &username, &email, &change)
+		if err != nil {
+			return err
+		}
+		if change {
+			var taken bool
+			err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE email = ? AND id != ?)`, email, userID).Scan(&taken)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrEmailTaken
+			}
+			_, err = tx.Exec(`UPDATE users SET email = ?, email_verified_at = ? WHERE id = ?`, email, now, userID)
+			if err != nil {
+				return err
+			}
+		} else {
+			_, err = tx.Exec(`UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?`, now, userID)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`DELETE FROM email_verifications WHERE user_id = ?`, userID)
+		return err
+	})
+	return username, err
+}
+
+// PendingEmailChange returns the address the user has asked to switch to
+// and not yet confirmed ("" if none).
+func PendingEmailChange(db *sql.DB, userID int) (string, error) {
+	var email string
+	err := db.QueryRow(`
+		SELECT email FROM email_verifications
+		WHERE user_id = ? AND change_email AND expires_at > ?
+		ORDER BY created_at DESC LIMIT 1`,
+		userID, time.Now().UTC().Format(timestampLayout)).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return email, err
+}
+
+// UnverifiedEmail returns the user's email address and whether it still
+// needs confirming.
+func UnverifiedEmail(db *sql.DB, userID int) (email string, unverified bool, err error) {
+	err = db.QueryRow(`SELECT email, email_verified_at IS NULL FROM users WHERE id = ?`, userID).
+		Scan(&email, &unverified)
+	return email, unverified, err
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmailVerification(t *testing.T) {
+	dbConn := newTestDB(t)
+	userID := addUser(t, dbConn, "ann")
+
+	token, err := CreateEmailVerification(dbConn, userID, "ann@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateEmailVerification(dbConn, userID, "ann@example.com", time.Hour); !errors.Is(err, ErrTooSoon) {
+		t.Errorf("second link within a minute: %v, want ErrTooSoon", err)
+	}
+	if _, unverified, err := UnverifiedEmail(dbConn, userID); err != nil || !unverified {
+		t.Fatalf("before following the link: unverified = %v, %v", unverified, err)
+	}
+
+	for _, bad := range []string{"", "nonsense", token + "x"} {
+		if _, err := VerifyEmail(dbConn, bad); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("VerifyEmail(%q): %v, want sql.ErrNoRows", bad, err)
+		}
+	}
+	if name, err := VerifyEmail(dbConn, token); err != nil || name != "ann" {
+		t.Fatalf("VerifyEmail = %q, %v", name, err)
+	}
+	if _, unverified, err := UnverifiedEmail(dbConn, userID); err != nil || unverified {
+		t.Errorf("after following the link: unverified = %v, %v", unverified, err)
+	}
+	// A token works once
+	if _, err := VerifyEmail(dbConn, token); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("reusing the token: %v, want sql.ErrNoRows", err)
+	}
+}
+
+// A link confirms the address it was sent to, not the one the member has
+// switched to since.
+func TestEmailVerificationAddressChanged(t *testing.T) {
+	dbConn := newTestDB(t)
+	userID := addUser(t, dbConn, "ann")
+	token, err := CreateEmailVerification(dbConn, userID, "ann@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbConn.Exec(`UPDATE users SET email = 'ann@example.org' WHERE id = ?`, userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyEmail(dbConn, token); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("VerifyEmail: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestEmailVerificationExpiry(t *testing.T) {
+	tests := []struct {
+		expires time.Duration // from now
+		valid   bool
+	}{
+		{time.Hour, true},
+		{2 * time.Second, true},
+		{0, false},
+		{-time.Second, false},
+	}
+	for _, tt := range tests {
+		dbConn := newTestDB(t)
+		userID := addUser(t, dbConn, "ann")
+		token, err := CreateEmailVerification(dbConn, userID, "ann@example.com", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := time.Now().UTC().Add(tt.expires).Format(timestampLayout)
+		if _, err := dbConn.Exec(`UPDATE email_verifications SET expires_at = ?`, at); err != nil {
+			t.Fatal(err)
+		}
+		_, err = VerifyEmail(dbConn, token)
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("expiring in %v: valid = %v (%v), want %v", tt.expires, valid, err, tt.valid)
+		}
+	}
+}
+
+func TestEmailChange(t *testing.T) {
+	dbConn := newTestDB(t)
+	ann := addUser(t, dbConn, "ann")
+	bob := addUser(t, dbConn, "bob")
+
+	if _, err := CreateEmailChange(dbConn, ann, "bob@example.com", time.Hour); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("changing to bob's address: %v, want ErrEmailTaken", err)
+	}
+	token, err := CreateEmailChange(dbConn, ann, "new@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := PendingEmailChange(dbConn, ann); err != nil || pending != "new@example.com" {
+		t.Errorf("PendingEmailChange = %q, %v", pending, err)
+	}
+
+	// Bob takes the address before ann follows the link
+	if _, err := dbConn.Exec(`UPDATE users SET email = 'new@example.com' WHERE id = ?`, bob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyEmail(dbConn, token); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("VerifyEmail: %v, want ErrEmailTaken", err)
+	}
+	var email string
+	dbConn.QueryRow(`SELECT email FROM users WHERE id = ?`, ann).Scan(&email)
+	if email != "ann@example.com" {
+		t.Errorf("ann's address is %q", email)
+	}
+
+	// Once it is free again, the link still works
+	if _, err := dbConn.Exec(`UPDATE users SET email = 'bob@example.com' WHERE id = ?`, bob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyEmail(dbConn, token); err != nil {
+		t.Fatal(err)
+	}
+	var verified bool
+	dbConn.QueryRow(`SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = ?`, ann).Scan(&email, &verified)
+	if email != "new@example.com" || !verified {
+		t.Errorf("after the change: %q, verified %v", email, verified)
+	}
+	if pending, err := PendingEmailChange(dbConn, ann); err != nil || pending != "" {
+		t.Errorf("PendingEmailChange after the change = %q, %v", pending, err)
+	}
+}
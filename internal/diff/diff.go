@@ -0,0 +1,189 @@
+// Package diff computes word-level differences between two texts,
+// used to compare post revisions.
+package diff
+
+import "unicode"
+
+// Kind tells whether a Chunk is shared by both texts, only in the new one
+// or only in the old one.
+type Kind int
+
+const (
+	Equal Kind = iota
+	Insert
+	Delete
+)
+
+// Chunk is a run of text with the same Kind.
+type Chunk struct {
+	Kind Kind
+	Text string
+}
+
+// IsInsert and IsDelete are helpers for templates.
+func (c Chunk) IsInsert() bool { return c.Kind == Insert }
+func (c Chunk) IsDelete() bool { return c.Kind == Delete }
+
+// Words compares old and new word by word (whitespace is kept attached to
+// the token stream, so joining all chunks of one side gives back its text).
+// Adjacent tokens of the same kind are merged into one chunk.
+func Words(old, new string) []Chunk {
+	a, b := tokenize(old), tokenize(new)
+
+	// Strip the common prefix and suffix: edits are usually small,
+	// so this keeps the quadratic part below tiny.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var out []Chunk
+	add := func(k Kind, text string) {
+		if n := len(out); n > 0 && out[n-1].Kind == k {
+			out[n-1].Text += text
+			return
+		}
+		out = append(out, Chunk{Kind: k, Text: text})
+	}
+
+	for _, t := range a[:pre] {
+		add(Equal, t)
+	}
+	lcsDiff(a[pre:len(a)-suf], b[pre:len(b)-suf], add)
+	for _, t := range a[len(a)-suf:] {
+		add(Equal, t)
+	}
+	return out
+}
+
+// maxCost caps the work of comparing the changed middle parts of two
+// texts (the product of their lengths in tokens). Past it, the middle is
+// shown as deleted and inserted as a whole rather than compared.
+const maxCost = 1 << 26
+
+// lcsDiff emits the edit script between a and b along a longest common
+// subsequence, found with Hirschberg's algorithm: it takes time
+// proportional to len(a)*len(b) but only linear memory.
+func lcsDiff(a, b []string, add func(Kind, string)) {
+	if len(a)*len(b) > maxCost {
+		for _, t := range a {
+			add(Delete, t)
+		}
+		for _, t := range b {
+			add(Insert, t)
+		}
+		return
+	}
+	hirschberg(a, b, add)
+}
+
+func hirschberg(a, b []string, add func(Kind, string)) {
+	switch {
+	case len(a) == 0:
+		for _, t := range b {
+			add(Insert, t)
+		}
+		return
+	case len(b) == 0:
+		for _, t := range a {
+			add(Delete, t)
+		}
+		return
+	case len(a) == 1:
+		for j, t := range b {
+			if t == a[0] {
+				for _, t := range b[:j] {
+					add(Insert, t)
+				}
+				add(Equal, t)
+				for _, t := range b[j+1:] {
+					add(Insert, t)
+				}
+				return
+			}
+		}
+		add(Delete, a[0])
+		for _, t := range b {
+			add(Insert, t)
+		}
+		return
+	}
+
+	// Split a in half and b where the LCS of the halves' pairs is longest
+	mid := len(a) / 2
+	fwd := lcsLengths(a[:mid], b, false)
+	rev := lcsLengths(a[mid:], b, true)
+	split, best := 0, int32(-1)
+	for j := range fwd {
+		if l := fwd[j] + rev[j]; l > best {
+			split, best = j, l
+		}
+	}
+	hirschberg(a[:mid], b[:split], add)
+	hirschberg(a[mid:], b[split:], add)
+}
+
+// lcsLengths returns, for each j, the length of the LCS of a and b[:j], or
+// with reverse, of a and b[j:]. It keeps two rows of the table only.
+func lcsLengths(a, b []string, reverse bool) []int32 {
+	m := len(b)
+	prev, cur := make([]int32, m+1), make([]int32, m+1)
+	if !reverse {
+		for i := range a {
+			for j := 1; j <= m; j++ {
+				if a[i] == b[j-1] {
+					cur[j] = prev[j-1] + 1
+				} else {
+					cur[j] = max(prev[j], cur[j-1])
+				}
+			}
+			prev, cur = cur, prev
+		}
+		return prev
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		cur[m] = 0
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				cur[j] = prev[j+1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// tokenize splits text into alternating runs of whitespace and non-whitespace.
+func tokenize(s string) []string {
+	var tokens []string
+	start := 0
+	inSpace := false
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > start && space != inSpace {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+// Changed reports whether the diff contains any insertions or deletions.
+func Changed(chunks []Chunk) bool {
+	for _, c := range chunks {
+		if c.Kind != Equal {
+			return true
+		}
+	}
+	return false
+}
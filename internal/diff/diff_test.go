@@ -0,0 +1,164 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// sides joins the chunks of each side back into the old and new texts.
+func sides(chunks []Chunk) (old, new string) {
+	var o, n strings.Builder
+	for _, c := range chunks {
+		if c.Kind != Insert {
+			o.WriteString(c.Text)
+		}
+		if c.Kind != Delete {
+			n.WriteString(c.Text)
+		}
+	}
+	return o.String(), n.String()
+}
+
+// checkWords checks that the diff of old and new gives both texts back,
+// and that its chunks are merged and not empty.
+func checkWords(t *testing.T, old, new string) []Chunk {
+	t.Helper()
+	chunks := Words(old, new)
+	if o, n := sides(chunks); o != old || n != new {
+		t.Errorf("Words(%q, %q) gives back %q and %q", old, new, o, n)
+	}
+	for i, c := range chunks {
+		if c.Text == "" {
+			t.Errorf("Words(%q, %q): chunk %d is empty", old, new, i)
+		}
+		if i > 0 && chunks[i-1].Kind == c.Kind {
+			t.Errorf("Words(%q, %q): chunks %d and %d are both of kind %d", old, new, i-1, i, c.Kind)
+		}
+	}
+	if Changed(chunks) != (old != new) {
+		t.Errorf("Words(%q, %q): Changed = %v", old, new, Changed(chunks))
+	}
+	return chunks
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     []Chunk
+	}{
+		{"", "", nil},
+		{"", "new text", []Chunk{{Insert, "new text"}}},
+		{"old text", "", []Chunk{{Delete, "old text"}}},
+		{"same", "same", []Chunk{{Equal, "same"}}},
+		{"the cat sat", "the dog sat", []Chunk{{Equal, "the "}, {Delete, "cat"}, {Insert, "dog"}, {Equal, " sat"}}},
+		{"the cat sat", "the cat sat down", []Chunk{{Equal, "the cat sat"}, {Insert, " down"}}},
+		{"a b c", "a  b c", []Chunk{{Equal, "a"}, {Delete, " "}, {Insert, "  "}, {Equal, "b c"}}},
+		{"  padded  ", "padded", []Chunk{{Delete, "  "}, {Equal, "padded"}, {Delete, "  "}}},
+		{"one\ntwo\n", "one\n\ntwo\n", []Chunk{{Equal, "one"}, {Delete, "\n"}, {Insert, "\n\n"}, {Equal, "two\n"}}},
+	}
+	for _, tt := range tests {
+		got := checkWords(t, tt.old, tt.new)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Words(%q, %q) = %q, want %q", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+// lcsLen is the length of the longest common subsequence of a and b, from
+// the full table.
+func lcsLen(a, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				table[i][j] = table[i-1][j-1] + 1
+			} else {
+				table[i][j] = max(table[i-1][j], table[i][j-1])
+			}
+		}
+	}
+	return table[len(a)][len(b)]
+}
+
+// Random edits of random texts: both sides come back from Words, and the
+// tokens hirschberg keeps equal are a longest common subsequence.
+func TestWordsRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"lion", "pride", "roar", "mane", "ÿ", ""}
+	spaces := []string{" ", "  ", "\n", "\t ", ""}
+	text := func() string {
+		var b strings.Builder
+		for n := rng.Intn(12); n > 0; n-- {
+			b.WriteString(spaces[rng.Intn(len(spaces))])
+			b.WriteString(words[rng.Intn(len(words))])
+		}
+		return b.String()
+	}
+	for i := 0; i < 2000; i++ {
+		old, new := text(), text()
+		checkWords(t, old, new)
+
+		a, b := tokenize(old), tokenize(new)
+		var gotA, gotB []string
+		equal := 0
+		hirschberg(a, b, func(k Kind, tok string) {
+			if k != Insert {
+				gotA = append(gotA, tok)
+			}
+			if k != Delete {
+				gotB = append(gotB, tok)
+			}
+			if k == Equal {
+				equal++
+			}
+		})
+		if strings.Join(gotA, "|") != strings.Join(a, "|") || strings.Join(gotB, "|") != strings.Join(b, "|") {
+			t.Errorf("hirschberg(%q, %q) gives back %q and %q", a, b, gotA, gotB)
+		}
+		if want := lcsLen(a, b); equal != want {
+			t.Errorf("hirschberg(%q, %q) keeps %d tokens equal, the LCS has %d", a, b, equal, want)
+		}
+	}
+}
+
+// Past maxCost the changed middle is replaced as a whole, even where
+// tokens (here the spaces and "shared") could have been matched.
+func TestWordsMaxCost(t *testing.T) {
+	build := func(prefix string, n int) string {
+		words := make([]string, n)
+		for i := range words {
+			words[i] = fmt.Sprintf("%s%d", prefix, i)
+		}
+		words[n/2] = "shared"
+		return strings.Join(words, " ")
+	}
+	old, new := build("old", 6000), build("new", 6000)
+	if a, b := len(tokenize(old)), len(tokenize(new)); a*b <= maxCost {
+		t.Fatalf("%d×%d tokens is within maxCost", a, b)
+	}
+	chunks := checkWords(t, "Intro. "+old+" The end.", "Intro. "+new+" The end.")
+	want := []Kind{Equal, Delete, Insert, Equal}
+	if len(chunks) != len(want) {
+		t.Fatalf("%d chunks, want %d", len(chunks), len(want))
+	}
+	for i, c := range chunks {
+		if c.Kind != want[i] {
+			t.Errorf("chunk %d is of kind %d, want %d", i, c.Kind, want[i])
+		}
+	}
+	if chunks[1].Text != old || chunks[2].Text != new {
+		t.Error("the middle is not deleted and inserted whole")
+	}
+
+	// Just under the cap, the middle is compared
+	old, new = build("old", 2000), build("new", 2000)
+	chunks = checkWords(t, old, new)
+	if len(chunks) <= 2 {
+		t.Errorf("%d chunks under maxCost", len(chunks))
+	}
+}
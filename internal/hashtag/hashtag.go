@@ -0,0 +1,76 @@
+// Package hashtag finds #hashtags in post titles and content.
+package hashtag
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MaxLen is the longest hashtag name we accept (without the '#').
+const MaxLen = 50
+
+// pattern matches '#' followed by letters, digits or underscores. The '#'
+// must start the text or follow a character that can't be part of a word
+// or URL, so "page#anchor" and "&#39;" are not tags.
+var pattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#])(#[\p{L}\p{N}_]+)`)
+
+// Match is one hashtag occurrence: Start/End are byte offsets of "#name"
+// in the text, Name is the normalised (lower-case) tag.
+type Match struct {
+	Start, End int
+	Name       string
+}
+
+// FindAll returns every valid hashtag in text, in order of appearance.
+// Tags must contain at least one letter ("#1" is a number, not a tag).
+func FindAll(text string) []Match {
+	var out []Match
+	for _, loc := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[2], loc[3]
+		name := Normalize(text[start+1 : end])
+		if name == "" {
+			continue
+		}
+		out = append(out, Match{Start: start, End: end, Name: name})
+	}
+	return out
+}
+
+// Parse returns the distinct hashtag names found in all the given texts.
+func Parse(texts ...string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, t := range texts {
+		for _, m := range FindAll(t) {
+			if !seen[m.Name] {
+				seen[m.Name] = true
+				names = append(names, m.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Normalize lower-cases a tag name (with or without a leading '#') and
+// returns "" if it is not a valid tag.
+func Normalize(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(name, "#"))
+	if name == "" || len([]rune(name)) > MaxLen {
+		return ""
+	}
+	hasLetter := false
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r) || r == '_':
+		default:
+			return ""
+		}
+	}
+	if !hasLetter {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,76 @@
+package hashtag
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFindAll(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string // the "#name" text of each match
+	}{
+		{"#books", []string{"#books"}},
+		{"Reading #Books today", []string{"#Books"}},
+		{"#one #two,#three. (#four)", []string{"#one", "#two", "#three", "#four"}},
+		{"see page#anchor", nil},
+		{"https://example.com/page#anchor", nil},
+		{"Tom&#39;s book", nil},
+		{"a/#b", nil},
+		{"##double", nil},
+		{"issue #1", nil},
+		{"#2024", nil},
+		{"#2024books", []string{"#2024books"}},
+		{"#snake_case", []string{"#snake_case"}},
+		{"#книги и #日本語", []string{"#книги", "#日本語"}},
+		{"#café", []string{"#café"}},
+		{"#٣", nil}, // Arabic-Indic digit only
+		{"#a٣", []string{"#a٣"}},
+		{"#tag-name", []string{"#tag"}},
+		{"#" + strings.Repeat("a", MaxLen), []string{"#" + strings.Repeat("a", MaxLen)}},
+		{"#" + strings.Repeat("a", MaxLen+1), nil},
+		{"# space", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range FindAll(tt.text) {
+			got = append(got, tt.text[m.Start:m.End])
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("FindAll(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	got := Parse("#Go and #GO", "more #go, #Книги and #книги", "#books")
+	if want := []string{"go", "книги", "books"}; !slices.Equal(got, want) {
+		t.Errorf("Parse = %q, want %q", got, want)
+	}
+	if got := Parse("nothing here", "#1"); got != nil {
+		t.Errorf("Parse without tags = %q", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"#Books", "books"},
+		{"books", "books"},
+		{"ÉTÉ", "été"},
+		{"#", ""},
+		{"", ""},
+		{"42", ""},
+		{"two words", ""},
+		{"a-b", ""},
+		{strings.Repeat("é", MaxLen), strings.Repeat("é", MaxLen)},
+		{strings.Repeat("é", MaxLen+1), ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.name); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
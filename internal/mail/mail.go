@@ -0,0 +1,114 @@
+// Package mail sends the forum's emails (password resets, address
+// verification) through a Mailer: SMTPMailer in production, LogMailer for
+// local development and tests.
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(m Message) error
+}
+
+// ErrHeader is returned for a message whose recipient or subject contains a
+// line break, which could be used to inject extra headers.
+var ErrHeader = errors.New("mail: line break in recipient or subject")
+
+// format renders m as an RFC 5322 message from the given sender.
+func (m Message) format(from string) ([]byte, error) {
+	if strings.ContainsAny(m.To+m.Subject+from, "\r\n") {
+		return nil, ErrHeader
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
+
+// SMTPMailer sends messages through an SMTP server. Username and Password
+// are optional; if set, PLAIN authentication is used (which net/smtp only
+// allows over TLS or to localhost).
+type SMTPMailer struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// Send delivers m through the SMTP server.
+func (s SMTPMailer) Send(m Message) error {
+	msg, err := m.format(s.From)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, s.From, []string{m.To}, msg)
+}
+
+// LogMailer doesn't send anything. It writes each message to a file in Dir
+// (named after the time and the recipient), or to the log if Dir is empty,
+// so that links in it can be followed during development and tests.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes m out.
+func (l LogMailer) Send(m Message) error {
+	msg, err := m.format(l.From)
+	if err != nil {
+		return err
+	}
+	if l.Dir == "" {
+		log.Printf("📧 Mail to %s (not sent):\n%s", m.To, msg)
+		return nil
+	}
+	if err := os.MkdirAll(l.Dir, 0o755); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + safeName(m.To) + ".eml"
+	path := filepath.Join(l.Dir, name)
+	if err := os.WriteFile(path, msg, 0o600); err != nil {
+		return err
+	}
+	log.Printf("📧 Mail to %s written to %s", m.To, path)
+	return nil
+}
+
+// safeName keeps the letters, digits and @._- of s, for a file name.
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("@._-", r):
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"literary-lions/internal/views"
+	"log"
+	"net/http"
+)
+
+// maxFormBytes bounds the body of every state-changing request, which
+// RequireCSRF has to read for the token: enough for a post with its image.
+const maxFormBytes = 10 << 20
+
+// formMemory is how much of a multipart form is held in memory while
+// parsing; the rest of an upload goes to a temporary file, which net/http
+// removes once the request is done.
+const formMemory = 1 << 20
+
+// NewCSRFToken returns a fresh random token for a new session.
+func NewCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequireCSRF is a middleware that rejects state-changing requests (anything
+// but GET, HEAD and OPTIONS) from logged-in users unless the form carries
+// their session's CSRF token, as embedded by the csrfField template helper.
+// This stops other sites from making the browser post forms here with the
+// user's session cookie. It must run inside NewWithSession.
+// Bodies are cut off at maxFormBytes, and a form that is larger gets a 413
+// before any handler sees it.
+func RequireCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+		u, ok := r.Context().Value(userKey).(sessionUser)
+		if !ok {
+			// Without a session there is nothing a forged request could act as
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Parse the whole form now, within the limits, so that handlers
+		// reading it (or its files) later find it done. ParseForm goes
+		// first: ParseMultipartForm hides its errors on plain forms.
+		err := r.ParseForm()
+		if err == nil {
+			err = r.ParseMultipartForm(formMemory)
+		}
+		if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				ErrorHandler(w, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("This form is too large: it can be at most %d MB, images included.", maxFormBytes>>20), true, u.Username)
+				return
+			}
+			ErrorHandler(w, http.StatusBadRequest, "This form could not be read.", true, u.Username)
+			return
+		}
+		sent := r.PostFormValue(views.CSRFFieldName)
+		if u.CSRFToken == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(u.CSRFToken)) != 1 {
+			log.Printf("CSRF check failed for user %s on %s %s", u.Username, r.Method, r.URL.Path)
+			ErrorHandler(w, http.StatusForbidden,
+				"This form has expired or did not come from this site. Please go back, reload the page and try again.",
+				true, u.Username)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRequireCSRF(t *testing.T) {
+	dbConn := newTestDB(t)
+	_, session := loggedIn(t, dbConn, "ann")
+
+	// multipartForm is a form with the token and an upload of size bytes.
+	multipartForm := func(token string, size int) (string, io.Reader) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("csrf_token", token)
+		fw, err := mw.CreateFormFile("image", "big.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(bytes.Repeat([]byte("x"), size))
+		mw.Close()
+		return mw.FormDataContentType(), &body
+	}
+	urlencoded := func(token string, size int) (string, io.Reader) {
+		form := url.Values{"csrf_token": {token}, "content": {strings.Repeat("x", size)}}
+		return "application/x-www-form-urlencoded", strings.NewReader(form.Encode())
+	}
+
+	tests := []struct {
+		name    string
+		form    func(token string, size int) (string, io.Reader)
+		token   string
+		size    int
+		status  int
+		reached bool
+	}{
+		{"form", urlencoded, "csrf", 10, http.StatusOK, true},
+		{"form, wrong token", urlencoded, "other", 10, http.StatusForbidden, false},
+		{"form, too large", urlencoded, "csrf", maxFormBytes, http.StatusRequestEntityTooLarge, false},
+		{"upload", multipartForm, "csrf", 3 * formMemory, http.StatusOK, true},
+		{"upload, wrong token", multipartForm, "other", 10, http.StatusForbidden, false},
+		{"upload, too large", multipartForm, "csrf", maxFormBytes, http.StatusRequestEntityTooLarge, false},
+		{"garbled upload", func(string, int) (string, io.Reader) {
+			return "multipart/form-data; boundary=x", strings.NewReader("--x\r\nnonsense")
+		}, "", 0, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		reached := false
+		var fileSize int64
+		h := NewWithSession(dbConn)(RequireCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+			// The upload is still there for the handler
+			if _, header, err := r.FormFile("image"); err == nil {
+				fileSize = header.Size
+				r.MultipartForm.RemoveAll()
+			}
+		})))
+		contentType, body := tt.form(tt.token, tt.size)
+		r := httptest.NewRequest(http.MethodPost, "/createpost", body)
+		r.Header.Set("Content-Type", contentType)
+		r.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status || reached != tt.reached {
+			t.Errorf("%s: status %d, handler reached %v; want %d, %v", tt.name, w.Code, reached, tt.status, tt.reached)
+		}
+		if reached && strings.HasPrefix(contentType, "multipart/") && fileSize != int64(tt.size) {
+			t.Errorf("%s: the handler got an upload of %d bytes, want %d", tt.name, fileSize, tt.size)
+		}
+	}
+}
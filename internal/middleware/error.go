@@ -1,19 +1,14 @@
 package middleware
 
 import (
-	"html/template"
 	"literary-lions/internal/models"
+	"literary-lions/internal/views"
 	"log"
 	"net/http"
-	"path/filepath"
 )
 
-// errorTemplate is compiled once and used for rendering all error pages.
-var errorTemplate = template.Must(
-	template.ParseFiles(filepath.Join("web", "templates", "error.html")),
-)
-
-// ErrorHandler renders a custom error page (error.html) with the provided HTTP status code and message.
+// ErrorHandler renders a custom error page (error.html, parsed with the
+// other templates by views.InitTemplates) with the provided HTTP status code and message.
 // The user's login state and username can be passed to personalize the error template.
 func ErrorHandler(w http.ResponseWriter, status int, message string, loggedIn bool, username string) {
 	// Set the HTTP response status code.
@@ -26,7 +21,7 @@ func ErrorHandler(w http.ResponseWriter, status int, message string, loggedIn bo
 		Username: username,
 	}
 	// Try to execute the template. If it fails, fall back to the default http.Error.
-	if err := errorTemplate.Execute(w, data); err != nil {
+	if err := views.Templates.ExecuteTemplate(w, "error.html", data); err != nil {
 		log.Printf("Template execution error: %v", err)
 		http.Error(w, "An error occurred.", http.StatusInternalServerError)
 	}
@@ -3,7 +3,13 @@ package middleware
 import (
 	"context"
 	"database/sql"
+	"literary-lions/internal/db"
+	"literary-lions/internal/models"
+	"literary-lions/internal/views"
+	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -13,8 +19,28 @@ type ctxKey string
 // userKey is the key under which user info is stored in the request context.
 const userKey ctxKey = "user"
 
+// touchInterval is how often a session's last-seen time and address are
+// brought up to date, rather than on every request.
+const touchInterval = 5 * time.Minute
+
+// sessionUser is the logged-in user, as stored in the request context.
+type sessionUser struct {
+	SessionID  string
+	ID         int
+	Username   string
+	Role       string
+	CSRFToken  string           // see RequireCSRF
+	Verified   bool             // the email address is confirmed (see DenyUnverified)
+	Needs2FA   bool             // staff who must turn on two-factor authentication first
+	Suspension *models.Sanction // nil unless the user is suspended
+}
+
 // NewWithSession returns a middleware that loads the logged-in user from the session cookie.
 // If the session is valid, user information is attached to the request context for use in handlers.
+// Banned users are logged out everywhere instead, and suspended users are told about
+// their suspension on their first request after it (see sanctioned). Moderators and
+// admins without two-factor authentication are sent to set it up while the site
+// requires it of them.
 func NewWithSession(dbConn *sql.DB) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -22,21 +48,39 @@ func NewWithSession(dbConn *sql.DB) func(http.Handler) http.Handler {
 			c, _ := r.Cookie("session_id")
 			if c != nil {
 				var (
-					id       int
-					username string
+					u        sessionUser
+					ip       string
+					lastSeen sql.NullTime
 				)
 				// Query the sessions and users tables to verify the session and fetch user info.
 				err := dbConn.QueryRow(`
-                    SELECT users.id, users.username
+                    SELECT sessions.id, sessions.ip, sessions.last_seen_at, users.id, users.username, users.role, sessions.csrf_token,
+                           users.email_verified_at IS NOT NULL,
+                           users.role != ? AND
+                           EXISTS (SELECT 1 FROM settings WHERE key=? AND value='1') AND
+                           NOT EXISTS (SELECT 1 FROM user_totp WHERE user_id=users.id AND confirmed_at IS NOT NULL)
                     FROM sessions JOIN users ON users.id=sessions.user_id
                     WHERE sessions.id=? AND sessions.expires_at>?
-                `, c.Value, time.Now()).Scan(&id, &username)
+                `, models.RoleMember, db.SettingRequireStaff2FA, c.Value, time.Now()).
+					Scan(&u.SessionID, &ip, &lastSeen, &u.ID, &u.Username, &u.Role, &u.CSRFToken, &u.Verified, &u.Needs2FA)
 				if err == nil {
-					// Add user info to the request context if session is valid.
-					r = r.WithContext(context.WithValue(r.Context(), userKey, struct {
-						ID       int
-						Username string
-					}{id, username}))
+					// Keep the session's last use up to date for the sessions page
+					if ip != ClientIP(r) || !lastSeen.Valid || time.Since(lastSeen.Time) > touchInterval {
+						if err := db.TouchSession(dbConn, u.SessionID, ClientIP(r)); err != nil {
+							log.Println("Could not update session:", err)
+						}
+					}
+					// Sanctioned users are stopped or warned before anything else
+					if sanctioned(dbConn, w, r, &u) {
+						return
+					}
+					// Add user info (and the CSRF token, for forms) to the request context if session is valid.
+					ctx := context.WithValue(r.Context(), userKey, u)
+					r = r.WithContext(views.WithCSRFToken(ctx, u.CSRFToken))
+					if u.Needs2FA && !twoFactorExempt(r.URL.Path) {
+						http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+						return
+					}
 				}
 				// If session is not valid, user is treated as logged out.
 			}
@@ -46,15 +90,151 @@ func NewWithSession(dbConn *sql.DB) func(http.Handler) http.Handler {
 	}
 }
 
+// twoFactorExempt reports whether path stays open to staff who have yet to
+// turn on two-factor authentication: the page to do it on, logging out and
+// static files.
+func twoFactorExempt(path string) bool {
+	return path == "/logout" || strings.HasPrefix(path, "/settings/2fa") || strings.HasPrefix(path, "/static/")
+}
+
 // CurrentUser extracts the user ID and username from the request context.
 // Returns ok == true if a user is logged in, otherwise false.
 func CurrentUser(r *http.Request) (id int, name string, ok bool) {
-	u, ok := r.Context().Value(userKey).(struct {
-		ID       int
-		Username string
-	})
+	u, ok := r.Context().Value(userKey).(sessionUser)
 	if ok {
 		return u.ID, u.Username, true
 	}
 	return 0, "", false
 }
+
+// CurrentSessionID returns the ID of the logged-in user's session, or ""
+// if nobody is logged in.
+func CurrentSessionID(r *http.Request) string {
+	u, _ := r.Context().Value(userKey).(sessionUser)
+	return u.SessionID
+}
+
+// ClientIP returns the IP address the request came from. Forwarding
+// headers are ignored, as any client can set them.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// CurrentRole returns the logged-in user's role (see models.Roles),
+// or "" if nobody is logged in.
+func CurrentRole(r *http.Request) string {
+	u, _ := r.Context().Value(userKey).(sessionUser)
+	return u.Role
+}
+
+// RequireRole returns a middleware that only lets through users with the
+// given role or a more privileged one. Visitors who are not logged in are
+// sent to the login page; other users get a 403 page.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, username, ok := CurrentUser(r)
+			if !ok {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			if !models.RoleAtLeast(CurrentRole(r), role) {
+				ErrorHandler(w, http.StatusForbidden, "You don't have permission to view this page.", true, username)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SanctionPageData holds what the ban and suspension notice shows.
+type SanctionPageData struct {
+	models.BasePageData
+	Sanction    models.Sanction
+	ContinueURL string // where to go after reading a suspension notice
+}
+
+// sanctioned applies any ban or suspension in force for u and reports
+// whether it has answered the request itself:
+//   - A banned user's sessions are all removed and the ban notice is shown.
+//   - A suspended user who has not yet seen the suspension notice gets it
+//     instead of the page they asked for (GET only). Otherwise u.Suspension
+//     is set, for DenySuspended.
+func sanctioned(dbConn *sql.DB, w http.ResponseWriter, r *http.Request, u *sessionUser) bool {
+	s, ok, err := db.ActiveSanction(dbConn, u.ID)
+	if err != nil {
+		log.Println("Sanction lookup failed:", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	if s.Kind == db.SanctionBan {
+		if err := db.EndSessions(dbConn, u.ID); err != nil {
+			log.Println("Could not end sessions of banned user:", err)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "", Path: "/", MaxAge: -1})
+		renderSanction(w, r, http.StatusForbidden, SanctionPageData{Sanction: s})
+		return true
+	}
+
+	u.Suspension = &s
+	if s.Notified || r.Method != http.MethodGet {
+		return false
+	}
+	if err := db.MarkSanctionNotified(dbConn, s.ID); err != nil {
+		log.Println("Could not mark suspension notice as seen:", err)
+	}
+	renderSanction(w, r, http.StatusOK, SanctionPageData{
+		BasePageData: models.BasePageData{Username: u.Username, LoggedIn: true},
+		Sanction:     s,
+		ContinueURL:  r.URL.RequestURI(),
+	})
+	return true
+}
+
+// DenySuspended is a middleware for routes that write (post, comment, like):
+// suspended users may still read (GET), but other requests get the
+// suspension notice with a 403.
+func DenySuspended(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, _ := r.Context().Value(userKey).(sessionUser)
+		if u.Suspension != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			renderSanction(w, r, http.StatusForbidden, SanctionPageData{
+				BasePageData: models.BasePageData{Username: u.Username, LoggedIn: true},
+				Sanction:     *u.Suspension,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DenyUnverified is a middleware for routes that post content (posts and
+// comments): users who have not yet confirmed their email address may read,
+// but other requests get a 403 page pointing them to the confirmation link.
+func DenyUnverified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey).(sessionUser)
+		if ok && !u.Verified && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			ErrorHandler(w, http.StatusForbidden,
+				"Please confirm your email address before posting: follow the link we mailed you, or get a new one from your profile page.",
+				true, u.Username)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// renderSanction shows the ban or suspension notice.
+func renderSanction(w http.ResponseWriter, r *http.Request, status int, data SanctionPageData) {
+	w.WriteHeader(status)
+	if err := views.Render(w, r, "sanction.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/views"
+)
+
+func TestMain(m *testing.M) {
+	// Templates are looked up from the repository root
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	views.InitTemplates()
+	os.Exit(m.Run())
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbConn, err := db.OpenDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbConn.Close() })
+	if _, err := db.MigrateUp(dbConn); err != nil {
+		t.Fatal(err)
+	}
+	return dbConn
+}
+
+// loggedIn returns a member with a session, and the session's ID.
+func loggedIn(t *testing.T, dbConn *sql.DB, name string) (int, string) {
+	t.Helper()
+	var id int
+	err := dbConn.QueryRow(`INSERT INTO users (email, username, password, email_verified_at) VALUES (?, ?, 'x', CURRENT_TIMESTAMP) RETURNING id`,
+		name+"@example.com", name).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := db.CreateSession(dbConn, id, "csrf", "test", "192.0.2.1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, session
+}
+
+func TestSanctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string // "" for none
+		expires  time.Duration
+		notified bool
+		method   string
+		status   int
+		reached  bool // the handler behind DenySuspended ran
+	}{
+		{"no sanction, GET", "", 0, false, http.MethodGet, http.StatusOK, true},
+		{"no sanction, POST", "", 0, false, http.MethodPost, http.StatusOK, true},
+		{"suspended, first GET shows the notice", db.SanctionSuspension, time.Hour, false, http.MethodGet, http.StatusOK, false},
+		{"suspended, later GET", db.SanctionSuspension, time.Hour, true, http.MethodGet, http.StatusOK, true},
+		{"suspended, POST", db.SanctionSuspension, time.Hour, true, http.MethodPost, http.StatusForbidden, false},
+		{"suspended until lifted, POST", db.SanctionSuspension, 0, true, http.MethodPost, http.StatusForbidden, false},
+		{"suspension expired, POST", db.SanctionSuspension, -time.Second, true, http.MethodPost, http.StatusOK, true},
+		{"banned, GET", db.SanctionBan, time.Hour, false, http.MethodGet, http.StatusForbidden, false},
+		{"ban expired, POST", db.SanctionBan, -time.Second, false, http.MethodPost, http.StatusOK, true},
+	}
+	dbConn := newTestDB(t)
+	var adminID int
+	if err := dbConn.QueryRow(`INSERT INTO users (email, username, password, role) VALUES ('admin@example.com', 'admin', 'x', 'admin') RETURNING id`).
+		Scan(&adminID); err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, session := loggedIn(t, dbConn, fmt.Sprintf("member%d", i))
+			if tt.kind != "" {
+				var expires time.Time
+				if tt.expires != 0 {
+					expires = time.Now().Add(tt.expires)
+				}
+				if err := db.SanctionUser(dbConn, userID, adminID, tt.kind, "test", expires); err != nil {
+					t.Fatal(err)
+				}
+				if tt.notified {
+					if _, err := dbConn.Exec(`UPDATE user_sanctions SET notified_at = CURRENT_TIMESTAMP WHERE user_id = ?`, userID); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			reached := false
+			h := NewWithSession(dbConn)(DenySuspended(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				if _, _, ok := CurrentUser(r); !ok {
+					t.Error("the handler ran for a visitor who is not logged in")
+				}
+			})))
+			r := httptest.NewRequest(tt.method, "/post/1", nil)
+			r.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status || reached != tt.reached {
+				t.Errorf("status %d, handler reached %v; want %d, %v", w.Code, reached, tt.status, tt.reached)
+			}
+			var sessions int
+			dbConn.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = ?`, userID).Scan(&sessions)
+			if banned := tt.kind == db.SanctionBan && tt.expires > 0; banned != (sessions == 0) {
+				t.Errorf("%d sessions left", sessions)
+			}
+		})
+	}
+}
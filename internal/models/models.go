@@ -1,17 +1,50 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
+// BasePageData is what every page needs for the navigation bar and forms.
+// CSRFToken is filled in by views.Render.
 type BasePageData struct {
-	Username string
-	LoggedIn bool
+	Username  string
+	LoggedIn  bool
+	CSRFToken string
 }
 
 type HomePageData struct {
 	BasePageData
 	Posts        []Post
+	Pager        Pager
 	Categories   []Category
 	PopularPosts []Post
+	Tags         []Tag
+}
+
+// Pager holds the links to the neighbouring pages of a post listing
+// ("Newer"/"Older", or "Previous"/"Next" for search results).
+// Either URL is empty at that end of the list.
+type Pager struct {
+	PrevURL   string
+	PrevLabel string
+	NextURL   string
+	NextLabel string
+}
+
+// User roles, from least to most privileged.
+const (
+	RoleMember    = "member"    // writes posts and comments, reacts
+	RoleModerator = "moderator" // also deletes and locks content in assigned categories
+	RoleAdmin     = "admin"     // moderates everything and manages roles
+)
+
+// Roles lists the user roles from least to most privileged.
+var Roles = []string{RoleMember, RoleModerator, RoleAdmin}
+
+// RoleAtLeast reports whether role is min or a more privileged one.
+func RoleAtLeast(role, min string) bool {
+	return slices.Index(Roles, role) >= slices.Index(Roles, min) && slices.Contains(Roles, role)
 }
 
 type User struct {
@@ -19,6 +52,7 @@ type User struct {
 	Username  string
 	Email     string
 	Password  string
+	Role      string
 	CreatedAt time.Time
 }
 
@@ -30,28 +64,155 @@ type Post struct {
 	Content       string
 	Image         string
 	CreatedAt     time.Time
+	UpdatedAt     time.Time // zero if the post was never edited
+	Locked        bool      // takes no new comments
 	Likes         int
+	Dislikes      int
 	Comments      int
 	Author        string
 	Category      string
 	UserLikeValue int
+	Tags          []string // hashtag names, without '#'
+
+	// Snippet is the part of the post matching a search, with matches
+	// wrapped in db.SnippetOpen/SnippetClose; SnippetInComment is set if it
+	// was taken from a comment rather than the post itself.
+	Snippet          string
+	SnippetInComment bool
+}
+
+// PostRevision is one version of a post's title and content.
+// Number counts from 1 (the original) up to the current version.
+type PostRevision struct {
+	Number    int
+	Title     string
+	Content   string
+	CreatedAt time.Time
+	Current   bool
 }
 
 type Comment struct {
 	ID        int
 	PostID    int
 	UserID    int
+	ParentID  int // 0 for a top-level comment, otherwise the comment replied to
 	Content   string
 	CreatedAt time.Time
+	UpdatedAt time.Time // zero if the comment was never edited
+	Deleted   bool      // removed (tombstoned); Content holds the original text
+	// DeletedByModerator is set if a moderator rather than the author removed it
+	DeletedByModerator bool
 
 	Author        string
 	Likes         int // total # of likes
 	UserLikeValue int
 }
 
+// Tag is a hashtag with how many posts use it. Weight (1–5) sizes it in the tag cloud.
+type Tag struct {
+	Name   string
+	Count  int
+	Weight int
+}
+
 type Category struct {
-	ID   int
-	Name string
+	ID          int
+	Name        string
+	Description string
+	Archived    bool // hidden from the sidebar and closed to new posts
+	MergedInto  int  // the category it was merged into, or 0
+	Posts       int  // number of posts (only filled in for the admin list)
+}
+
+// Sanction is a ban or suspension of a user.
+type Sanction struct {
+	ID        int
+	UserID    int
+	Username  string
+	Kind      string // "ban" or "suspension"
+	Reason    string
+	CreatedBy string // name of the moderator or admin ("" if unknown)
+	CreatedAt time.Time
+	ExpiresAt time.Time // zero: until lifted
+	Notified  bool      // the user has seen the notice about it
+}
+
+// Permanent reports whether the sanction lasts until it is lifted.
+func (s Sanction) Permanent() bool {
+	return s.ExpiresAt.IsZero()
+}
+
+// ReportReasons are the reasons a reader can pick when reporting content.
+var ReportReasons = []string{"spam", "harassment", "off-topic", "inappropriate", "other"}
+
+// Report is one reader's report about a post or comment.
+type Report struct {
+	ID         int
+	ReporterID int
+	Reporter   string
+	Reason     string
+	Details    string
+	CreatedAt  time.Time
+	// How the reporter's earlier reports went, to spot report abuse
+	ReporterTotal     int
+	ReporterDismissed int
+}
+
+// ReportGroup is a reported post or comment with its open reports.
+type ReportGroup struct {
+	PostID    int
+	CommentID int // 0 if the post itself was reported
+	PostTitle string
+	Category  string
+	AuthorID  int
+	Author    string
+	Content   string
+	Deleted   bool // the comment has already been removed
+	Banned    bool // the author is banned
+	Reports   []Report
+}
+
+// AuditEntry is one staff action from the audit log. Before and After are
+// JSON snapshots of the target ("" if there is none).
+type AuditEntry struct {
+	ID         int
+	ActorID    int // 0 for the command line
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   int
+	Reason     string
+	Before     string
+	After      string
+	CreatedAt  time.Time
+}
+
+// Session is one of a user's logins, as listed on the sessions page. The
+// session ID itself is a secret; Handle stands for it in forms.
+type Session struct {
+	Handle     string
+	UserAgent  string
+	Device     string // the browser and system, as far as UserAgent tells
+	IP         string // last used from
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	Current    bool // the session of the request being served
+}
+
+// Identity is an account at an OpenID Connect provider that a member logs
+// in with, as listed on the sign-in providers page.
+type Identity struct {
+	Provider    string // as configured, e.g. "google"
+	Email       string // as the provider gave it; may be empty
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+// FilterChip is an active search filter and the search without it.
+type FilterChip struct {
+	Label     string
+	RemoveURL string
 }
 
 type ErrorData struct {
@@ -63,7 +224,10 @@ type ErrorData struct {
 type SearchResultsPageData struct {
 	BasePageData
 	Query      string
+	Error      string       // why the query could not be parsed
+	Filters    []FilterChip // active filters, each removable
 	NotFound   bool
 	Results    []Post
+	Pager      Pager
 	Categories []Category
 }
@@ -0,0 +1,221 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// leeway allows for clocks that are a little off.
+	leeway = time.Minute
+	// keysRefetch is how often, at most, the keys are fetched again for a
+	// token signed with an unknown key.
+	keysRefetch = time.Minute
+	// minKeyBits is the smallest RSA key accepted.
+	minKeyBits = 2048
+)
+
+// idToken is the payload of an ID token.
+type idToken struct {
+	Issuer            string   `json:"iss"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            float64  `json:"exp"`
+	IssuedAt          float64  `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Subject           string   `json:"sub"`
+	Email             string   `json:"email"`
+	EmailVerified     any      `json:"email_verified"` // some providers send "true"
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+}
+
+// audience is the "aud" claim, a string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return errors.New("aud is neither a string nor an array")
+	}
+	*a = many
+	return nil
+}
+
+// Verify checks an ID token from the provider and returns its claims: it
+// must be signed with RS256 by one of the provider's keys, issued by the
+// provider for this client, unexpired, and carry nonce.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("id token: not a JWS")
+	}
+
+	// 1. The signature, by a key of the provider's
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("id token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("id token: unsupported algorithm %q", header.Alg)
+	}
+	key, err := p.key(ctx, meta.JWKSURI, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("id token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, errors.New("id token: bad signature")
+	}
+
+	// 2. The claims (OpenID Connect Core 3.1.3.7)
+	var tok idToken
+	if err := decodeSegment(parts[1], &tok); err != nil {
+		return nil, fmt.Errorf("id token payload: %w", err)
+	}
+	now := time.Now()
+	switch {
+	case tok.Issuer != meta.Issuer:
+		return nil, fmt.Errorf("id token: issuer %q, want %q", tok.Issuer, meta.Issuer)
+	case !tok.Audience.has(p.ClientID):
+		return nil, errors.New("id token: not meant for this client")
+	case len(tok.Audience) > 1 && tok.AuthorizedParty != p.ClientID:
+		return nil, errors.New("id token: authorized party is not this client")
+	case tok.Expiry == 0 || now.After(time.Unix(int64(tok.Expiry), 0).Add(leeway)):
+		return nil, errors.New("id token: expired")
+	case tok.IssuedAt != 0 && time.Unix(int64(tok.IssuedAt), 0).After(now.Add(leeway)):
+		return nil, errors.New("id token: issued in the future")
+	case tok.Subject == "":
+		return nil, errors.New("id token: no subject")
+	case subtle.ConstantTimeCompare([]byte(tok.Nonce), []byte(nonce)) != 1 || nonce == "":
+		return nil, errors.New("id token: nonce does not match")
+	}
+	verified := tok.EmailVerified == true || tok.EmailVerified == "true"
+	return &Claims{
+		Subject:           tok.Subject,
+		Email:             tok.Email,
+		EmailVerified:     verified,
+		PreferredUsername: tok.PreferredUsername,
+		Name:              tok.Name,
+	}, nil
+}
+
+func (a audience) has(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWS into v.
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the provider's signing key kid (any key, if the token names
+// none and the provider has just one), fetching the key set again if it
+// does not know it.
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k := pickKey(p.keys, kid); k != nil {
+		return k, nil
+	}
+	if time.Since(p.keysTime) < keysRefetch {
+		return nil, fmt.Errorf("id token: unknown key %q", kid)
+	}
+	keys, err := p.fetchKeys(ctx, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys, p.keysTime = keys, time.Now()
+	if k := pickKey(keys, kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("id token: unknown key %q", kid)
+}
+
+func pickKey(keys map[string]*rsa.PublicKey, kid string) *rsa.PublicKey {
+	if kid == "" && len(keys) == 1 {
+		for _, k := range keys {
+			return k
+		}
+	}
+	return keys[kid]
+}
+
+// fetchKeys downloads the provider's JSON Web Key Set, keeping the RSA
+// signing keys.
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("status %d", status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keys of %s: %w", p.Issuer, err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minKeyBits || key.E < 3 {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
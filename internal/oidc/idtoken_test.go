@@ -0,0 +1,211 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"literary-lions/internal/oidc/oidctest"
+)
+
+var testUser = oidctest.User{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true, PreferredUsername: "ann"}
+
+// newTestProvider starts a mock provider and returns it with the Provider
+// for it.
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	mock, err := oidctest.NewProvider("client", "secret", testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	p := New(Config{
+		Name:         "mock",
+		Label:        "Mock",
+		Issuer:       mock.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://forum.test/login/oidc/mock/callback",
+	}, mock.Server.Client())
+	return mock, p
+}
+
+// authorize goes through the provider's authorization endpoint and returns
+// the code it sends back.
+func authorize(t *testing.T, mock *oidctest.Provider, p *Provider, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := mock.Server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || back.Query().Get("state") != "state" {
+		t.Fatalf("authorization endpoint sent the browser to %q", resp.Header.Get("Location"))
+	}
+	return back.Query().Get("code")
+}
+
+// rawIDToken gets an ID token issued for nonce.
+func rawIDToken(t *testing.T, mock *oidctest.Provider, p *Provider, nonce string) string {
+	t.Helper()
+	code := authorize(t, mock, p, nonce, "verifier")
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {"verifier"},
+	}
+	req, err := http.NewRequest(http.MethodPost, mock.Issuer()+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("client", "secret")
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if status, err := p.doJSON(req, &tok); err != nil || status != http.StatusOK {
+		t.Fatalf("token request: %d, %v", status, err)
+	}
+	return tok.IDToken
+}
+
+func TestVerify(t *testing.T) {
+	mock, p := newTestProvider(t)
+	ctx := context.Background()
+
+	claims, err := p.Verify(ctx, rawIDToken(t, mock, p, "nonce"), "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Claims{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true, PreferredUsername: "ann"}); *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(claims map[string]any)
+		nonce  string // given to Verify, if not "nonce"
+		err    string
+	}{
+		{"wrong audience", func(c map[string]any) { c["aud"] = "other" }, "", "not meant for this client"},
+		{"several audiences, another client authorized", func(c map[string]any) {
+			c["aud"] = []string{"client", "other"}
+			c["azp"] = "other"
+		}, "", "authorized party"},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://issuer.invalid" }, "", "issuer"},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-2 * leeway).Unix() }, "", "expired"},
+		{"no expiry", func(c map[string]any) { delete(c, "exp") }, "", "expired"},
+		{"issued in the future", func(c map[string]any) { c["iat"] = time.Now().Add(2 * leeway).Unix() }, "", "future"},
+		{"no subject", func(c map[string]any) { c["sub"] = "" }, "", "no subject"},
+		{"nonce mismatch", nil, "another", "nonce"},
+		{"no nonce", func(c map[string]any) { delete(c, "nonce") }, "", "nonce"},
+	}
+	for _, tt := range tests {
+		mock.Tamper(tt.tamper)
+		nonce := "nonce"
+		if tt.nonce != "" {
+			nonce = tt.nonce
+		}
+		raw := rawIDToken(t, mock, p, "nonce")
+		if _, err := p.Verify(ctx, raw, nonce); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: Verify = %v, want an error about %q", tt.name, err, tt.err)
+		}
+	}
+
+	// Several audiences are fine with this client as the authorized party
+	mock.Tamper(func(c map[string]any) {
+		c["aud"] = []string{"other", "client"}
+		c["azp"] = "client"
+	})
+	if _, err := p.Verify(ctx, rawIDToken(t, mock, p, "nonce"), "nonce"); err != nil {
+		t.Errorf("several audiences: %v", err)
+	}
+	mock.Tamper(nil)
+}
+
+func TestVerifySignature(t *testing.T) {
+	mock, p := newTestProvider(t)
+	ctx := context.Background()
+	parts := strings.Split(rawIDToken(t, mock, p, "nonce"), ".")
+	b64 := base64.RawURLEncoding
+	segment := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b64.EncodeToString(b)
+	}
+
+	// The payload of another, validly signed token
+	other := strings.Split(rawIDToken(t, mock, p, "other"), ".")
+	// A claim changed after signing
+	var claims map[string]any
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	claims["sub"] = "someone-else"
+	// A signature with a bit flipped
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[len(sig)/2] ^= 1
+
+	tests := []struct {
+		name string
+		raw  string
+		err  string
+	}{
+		{"payload swapped", parts[0] + "." + other[1] + "." + parts[2], "bad signature"},
+		{"claim changed", parts[0] + "." + segment(claims) + "." + parts[2], "bad signature"},
+		{"signature changed", parts[0] + "." + parts[1] + "." + b64.EncodeToString(sig), "bad signature"},
+		{"no signature", parts[0] + "." + parts[1] + ".", "bad signature"},
+		{"alg none", segment(map[string]string{"alg": "none", "kid": oidctest.KeyID}) + "." + parts[1] + ".", "unsupported algorithm"},
+		{"HS256", segment(map[string]string{"alg": "HS256", "kid": oidctest.KeyID}) + "." + parts[1] + "." + parts[2], "unsupported algorithm"},
+		{"unknown key", segment(map[string]string{"alg": "RS256", "kid": "other-key"}) + "." + parts[1] + "." + parts[2], "unknown key"},
+		{"not a JWS", parts[0] + "." + parts[1], "not a JWS"},
+	}
+	for _, tt := range tests {
+		if _, err := p.Verify(ctx, tt.raw, "nonce"); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: Verify = %v, want an error about %q", tt.name, err, tt.err)
+		}
+	}
+	if _, err := p.Verify(ctx, strings.Join(parts, "."), "nonce"); err != nil {
+		t.Errorf("the untouched token: %v", err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	mock, p := newTestProvider(t)
+	ctx := context.Background()
+
+	code := authorize(t, mock, p, "nonce", "verifier")
+	if _, err := p.Exchange(ctx, code, "another verifier", "nonce"); err == nil {
+		t.Error("Exchange accepted the wrong PKCE verifier")
+	}
+	code = authorize(t, mock, p, "nonce", "verifier")
+	claims, err := p.Exchange(ctx, code, "verifier", "nonce")
+	if err != nil || claims.Subject != "sub-1" {
+		t.Fatalf("Exchange = %+v, %v", claims, err)
+	}
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); err == nil {
+		t.Error("Exchange accepted a code twice")
+	}
+}
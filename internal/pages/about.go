@@ -17,7 +17,7 @@ func AboutPageHandler(dbConn *sql.DB) http.HandlerFunc {
 			Username   string
 			Categories []models.Category
 		}{}
-		err := views.Templates.ExecuteTemplate(w, "about.html", data)
+		err := views.Render(w, r, "about.html", data)
 		fmt.Println("About handler called!")
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
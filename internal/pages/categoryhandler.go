@@ -2,6 +2,7 @@ package pages
 
 import (
 	"database/sql"
+	"fmt"
 	"literary-lions/internal/db"
 	"literary-lions/internal/middleware"
 	"literary-lions/internal/models"
@@ -17,15 +18,19 @@ type CategoryPageData struct {
 	models.BasePageData
 	Category   models.Category
 	Posts      []models.Post
+	Pager      models.Pager
 	Categories []models.Category
+	Tags       []models.Tag
 }
 
 // NewCategoryHandler returns an http.HandlerFunc that serves category pages.
-// It expects URLs like /category/3 where 3 is the category ID.
-func NewCategoryHandler(dbConn *sql.DB) http.HandlerFunc {
+// It expects URLs like /category/3 where 3 is the category ID, and shows
+// pageSize posts per page. Merged categories redirect to the category they
+// were merged into.
+func NewCategoryHandler(dbConn *sql.DB, pageSize int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// 1. Get current user (for personalization, login controls).
-		_, username, loggedIn := middleware.CurrentUser(r)
+		userID, username, loggedIn := middleware.CurrentUser(r)
 		// 2. Parse the category ID from the URL.
 		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 		// Check if the path is well-formed: /category/{id}
@@ -41,27 +46,40 @@ func NewCategoryHandler(dbConn *sql.DB) http.HandlerFunc {
 		}
 
 		// 3. Fetch the specific category from the database.
-		var category models.Category
-		err = dbConn.QueryRow("SELECT id, name FROM categories WHERE id = ?", catID).Scan(&category.ID, &category.Name)
+		category, err := db.GetCategory(dbConn, catID)
 		if err != nil {
 			// If category doesn't exist, show 404.
 			http.NotFound(w, r)
 			return
 		}
+		// A merged category lives on at the category it was merged into.
+		if category.MergedInto != 0 {
+			http.Redirect(w, r, fmt.Sprintf("/category/%d", category.MergedInto), http.StatusMovedPermanently)
+			return
+		}
 
-		// 4. Fetch all posts in this category.
-		posts, _ := db.FetchPostsByCategory(dbConn, catID)
+		// 4. Fetch one page of posts in this category (a broken page link is a 400).
+		opts, ok := pageOpts(r, "", pageSize)
+		if !ok {
+			middleware.ErrorHandler(w, http.StatusBadRequest, "This page link is broken.", loggedIn, username)
+			return
+		}
+		page, _ := db.FetchPostsByCategory(dbConn, catID, userID, opts)
 
 		// 5. Fetch all categories (for displaying in the sidebar, navigation, etc).
 		cats, _ := db.FetchCategories(dbConn)
-		// 6. Prepare the template data.
+		// 6. Fetch the tag cloud for the sidebar.
+		tags, _ := db.FetchTagCloud(dbConn, 30)
+		// 7. Prepare the template data.
 		data := CategoryPageData{
 			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
 			Category:     category,
-			Posts:        posts,
+			Posts:        page.Posts,
+			Pager:        pagerLinks(r, "", page),
 			Categories:   cats,
+			Tags:         tags,
 		}
-		// 7. Render the "category.html" template with the data.
-		views.Templates.ExecuteTemplate(w, "category.html", data)
+		// 8. Render the "category.html" template with the data.
+		views.Render(w, r, "category.html", data)
 	}
 }
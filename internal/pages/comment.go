@@ -2,14 +2,18 @@ package pages
 
 import (
 	"database/sql"
+	"fmt"
 	"literary-lions/internal/db"
 	"literary-lions/internal/middleware"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 // NewDeleteCommentHandler returns an HTTP handler for deleting comments.
-// Only allows POST, only allows the owner of the comment to delete.
+// Only allows POST, only allows the owner of the comment, the category's
+// moderators and admins to delete.
+// The comment is replaced by a tombstone so replies keep their context.
 // Responds with appropriate HTTP error codes and messages.
 func NewDeleteCommentHandler(dbConn *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -34,8 +38,9 @@ func NewDeleteCommentHandler(dbConn *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Attempt to delete the comment, but only if it belongs to the current user.
-		err = db.DeleteCommentByID(dbConn, commentID, userID)
+		// Attempt to delete the comment, but only if it belongs to the current user
+		// or they moderate the post's category.
+		postID, err := db.DeleteCommentByID(dbConn, commentID, userID, strings.TrimSpace(r.FormValue("reason")))
 		if err != nil {
 			if err == sql.ErrNoRows {
 				middleware.ErrorHandler(w, 403, "You are not allowed to delete this comment.", loggedIn, username)
@@ -44,7 +49,53 @@ func NewDeleteCommentHandler(dbConn *sql.DB) http.HandlerFunc {
 			}
 			return
 		}
-		// Redirect to home
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		// Redirect back to the discussion
+		http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+	}
+}
+
+// NewEditCommentHandler returns an HTTP handler for editing comments.
+// Only allows POST, only allows the owner to edit a comment that has not
+// been deleted, in a discussion that is not locked, and caps its length as
+// for new comments. Redirects back to the post on success.
+func NewEditCommentHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		commentID, err := strconv.Atoi(r.FormValue("comment_id"))
+		if err != nil {
+			middleware.ErrorHandler(w, 400, "Invalid comment ID", loggedIn, username)
+			return
+		}
+		text := strings.TrimSpace(r.FormValue("content"))
+		if text == "" {
+			middleware.ErrorHandler(w, 400, "A comment cannot be empty. Use Delete to remove it.", loggedIn, username)
+			return
+		}
+		if msg := commentTooLong(text); msg != "" {
+			middleware.ErrorHandler(w, 400, msg+".", loggedIn, username)
+			return
+		}
+
+		// Only the owner can edit, and only while the comment is not deleted
+		// and the discussion not locked
+		postID, err := db.UpdateComment(dbConn, commentID, userID, text)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				middleware.ErrorHandler(w, 403, "You are not allowed to edit this comment, or the discussion is locked.", loggedIn, username)
+			} else {
+				middleware.ErrorHandler(w, 500, "Could not save the comment.", loggedIn, username)
+			}
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
 	}
 }
@@ -0,0 +1,77 @@
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+)
+
+// New and edited comments have the same length limit.
+func TestCommentLength(t *testing.T) {
+	dbConn := newTestDB(t)
+	var userID, category int
+	if err := dbConn.QueryRow(`INSERT INTO users (email, username, password) VALUES ('ann@example.com', 'ann', 'x') RETURNING id`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	postID, err := db.CreatePost(dbConn, userID, category, "Title", "Text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := db.AddComment(dbConn, postID, userID, 0, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := db.CreateSession(dbConn, userID, "csrf", "test", "192.0.2.1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post/", NewShowPostHandler(dbConn, 5, 3))
+	mux.HandleFunc("/editcomment", NewEditCommentHandler(dbConn))
+	post := func(target string, form url.Values) int {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+		w := httptest.NewRecorder()
+		middleware.NewWithSession(dbConn)(mux).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Counted in characters, not bytes
+	longest := strings.Repeat("é", maxCommentLength)
+	tests := []struct {
+		text   string
+		status int
+	}{
+		{longest, http.StatusSeeOther},
+		{longest + "x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status := post(fmt.Sprintf("/post/%d", postID), url.Values{"comment": {tt.text}}); status != tt.status {
+			t.Errorf("new comment of %d characters: status %d, want %d", len([]rune(tt.text)), status, tt.status)
+		}
+		form := url.Values{"comment_id": {fmt.Sprint(commentID)}, "content": {tt.text}}
+		if status := post("/editcomment", form); status != tt.status {
+			t.Errorf("edited comment of %d characters: status %d, want %d", len([]rune(tt.text)), status, tt.status)
+		}
+	}
+
+	// SQLite's length() counts characters too
+	var atLimit, overLimit int
+	dbConn.QueryRow(`SELECT COUNT(*) FILTER (WHERE length(content) = ?), COUNT(*) FILTER (WHERE length(content) > ?) FROM comments`,
+		maxCommentLength, maxCommentLength).Scan(&atLimit, &overLimit)
+	if atLimit != 2 || overLimit != 0 {
+		t.Errorf("%d comments at the limit, %d over it; want the new one and the edited one at it", atLimit, overLimit)
+	}
+}
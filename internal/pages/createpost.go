@@ -2,21 +2,69 @@ package pages
 
 import (
 	"database/sql"
+	"fmt"
 	"io"
+	"literary-lions/internal/db"
 	"literary-lions/internal/middleware"
 	"literary-lions/internal/models"
 	"literary-lions/internal/views"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+// Uploaded images are kept in UploadDir and served from UploadURL.
+const (
+	UploadDir = "web/static/uploads"
+	UploadURL = "/static/uploads/"
+)
+
+// Titles and texts of posts are limited to this many characters, which
+// also bounds the work of comparing revisions (see diff.Words), and so are
+// comments, whether new or edited.
+const (
+	maxTitleLength   = 200
+	maxPostLength    = 20000
+	maxCommentLength = 5000
+)
+
+// postTooLong returns why title or content is too long, or "".
+func postTooLong(title, content string) string {
+	switch {
+	case utf8.RuneCountInString(title) > maxTitleLength:
+		return fmt.Sprintf("The title cannot be longer than %d characters", maxTitleLength)
+	case utf8.RuneCountInString(content) > maxPostLength:
+		return fmt.Sprintf("The text cannot be longer than %d characters", maxPostLength)
+	}
+	return ""
+}
+
+// commentTooLong returns why a comment's text is too long, or "".
+func commentTooLong(text string) string {
+	if utf8.RuneCountInString(text) > maxCommentLength {
+		return fmt.Sprintf("A comment cannot be longer than %d characters", maxCommentLength)
+	}
+	return ""
+}
+
+// UploadFile returns the file an uploaded image's URL (as stored in
+// posts.image) refers to, or "" if it is not an upload.
+func UploadFile(url string) string {
+	name := strings.TrimPrefix(url, UploadURL)
+	if name == url || name == "" || strings.ContainsAny(name, `/\`) || name == ".." {
+		return ""
+	}
+	return filepath.Join(UploadDir, name)
+}
+
 // CreatePostPageData holds data required to render the "Create Post" page.
 type CreatePostPageData struct {
-	Username   string
-	LoggedIn   bool
+	models.BasePageData
 	Categories []models.Category
 }
 
@@ -34,25 +82,15 @@ func NewCreatePostHandler(dbConn *sql.DB) http.HandlerFunc {
 
 		// Handle GET request: render the post creation form.
 		if r.Method == http.MethodGet {
-			// Fetch all categories for the category dropdown.
-			rows, err := dbConn.Query("SELECT id, name FROM categories")
-			var categories []models.Category
-			if err == nil {
-				defer rows.Close()
-				for rows.Next() {
-					var c models.Category
-					rows.Scan(&c.ID, &c.Name)
-					categories = append(categories, c)
-				}
-			}
+			// Fetch the open categories for the category dropdown.
+			categories, _ := db.FetchCategories(dbConn)
 
 			// Render the form with username, login status, and categories.
 			data := CreatePostPageData{
-				Username:   username,
-				LoggedIn:   loggedIn,
-				Categories: categories,
+				BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+				Categories:   categories,
 			}
-			views.Templates.ExecuteTemplate(w, "createpost.html", data)
+			views.Render(w, r, "createpost.html", data)
 			return
 		}
 
@@ -62,29 +100,40 @@ func NewCreatePostHandler(dbConn *sql.DB) http.HandlerFunc {
 			title := r.FormValue("title")
 			content := r.FormValue("content")
 			categoryID, _ := strconv.Atoi(r.FormValue("category_id"))
+			if msg := postTooLong(title, content); msg != "" {
+				middleware.ErrorHandler(w, http.StatusBadRequest, msg+".", loggedIn, username)
+				return
+			}
 
 			// Handle optional image upload.
 			var imagePath string
 			file, handler, err := r.FormFile("image")
 			if err == nil && handler != nil {
 				defer file.Close()
-				os.MkdirAll("web/static/uploads", os.ModePerm)
+				os.MkdirAll(UploadDir, os.ModePerm)
 				ext := filepath.Ext(handler.Filename)
 				imageFileName := "post_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ext
-				imagePath = "/static/uploads/" + imageFileName
-				dst, err := os.Create("web/static/uploads/" + imageFileName)
+				imagePath = UploadURL + imageFileName
+				dst, err := os.Create(filepath.Join(UploadDir, imageFileName))
 				if err == nil {
-					defer dst.Close()
 					io.Copy(dst, file)
+					dst.Close()
 				}
 			}
 
-			// Insert the new post into the database.
-			_, err = dbConn.Exec(`
-                INSERT INTO posts (user_id, category_id, title, content, image)
-                VALUES (?, ?, ?, ?, ?)`,
-				userID, categoryID, title, content, imagePath,
-			)
+			// Insert the new post (and its hashtags) into the database.
+			_, err = db.CreatePost(dbConn, userID, categoryID, title, content, imagePath)
+			if err != nil && imagePath != "" {
+				// No post refers to the image, so don't keep it
+				if rmErr := os.Remove(UploadFile(imagePath)); rmErr != nil && !os.IsNotExist(rmErr) {
+					log.Println("Could not remove image of unsaved post:", rmErr)
+				}
+			}
+			if err == sql.ErrNoRows {
+				// The category is gone or archived
+				middleware.ErrorHandler(w, http.StatusBadRequest, "Please choose one of the listed categories.", loggedIn, username)
+				return
+			}
 			if err != nil {
 				// If there is a DB error, show a friendly error page.
 				_, username, loggedIn := middleware.CurrentUser(r)
@@ -0,0 +1,74 @@
+package pages
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+)
+
+// An image sent with a post that can't be saved is not kept.
+func TestCreatePostFailureRemovesUpload(t *testing.T) {
+	dbConn := newTestDB(t)
+	var userID, category int
+	if err := dbConn.QueryRow(`INSERT INTO users (email, username, password, role) VALUES ('ann@example.com', 'ann', 'x', 'admin') RETURNING id`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetCategoryArchived(dbConn, userID, category, true); err != nil {
+		t.Fatal(err)
+	}
+	session, err := db.CreateSession(dbConn, userID, "csrf", "test", "192.0.2.1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := func() []string {
+		files, _ := filepath.Glob(filepath.Join(UploadDir, "*"))
+		return files
+	}
+	before := uploads()
+	t.Cleanup(func() {
+		// Whatever the test left behind
+		for _, f := range uploads() {
+			if !slices.Contains(before, f) {
+				os.Remove(f)
+			}
+		}
+	})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "Title")
+	mw.WriteField("content", "Text")
+	mw.WriteField("category_id", fmt.Sprint(category))
+	fw, err := mw.CreateFormFile("image", "picture.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("not really a png"))
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/createpost", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+	w := httptest.NewRecorder()
+	middleware.NewWithSession(dbConn)(NewCreatePostHandler(dbConn)).ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("posting to an archived category: status %d", w.Code)
+	}
+	if after := uploads(); len(after) != len(before) {
+		t.Errorf("%d files in %s, there were %d", len(after), UploadDir, len(before))
+	}
+}
@@ -0,0 +1,165 @@
+package pages
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/internal/db"
+	"literary-lions/internal/diff"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/views"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EditPostPageData holds the data for the "Edit post" form.
+type EditPostPageData struct {
+	models.BasePageData
+	Post       models.Post
+	Error      string
+	Categories []models.Category
+}
+
+// NewEditPostHandler serves /post/{id}/edit.
+// - GET: show the edit form pre-filled with the current title and content.
+// - POST: save the new version (the old one goes to the revision history).
+// Only the owner of the post may edit it.
+func NewEditPostHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		postID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			middleware.ErrorHandler(w, http.StatusNotFound, "Post not found", loggedIn, username)
+			return
+		}
+		post, err := db.GetPost(dbConn, postID, userID)
+		if err != nil {
+			middleware.ErrorHandler(w, http.StatusNotFound, "Post not found", loggedIn, username)
+			return
+		}
+		if post.UserID != userID {
+			middleware.ErrorHandler(w, http.StatusForbidden, "You can only edit your own posts.", loggedIn, username)
+			return
+		}
+
+		categories, _ := db.FetchCategories(dbConn)
+		data := EditPostPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+			Post:         post,
+			Categories:   categories,
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			views.Render(w, r, "editpost.html", data)
+
+		case http.MethodPost:
+			title := strings.TrimSpace(r.FormValue("title"))
+			content := strings.TrimSpace(r.FormValue("content"))
+			if title == "" || content == "" {
+				// Keep what the user typed so nothing is lost
+				data.Post.Title, data.Post.Content = title, content
+				data.Error = "Title and text cannot be empty"
+				w.WriteHeader(http.StatusBadRequest)
+				views.Render(w, r, "editpost.html", data)
+				return
+			}
+			if msg := postTooLong(title, content); msg != "" {
+				data.Post.Title, data.Post.Content = title, content
+				data.Error = msg
+				w.WriteHeader(http.StatusBadRequest)
+				views.Render(w, r, "editpost.html", data)
+				return
+			}
+
+			err := db.UpdatePost(dbConn, postID, userID, title, content)
+			if err != nil {
+				middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not save your changes.", loggedIn, username)
+				return
+			}
+			http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// PostHistoryPageData holds the data for the revision history page.
+type PostHistoryPageData struct {
+	models.BasePageData
+	Post         models.Post
+	Revisions    []models.PostRevision
+	HasRevisions bool
+	From, To     models.PostRevision
+	TitleDiff    []diff.Chunk
+	ContentDiff  []diff.Chunk
+	HasChanges   bool
+	Categories   []models.Category
+}
+
+// NewPostHistoryHandler serves /post/{id}/history.
+// It lists every version of the post and shows a word-level diff between
+// two of them, chosen with ?from=N&to=M (defaults: the last edit).
+func NewPostHistoryHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		viewerID, username, loggedIn := middleware.CurrentUser(r)
+
+		postID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			middleware.ErrorHandler(w, http.StatusNotFound, "Post not found", loggedIn, username)
+			return
+		}
+		post, err := db.GetPost(dbConn, postID, viewerID)
+		if err != nil {
+			middleware.ErrorHandler(w, http.StatusNotFound, "Post not found", loggedIn, username)
+			return
+		}
+		revisions, err := db.FetchPostRevisions(dbConn, postID)
+		if err != nil {
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not load the post history.", loggedIn, username)
+			return
+		}
+
+		// Pick the two versions to compare; out-of-range numbers fall back
+		// to comparing the current version with the one before it.
+		n := len(revisions)
+		to := revisionParam(r, "to", n, n)
+		from := revisionParam(r, "from", n, max(to-1, 1))
+
+		oldRev, newRev := revisions[from-1], revisions[to-1]
+		titleDiff := diff.Words(oldRev.Title, newRev.Title)
+		contentDiff := diff.Words(oldRev.Content, newRev.Content)
+
+		categories, _ := db.FetchCategories(dbConn)
+		data := PostHistoryPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+			Post:         post,
+			Revisions:    revisions,
+			HasRevisions: n > 1,
+			From:         oldRev,
+			To:           newRev,
+			TitleDiff:    titleDiff,
+			ContentDiff:  contentDiff,
+			HasChanges:   diff.Changed(titleDiff) || diff.Changed(contentDiff),
+			Categories:   categories,
+		}
+		views.Render(w, r, "post_history.html", data)
+	}
+}
+
+// revisionParam reads a 1-based revision number from the query string,
+// returning def if it is missing or outside 1..n.
+func revisionParam(r *http.Request, name string, n, def int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || v < 1 || v > n {
+		return def
+	}
+	return v
+}
@@ -11,9 +11,10 @@ import (
 )
 
 // NewHomeHandler returns a handler for the main forum page ("/").
-// It loads all recent posts, categories, and popular posts for display.
+// It loads one page of recent posts (pageSize per page, paged with ?before= /
+// ?after= cursors), categories, and popular posts for display.
 // It handles error scenarios and passes user/session info to the template.
-func NewHomeHandler(dbConn *sql.DB) http.HandlerFunc {
+func NewHomeHandler(dbConn *sql.DB, pageSize int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get current user info from session (if logged in)
 		userID, username, loggedIn := middleware.CurrentUser(r)
@@ -24,8 +25,15 @@ func NewHomeHandler(dbConn *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Fetch all posts for the home feed, with respect to current user (for likes)
-		posts, err := db.FetchPosts(dbConn, userID)
+		// Read the page cursor; a broken one is the link's fault, not ours
+		opts, ok := pageOpts(r, "", pageSize)
+		if !ok {
+			middleware.ErrorHandler(w, http.StatusBadRequest, "This page link is broken.", loggedIn, username)
+			return
+		}
+
+		// Fetch one page of the home feed, with respect to current user (for likes)
+		page, err := db.FetchPosts(dbConn, userID, opts)
 		// Fetch all categories for the sidebar or menu
 		categories, _ := db.FetchCategories(dbConn)
 		// Fetch top 6 popular posts (by likes)
@@ -38,13 +46,8 @@ func NewHomeHandler(dbConn *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// For each post, fetch the number of likes and comments (show as badges)
-		for i := range posts {
-			likes, _ := db.CountLikesByPostID(dbConn, posts[i].ID)
-			comments, _ := db.CountCommentsByPostID(dbConn, posts[i].ID)
-			posts[i].Likes = likes
-			posts[i].Comments = comments
-		}
+		// Load the tag cloud for the sidebar
+		tags, _ := db.FetchTagCloud(dbConn, 30)
 
 		// Prepare data to send to the template
 		data := models.HomePageData{
@@ -52,12 +55,14 @@ func NewHomeHandler(dbConn *sql.DB) http.HandlerFunc {
 				Username: username,
 				LoggedIn: loggedIn,
 			},
-			Posts:        posts,
+			Posts:        page.Posts,
+			Pager:        pagerLinks(r, "", page),
 			Categories:   categories,
 			PopularPosts: popularPosts,
+			Tags:         tags,
 		}
 		// Render the home page template
-		err = views.Templates.ExecuteTemplate(w, "index.html", data)
+		err = views.Render(w, r, "index.html", data)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
@@ -95,6 +95,14 @@ func NewCommentLikeHandler(dbConn *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Removed comments keep the likes they had, but can't be reacted to any more
+		var active bool
+		err = dbConn.QueryRow(`SELECT deleted_at IS NULL FROM comments WHERE id=?`, cID).Scan(&active)
+		if err != nil || !active {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+
 		if value == 0 {
 			// Remove like/dislike
 			_, err = dbConn.Exec(
@@ -0,0 +1,73 @@
+package pages
+
+import (
+	"literary-lions/internal/db"
+	"literary-lions/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// pageOpts reads the ?before= or ?after= cursor of a post listing.
+// prefix tells apart several listings on one page (e.g. "likes_").
+// A missing cursor means the first page; ok is false if a cursor is there
+// but malformed (a mangled or tampered link), which callers answer with 400.
+func pageOpts(r *http.Request, prefix string, pageSize int) (db.PageOpts, bool) {
+	opts := db.PageOpts{Limit: pageSize}
+	q := r.URL.Query()
+	if s := q.Get(prefix + "before"); s != "" {
+		c, ok := db.ParseCursor(s)
+		opts.Before = &c
+		return opts, ok
+	}
+	if s := q.Get(prefix + "after"); s != "" {
+		c, ok := db.ParseCursor(s)
+		opts.After = &c
+		return opts, ok
+	}
+	return opts, true
+}
+
+// pagerLinks builds the "newer"/"older" links for a listing page. They keep
+// the request's other query parameters (search terms, the cursor of another
+// listing) and only swap this listing's cursor.
+func pagerLinks(r *http.Request, prefix string, page db.PostPage) models.Pager {
+	link := func(key string, c *db.Cursor) string {
+		if c == nil {
+			return ""
+		}
+		q := r.URL.Query()
+		q.Del(prefix + "before")
+		q.Del(prefix + "after")
+		q.Set(prefix+key, c.String())
+		return r.URL.Path + "?" + q.Encode()
+	}
+	return models.Pager{
+		PrevURL:   link("after", page.Newer),
+		PrevLabel: "Newer",
+		NextURL:   link("before", page.Older),
+		NextLabel: "Older",
+	}
+}
+
+// NumberedPagerLinks builds the "previous"/"next" links for page pageNum of
+// a list paged by ?page= (search results, admin lists), keeping the other
+// query parameters such as search terms and filters.
+func NumberedPagerLinks(r *http.Request, pageNum int, more bool) models.Pager {
+	link := func(n int) string {
+		q := r.URL.Query()
+		if n > 1 {
+			q.Set("page", strconv.Itoa(n))
+		} else {
+			q.Del("page")
+		}
+		return r.URL.Path + "?" + q.Encode()
+	}
+	pager := models.Pager{PrevLabel: "Previous", NextLabel: "Next"}
+	if pageNum > 1 {
+		pager.PrevURL = link(pageNum - 1)
+	}
+	if more {
+		pager.NextURL = link(pageNum + 1)
+	}
+	return pager
+}
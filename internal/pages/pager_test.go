@@ -0,0 +1,87 @@
+package pages
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"literary-lions/internal/db"
+	"literary-lions/internal/views"
+)
+
+func TestMain(m *testing.M) {
+	// Templates are looked up from the repository root
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	views.InitTemplates()
+	os.Exit(m.Run())
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbConn, err := db.OpenDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbConn.Close() })
+	if _, err := db.MigrateUp(dbConn); err != nil {
+		t.Fatal(err)
+	}
+	return dbConn
+}
+
+// A page link with a mangled cursor is the client's mistake.
+func TestBrokenPageLink(t *testing.T) {
+	dbConn := newTestDB(t)
+	var userID, category int
+	if err := dbConn.QueryRow(`INSERT INTO users (email, username, password) VALUES ('ann@example.com', 'ann', 'x') RETURNING id`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbConn.QueryRow(`INSERT INTO categories (name) VALUES ('General') RETURNING id`).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreatePost(dbConn, userID, category, "Hello #books", "Text", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", NewHomeHandler(dbConn, 20))
+	mux.HandleFunc("/category/", NewCategoryHandler(dbConn, 20))
+	mux.HandleFunc("/tag/{name}", NewTagHandler(dbConn, 20))
+	mux.HandleFunc("/u/", NewProfileHandler(dbConn, 20))
+
+	cursor := db.Cursor{CreatedAt: time.Now(), ID: 1}.String()
+	for _, path := range []string{"/", fmt.Sprintf("/category/%d", category), "/tag/books", "/u/ann"} {
+		tests := []struct {
+			query  string
+			status int
+		}{
+			{"", http.StatusOK},
+			{"?before=" + cursor, http.StatusOK},
+			{"?after=" + cursor, http.StatusOK},
+			{"?before=1-1'--", http.StatusBadRequest},
+			{"?after=99999999999999999999-1", http.StatusBadRequest},
+			{"?before=253402300800-1", http.StatusBadRequest},
+			{"?after=-1", http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+tt.query, nil))
+			if w.Code != tt.status {
+				t.Errorf("%s%s: status %d, want %d", path, tt.query, w.Code, tt.status)
+			}
+		}
+	}
+	// The profile's second listing has its own cursor
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/u/ann?likes_before=x", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("/u/ann?likes_before=x: status %d", w.Code)
+	}
+}
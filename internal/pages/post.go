@@ -14,24 +14,51 @@ import (
 )
 
 // NewShowPostHandler serves the single post page and handles new comment submissions.
-// - GET: Show the post, its comments, likes, etc.
-// - POST: Add a new comment (only if logged in), then redirect back to the same post page.
-func NewShowPostHandler(dbConn *sql.DB) http.HandlerFunc {
+//   - GET /post/{id}: Show the post, its comment threads, likes, etc.
+//   - GET /post/{id}/comment/{cid}: Show only the thread below comment cid
+//     ("continue this thread" for replies deeper than maxDepth).
+//   - POST /post/{id}: Add a new comment or reply (only if logged in), then redirect back.
+//
+// maxDepth is how many reply levels are rendered, collapseDepth the level from
+// which branches start folded.
+func NewShowPostHandler(dbConn *sql.DB, maxDepth, collapseDepth int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Extract the post ID from the URL path (e.g. /post/5)
-		idStr := strings.TrimPrefix(r.URL.Path, "/post/")
-		postID, _ := strconv.Atoi(idStr)
+		// Extract the post ID (and optional comment ID) from the URL path
+		// (e.g. /post/5 or /post/5/comment/12)
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 2 && !(len(parts) == 4 && parts[2] == "comment") {
+			http.NotFound(w, r)
+			return
+		}
+		postID, _ := strconv.Atoi(parts[1])
+		rootID := 0
+		if len(parts) == 4 {
+			var err error
+			if rootID, err = strconv.Atoi(parts[3]); err != nil {
+				http.NotFound(w, r)
+				return
+			}
+		}
 
-		// If the method is POST, process a new comment
+		// If the method is POST, process a new comment or reply
 		if r.Method == http.MethodPost {
-			userID, _, ok := middleware.CurrentUser(r)
+			target := fmt.Sprintf("/post/%d", postID)
+			userID, username, ok := middleware.CurrentUser(r)
 			if ok {
-				if text := strings.TrimSpace(r.FormValue("comment")); text != "" {
-					_ = db.AddComment(dbConn, postID, userID, text)
+				parentID, _ := strconv.Atoi(r.FormValue("parent_id"))
+				text := strings.TrimSpace(r.FormValue("comment"))
+				if msg := commentTooLong(text); msg != "" {
+					middleware.ErrorHandler(w, http.StatusBadRequest, msg+".", true, username)
+					return
+				}
+				if text != "" {
+					if id, err := db.AddComment(dbConn, postID, userID, parentID, text); err == nil {
+						target += fmt.Sprintf("#comment-%d", id)
+					}
 				}
 			}
 			// Always redirect back to the post after comment submission
-			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			http.Redirect(w, r, target, http.StatusSeeOther)
 			return
 		}
 
@@ -44,36 +71,69 @@ func NewShowPostHandler(dbConn *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		post.Tags, _ = db.FetchPostHashtags(dbConn, postID)
+
 		// Fetch the comments for the post, with per-user like info
 		comments, _ := db.GetComments(dbConn, postID, viewerID)
 		fmt.Printf("Found %d comments for post %d\n", len(comments), postID)
+
+		// Admins and the category's moderators may remove and lock content here
+		canModerate := false
+		if logged {
+			canModerate, _ = db.CanModerate(dbConn, viewerID, post.CategoryID)
+		}
+
+		// Removed comments keep their slot; only moderators may read the original text
+		for i := range comments {
+			if comments[i].Deleted && !canModerate {
+				comments[i].Content = ""
+			}
+		}
+
+		// Arrange comments into reply threads
+		view := &ThreadView{
+			PostID:        postID,
+			LoggedIn:      logged,
+			CurrentUserID: viewerID,
+			CanModerate:   canModerate,
+			Locked:        post.Locked,
+			ReportReasons: models.ReportReasons,
+			CSRFToken:     views.CSRFToken(r),
+		}
+		thread := buildCommentTree(comments, rootID, maxDepth, collapseDepth, view)
+		if rootID != 0 && len(thread) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
 		// Fetch categories for sidebar
 		categories, _ := db.FetchCategories(dbConn)
 
-		// Recalculate likes/comments for accurate display
-		likes, _ := db.CountLikesByPostID(dbConn, postID)
-		post.Likes = likes
-		post.Comments = len(comments)
-
 		// Prepare the template data for rendering the post page
 		data := struct {
+			models.BasePageData
 			Post          models.Post
-			Comments      []models.Comment
-			LoggedIn      bool
-			Username      string
+			Thread        []CommentNode
+			FocusedThread bool // showing a single branch via /post/{id}/comment/{cid}
 			Categories    []models.Category
 			CurrentUserID int
+			CanModerate   bool
+			ReportReasons []string
+			Reported      bool // just sent a report
 		}{
 			Post:          post,
-			Comments:      comments,
-			LoggedIn:      logged,
-			Username:      username,
+			Thread:        thread,
+			FocusedThread: rootID != 0,
+			BasePageData:  models.BasePageData{Username: username, LoggedIn: logged},
 			Categories:    categories,
 			CurrentUserID: viewerID,
+			CanModerate:   canModerate,
+			ReportReasons: models.ReportReasons,
+			Reported:      r.URL.Query().Get("reported") == "1",
 		}
 
 		// Render the post.html template with the data
-		err = views.Templates.ExecuteTemplate(w, "post.html", data)
+		err = views.Render(w, r, "post.html", data)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
@@ -81,7 +141,7 @@ func NewShowPostHandler(dbConn *sql.DB) http.HandlerFunc {
 }
 
 // NewDeletePostHandler handles POST requests to delete a post.
-// - Only the post owner can delete their post.
+// - The post owner, the category's moderators and admins can delete it.
 // - On success, redirects to home page. Otherwise, shows error or asks login.
 func NewDeletePostHandler(dbConn *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -104,12 +164,12 @@ func NewDeletePostHandler(dbConn *sql.DB) http.HandlerFunc {
 			http.Error(w, "Invalid post ID", http.StatusBadRequest)
 			return
 		}
-		// Try to delete the post (only if it belongs to the user)
-		err = db.DeletePostByID(dbConn, postID, userID)
+		// Try to delete the post (only if it belongs to the user or they moderate it)
+		err = db.DeletePostByID(dbConn, postID, userID, strings.TrimSpace(r.FormValue("reason")))
 		if err != nil {
-			// Not found or not the owner
+			// Not found or not allowed
 			if err == sql.ErrNoRows {
-				http.Error(w, "Post not found or not yours", http.StatusForbidden)
+				http.Error(w, "Post not found or you may not delete it", http.StatusForbidden)
 			} else {
 				http.Error(w, "Could not delete post: "+err.Error(), http.StatusInternalServerError)
 			}
@@ -120,3 +180,37 @@ func NewDeletePostHandler(dbConn *sql.DB) http.HandlerFunc {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
+
+// NewLockPostHandler handles POST /lockpost: locks (lock=1) or unlocks (lock=0)
+// a post so that it takes no new comments.
+// - Only the category's moderators and admins can do this.
+// - On success, redirects back to the post.
+func NewLockPostHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := middleware.CurrentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		postID, err := strconv.Atoi(r.FormValue("post_id"))
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+		locked := r.FormValue("lock") == "1"
+		if err := db.SetPostLocked(dbConn, postID, userID, locked, strings.TrimSpace(r.FormValue("reason"))); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Post not found or you may not moderate it", http.StatusForbidden)
+			} else {
+				http.Error(w, "Could not lock post: "+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		log.Printf("User %d set post %d locked=%v", userID, postID, locked)
+		http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+	}
+}
@@ -8,24 +8,32 @@ import (
 	"literary-lions/internal/views"
 	"net/http"
 	"strings"
-	"time"
 )
 
 // ProfilePageData structures the data needed for rendering a user profile page.
 type ProfilePageData struct {
 	models.BasePageData
-	MyPosts    []models.Post     // Posts authored by this user
-	MyLikes    []models.Post     // Posts this user has liked
-	Categories []models.Category // All available categories
+	MyPosts      []models.Post     // Posts authored by this user
+	MyPostsPager models.Pager      // Paging through MyPosts (?before= / ?after=)
+	MyLikes      []models.Post     // Posts this user has liked
+	MyLikesPager models.Pager      // Paging through MyLikes (?likes_before= / ?likes_after=)
+	Categories   []models.Category // All available categories
+
+	// On the viewer's own profile: their email address, if it still needs
+	// confirming, and a notice after following or asking for the link.
+	Own             bool
+	UnverifiedEmail string
+	Notice          string
 }
 
 // NewProfileHandler serves a user's public profile at /u/{username}.
-// It shows their posts, their liked posts, and categories.
+// It shows their posts, their liked posts (each list paged separately,
+// pageSize per page), and categories.
 // If the username does not exist, a 404 is returned.
-func NewProfileHandler(dbConn *sql.DB) http.HandlerFunc {
+func NewProfileHandler(dbConn *sql.DB, pageSize int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get session info for highlighting or display (who's viewing)
-		_, sessionUsername, loggedIn := middleware.CurrentUser(r)
+		viewerID, sessionUsername, loggedIn := middleware.CurrentUser(r)
 
 		// Parse the URL to extract the profile username (/u/{username})
 		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
@@ -35,113 +43,85 @@ func NewProfileHandler(dbConn *sql.DB) http.HandlerFunc {
 		}
 		profileUsername := parts[1]
 
-		// Look up the user ID for the given username
+		// Look up the user ID for the given username; a former name of
+		// someone who has since renamed themselves leads to them
 		var userID int
 		if err := dbConn.QueryRow(
 			"SELECT id FROM users WHERE username = ?", profileUsername).
 			Scan(&userID); err != nil {
+			if current, err := db.UsernameRedirect(dbConn, profileUsername); err == nil {
+				target := "/u/" + current
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
 			http.NotFound(w, r)
 			return
 		}
 
+		// --- Read both listings' page cursors ---
+		postsOpts, ok := pageOpts(r, "", pageSize)
+		likesOpts, likesOK := pageOpts(r, "likes_", pageSize)
+		if !ok || !likesOK {
+			http.Error(w, "Invalid page link", http.StatusBadRequest)
+			return
+		}
+
 		// --- Fetch posts authored by this user ---
-		postRows, err := dbConn.Query(`
-			SELECT
-				p.id, p.user_id, p.category_id,
-				p.title, p.content, COALESCE(p.image,''),
-				p.created_at,
-				u.username, c.name,
-				(SELECT COUNT(*) FROM post_likes WHERE post_id=p.id AND value=1) AS likes,
-				(SELECT COUNT(*) FROM comments   WHERE post_id=p.id)            AS comments
-			FROM posts p
-			JOIN users      u ON u.id = p.user_id
-			JOIN categories c ON c.id = p.category_id
-			WHERE p.user_id = ?
-			ORDER BY p.created_at DESC;
-		`, userID)
+		myPosts, err := db.FetchPostsByUser(dbConn, userID, viewerID, postsOpts)
 		if err != nil {
 			http.Error(w, "Error loading posts", 500)
 			return
 		}
-		defer postRows.Close()
-
-		var myPosts []models.Post
-		for postRows.Next() {
-			var (
-				p           models.Post
-				createdText string
-			)
-			if err := postRows.Scan(
-				&p.ID, &p.UserID, &p.CategoryID,
-				&p.Title, &p.Content, &p.Image,
-				&p.CreatedAt,
-				&p.Author, &p.Category,
-				&p.Likes, &p.Comments,
-			); err != nil {
-				continue
-			}
-			if t, err := time.Parse("2006-01-02 15:04:05", createdText); err == nil {
-				p.CreatedAt = t
-			}
-			myPosts = append(myPosts, p)
-		}
 
 		// --- Fetch posts liked by this user ---
-		likeRows, err := dbConn.Query(`
-			SELECT
-				p.id, p.user_id, p.category_id,
-				p.title, p.content, COALESCE(p.image,''),
-				p.created_at,
-				u.username, c.name,
-				(SELECT COUNT(*) FROM post_likes WHERE post_id=p.id AND value=1) AS likes,
-				(SELECT COUNT(*) FROM comments   WHERE post_id=p.id)            AS comments
-			FROM post_likes l
-			JOIN posts      p ON p.id = l.post_id
-			JOIN users      u ON u.id = p.user_id
-			JOIN categories c ON c.id = p.category_id
-			WHERE l.user_id = ? AND l.value = 1
-			ORDER BY p.created_at DESC;
-		`, userID)
+		myLikes, err := db.FetchPostsLikedBy(dbConn, userID, viewerID, likesOpts)
 		if err != nil {
 			http.Error(w, "Error loading liked posts", 500)
 			return
 		}
-		defer likeRows.Close()
 
-		var myLikes []models.Post
-		for likeRows.Next() {
-			var (
-				p           models.Post
-				createdText string
-			)
-			if err := likeRows.Scan(
-				&p.ID, &p.UserID, &p.CategoryID,
-				&p.Title, &p.Content, &p.Image,
-				&p.CreatedAt,
-				&p.Author, &p.Category,
-				&p.Likes, &p.Comments,
-			); err != nil {
-				continue
+		// --- Fetch all categories for sidebar ---
+		categories, _ := db.FetchCategories(dbConn)
+
+		// --- On their own profile, remind users to confirm their email ---
+		var unverifiedEmail, notice string
+		if loggedIn && viewerID == userID {
+			email, unverified, err := db.UnverifiedEmail(dbConn, userID)
+			if err != nil {
+				http.Error(w, "Error loading profile", 500)
+				return
 			}
-			if t, err := time.Parse("2006-01-02 15:04:05", createdText); err == nil {
-				p.CreatedAt = t
+			if unverified {
+				unverifiedEmail = email
+			}
+			switch {
+			case r.URL.Query().Get("verified") == "1":
+				notice = "Your email address is confirmed. You can post now."
+			case r.URL.Query().Get("sent") == "1":
+				notice = "We've sent you a new confirmation link."
 			}
-			myLikes = append(myLikes, p)
 		}
 
-		// --- Fetch all categories for sidebar ---
-		categories, _ := db.FetchCategories(dbConn)
 		// --- Prepare and render the profile page ---
 		data := ProfilePageData{
 			BasePageData: models.BasePageData{
 				Username: sessionUsername,
 				LoggedIn: loggedIn,
 			},
-			MyPosts:    myPosts,
-			MyLikes:    myLikes,
-			Categories: categories,
+			MyPosts:      myPosts.Posts,
+			MyPostsPager: pagerLinks(r, "", myPosts),
+			MyLikes:      myLikes.Posts,
+			MyLikesPager: pagerLinks(r, "likes_", myLikes),
+			Categories:   categories,
+
+			Own:             loggedIn && viewerID == userID,
+			UnverifiedEmail: unverifiedEmail,
+			Notice:          notice,
 		}
-		views.Templates.ExecuteTemplate(w, "profile.html", data)
+		views.Render(w, r, "profile.html", data)
 	}
 }
 
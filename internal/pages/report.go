@@ -0,0 +1,63 @@
+package pages
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/internal/db"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxReportDetails caps the free-text part of a report.
+const maxReportDetails = 1000
+
+// NewReportHandler handles POST /report: a logged-in reader flags a post
+// (post_id) or one of its comments (post_id and comment_id) for the
+// moderators, with one of models.ReportReasons and optional details.
+// Redirects back to the post with a thank-you note.
+func NewReportHandler(dbConn *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := middleware.CurrentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		postID, err := strconv.Atoi(r.FormValue("post_id"))
+		if err != nil {
+			middleware.ErrorHandler(w, http.StatusBadRequest, "Invalid post ID.", true, username)
+			return
+		}
+		commentID, _ := strconv.Atoi(r.FormValue("comment_id"))
+		reason := r.FormValue("reason")
+		if !slices.Contains(models.ReportReasons, reason) {
+			middleware.ErrorHandler(w, http.StatusBadRequest, "Please pick a reason for the report.", true, username)
+			return
+		}
+		details := strings.TrimSpace(r.FormValue("details"))
+		if runes := []rune(details); len(runes) > maxReportDetails {
+			details = string(runes[:maxReportDetails])
+		}
+
+		if err := db.CreateReport(dbConn, userID, postID, commentID, reason, details); err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not send the report.", true, username)
+			return
+		}
+
+		target := fmt.Sprintf("/post/%d?reported=1", postID)
+		if commentID != 0 {
+			target += fmt.Sprintf("#comment-%d", commentID)
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	}
+}
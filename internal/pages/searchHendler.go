@@ -4,109 +4,139 @@ import (
 	"database/sql"
 	"fmt"
 	"literary-lions/internal/db"
+	"literary-lions/internal/hashtag"
 	"literary-lions/internal/middleware"
 	"literary-lions/internal/models"
+	"literary-lions/internal/search"
 	"literary-lions/internal/views"
+	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
-	"time"
 )
 
 // NewSearchHandler returns an HTTP handler for processing search requests.
 // Supports:
 //   - Redirect to category page if query matches a category name.
 //   - Redirect to user profile if query matches a username.
-//   - Searches post titles and lists results if found.
-//   - Redirects to the post if only one result, otherwise shows results list.
-func NewSearchHandler(dbConn *sql.DB) http.HandlerFunc {
+//   - Redirect to the tag page if the query is a single #hashtag.
+//   - Searches post titles, content and comments (full-text, best match first,
+//     when fullText says SQLite has FTS5, see db.EnsureSearchIndex) and lists
+//     results with highlighted snippets.
+//     The query may use "exact phrases", #hashtags (or ?tag= parameters) and
+//     the operators author:, category:, before:, after:, likes: and sort:
+//     (see package search); active filters are shown as removable chips.
+//   - Shows a message (400) if the query can't be parsed.
+//   - Redirects to the post if only one result, otherwise shows results list
+//     (pageSize per page, paged with ?page=).
+func NewSearchHandler(dbConn *sql.DB, pageSize int, fullText bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get current user session for personalized features.
 		userID, username, loggedIn := middleware.CurrentUser(r)
 		// Get and trim the search query from the URL.
 		query := strings.TrimSpace(r.URL.Query().Get("q"))
-		if query == "" {
-			// If no query provided, redirect back to the home page.
-			http.Redirect(w, r, "/", http.StatusSeeOther)
-			return
+		categories, _ := db.FetchCategories(dbConn)
+		data := models.SearchResultsPageData{
+			BasePageData: models.BasePageData{
+				Username: username,
+				LoggedIn: loggedIn,
+			},
+			Query:      query,
+			Categories: categories,
 		}
-		// --- 1. Check for category name match (case-insensitive) ---
-		var categoryID int
-		err := dbConn.QueryRow("SELECT id FROM categories WHERE LOWER(name) = LOWER(?)", query).Scan(&categoryID)
-		if err == nil {
-			// Redirect to the matched category page.
-			http.Redirect(w, r, fmt.Sprintf("/category/%d", categoryID), http.StatusSeeOther)
+
+		// --- 0. Parse the query into words, phrases, #hashtags and operators ---
+		parsed, err := search.Parse(query)
+		if err != nil {
+			// Show what is wrong with the query instead of searching
+			data.Error = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			views.Render(w, r, "search_results.html", data)
 			return
 		}
-
-		// --- 2. Check for exact username match (case-insensitive) ---
-		var usernameFound string
-		err = dbConn.QueryRow("SELECT username FROM users WHERE LOWER(username) = LOWER(?)", query).Scan(&usernameFound)
-		if err == nil {
-			// Redirect to the user profile page.
-			http.Redirect(w, r, "/u/"+usernameFound, http.StatusSeeOther)
+		// ?tag= parameters add hashtag filters, like #tags typed in the query
+		for _, t := range r.URL.Query()["tag"] {
+			if name := hashtag.Normalize(t); name != "" && !slices.Contains(parsed.Tags, name) {
+				parsed.Tags = append(parsed.Tags, name)
+				parsed.Terms = append(parsed.Terms, search.Term{Kind: search.Tag, Value: name, Raw: "#" + name})
+			}
+		}
+		if len(parsed.Terms) == 0 {
+			// If no query provided, redirect back to the home page.
+			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
-		// --- 3. Search for posts by title (case-insensitive, partial match) ---
-		rows, err := dbConn.Query(`
-			SELECT p.id, p.user_id, p.category_id, p.title, p.content, COALESCE(p.image, ''), 
-			       p.created_at, u.username, c.name,
-			       COALESCE(l.value, 0)
-			FROM posts p
-			JOIN users u ON p.user_id = u.id
-			JOIN categories c ON p.category_id = c.id
-			LEFT JOIN post_likes l ON l.post_id = p.id AND l.user_id = ?
-			WHERE LOWER(p.title) LIKE LOWER(?)
-			ORDER BY p.created_at DESC
-			LIMIT 50
-		`, userID, "%"+query+"%")
-		if err != nil {
-			http.Error(w, "DB error", 500)
+		if len(parsed.Terms) == 1 && len(parsed.Tags) == 1 {
+			// Just "#tag": show the tag page
+			http.Redirect(w, r, "/tag/"+url.PathEscape(parsed.Tags[0]), http.StatusSeeOther)
 			return
 		}
-		defer rows.Close()
 
-		var results []models.Post
-		for rows.Next() {
-			var post models.Post
-			var createdAt time.Time
-			err := rows.Scan(
-				&post.ID, &post.UserID, &post.CategoryID, &post.Title, &post.Content,
-				&post.Image, &createdAt, &post.Author, &post.Category,
-				&post.UserLikeValue,
-			)
+		// Plain words may name a category or a user; operators mean a post search
+		if !parsed.HasOperators() {
+			// --- 1. Check for category name match (case-insensitive) ---
+			var categoryID int
+			err := dbConn.QueryRow("SELECT id FROM categories WHERE LOWER(name) = LOWER(?)", query).Scan(&categoryID)
 			if err == nil {
-				post.CreatedAt = createdAt
-				post.Likes, _ = db.CountLikesByPostID(dbConn, post.ID)
-				post.Comments, _ = db.CountCommentsByPostID(dbConn, post.ID)
-				results = append(results, post)
+				// Redirect to the matched category page.
+				http.Redirect(w, r, fmt.Sprintf("/category/%d", categoryID), http.StatusSeeOther)
+				return
+			}
+
+			// --- 2. Check for exact username match (case-insensitive) ---
+			var usernameFound string
+			err = dbConn.QueryRow("SELECT username FROM users WHERE LOWER(username) = LOWER(?)", query).Scan(&usernameFound)
+			if err == nil {
+				// Redirect to the user profile page.
+				http.Redirect(w, r, "/u/"+usernameFound, http.StatusSeeOther)
+				return
 			}
 		}
 
-		categories, _ := db.FetchCategories(dbConn)
-		// --- 4. If exactly one post found, redirect directly to it. ---
-		if len(results) == 1 {
-			http.Redirect(w, r, fmt.Sprintf("/post/%d", results[0].ID), http.StatusSeeOther)
+		// --- 3. Search posts (title, content and comments) ---
+		// Every hashtag and operator adds a filter the post must pass.
+		pageNum, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pageNum = max(pageNum, 1)
+		filter := db.PostSearch{
+			Words:    parsed.Words,
+			Phrases:  parsed.Phrases,
+			Tags:     parsed.Tags,
+			Author:   parsed.Author,
+			Category: parsed.Category,
+			Before:   parsed.Before,
+			After:    parsed.After,
+			LikesOp:  parsed.LikesOp,
+			Likes:    parsed.Likes,
+			Sort:     parsed.Sort,
+		}
+		results, err := db.SearchPosts(dbConn, filter, userID, db.SearchOpts{Page: pageNum, Limit: pageSize, FullText: fullText})
+		if err != nil {
+			log.Println("search:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Search failed. Please try again later.", loggedIn, username)
+			return
+		}
+
+		// --- 4. If exactly one post found by a plain search, redirect directly to it. ---
+		if pageNum == 1 && len(results.Posts) == 1 && !results.More && !parsed.HasOperators() {
+			http.Redirect(w, r, fmt.Sprintf("/post/%d", results.Posts[0].ID), http.StatusSeeOther)
 			return
 		}
 
 		// --- 5. Otherwise, render the search results page ---
-		data := struct {
-			models.BasePageData
-			Query      string
-			NotFound   bool
-			Results    []models.Post
-			Categories []models.Category
-		}{
-			BasePageData: models.BasePageData{
-				Username: username,
-				LoggedIn: loggedIn,
-			},
-			Query:      query,
-			NotFound:   len(results) == 0,
-			Results:    results,
-			Categories: categories,
+		for i, t := range parsed.Terms {
+			if t.IsFilter() {
+				data.Filters = append(data.Filters, models.FilterChip{
+					Label:     t.Label(),
+					RemoveURL: "/search?q=" + url.QueryEscape(parsed.Without(i)),
+				})
+			}
 		}
+		data.NotFound = len(results.Posts) == 0
+		data.Results = results.Posts
+		data.Pager = NumberedPagerLinks(r, pageNum, results.More)
 		// Render the template with search results (or not found message)
-		views.Templates.ExecuteTemplate(w, "search_results.html", data)
+		views.Render(w, r, "search_results.html", data)
 	}
 }
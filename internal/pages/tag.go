@@ -0,0 +1,60 @@
+package pages
+
+import (
+	"database/sql"
+	"literary-lions/internal/db"
+	"literary-lions/internal/hashtag"
+	"literary-lions/internal/middleware"
+	"literary-lions/internal/models"
+	"literary-lions/internal/views"
+	"log"
+	"net/http"
+)
+
+// TagPageData holds everything needed to render a hashtag page.
+type TagPageData struct {
+	models.BasePageData
+	Tag        string
+	Posts      []models.Post
+	Pager      models.Pager
+	Categories []models.Category
+	Tags       []models.Tag
+}
+
+// NewTagHandler serves /tag/{name}: every post carrying that hashtag,
+// newest first and pageSize per page, plus the tag cloud for browsing further.
+func NewTagHandler(dbConn *sql.DB, pageSize int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, loggedIn := middleware.CurrentUser(r)
+
+		name := hashtag.Normalize(r.PathValue("name"))
+		if name == "" {
+			middleware.ErrorHandler(w, http.StatusNotFound, "No such tag", loggedIn, username)
+			return
+		}
+
+		opts, ok := pageOpts(r, "", pageSize)
+		if !ok {
+			middleware.ErrorHandler(w, http.StatusBadRequest, "This page link is broken.", loggedIn, username)
+			return
+		}
+		page, err := db.FetchPostsByHashtag(dbConn, name, userID, opts)
+		if err != nil {
+			log.Println("DB problem:", err)
+			middleware.ErrorHandler(w, http.StatusInternalServerError, "Could not load posts for this tag.", loggedIn, username)
+			return
+		}
+		categories, _ := db.FetchCategories(dbConn)
+		tags, _ := db.FetchTagCloud(dbConn, 30)
+
+		data := TagPageData{
+			BasePageData: models.BasePageData{Username: username, LoggedIn: loggedIn},
+			Tag:          name,
+			Posts:        page.Posts,
+			Pager:        pagerLinks(r, "", page),
+			Categories:   categories,
+			Tags:         tags,
+		}
+		views.Render(w, r, "tag.html", data)
+	}
+}
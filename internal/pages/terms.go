@@ -25,7 +25,7 @@ func TermsPageHandler(dbConn *sql.DB) http.HandlerFunc {
 			Username: username,
 		}
 		// Render the terms.html template with the prepared data
-		err := views.Templates.ExecuteTemplate(w, "terms.html", data)
+		err := views.Render(w, r, "terms.html", data)
 		fmt.Println("Terms handler called!")
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,83 @@
+package pages
+
+import "literary-lions/internal/models"
+
+// ThreadView holds the page-wide settings every comment in a thread needs
+// when the "comment" template renders itself recursively.
+type ThreadView struct {
+	PostID        int
+	LoggedIn      bool
+	CurrentUserID int
+	CanModerate   bool
+	Locked        bool // the post takes no new replies
+	ReportReasons []string
+	CSRFToken     string // for the comment forms
+}
+
+// CommentNode is a comment with the replies shown beneath it.
+type CommentNode struct {
+	models.Comment
+	Depth     int           // 0 for the top of the rendered thread
+	Replies   []CommentNode // direct replies, oldest first
+	Collapsed bool          // render the replies folded away
+	// Continue is set when the comment has replies that are deeper than the
+	// page shows; they are reached through a "continue this thread" link.
+	Continue bool
+	Thread   *ThreadView
+}
+
+// buildCommentTree arranges a flat, newest-first comment list into threads.
+// With rootID == 0 it returns all top-level comments (newest first);
+// otherwise it returns the single comment rootID as the top of the tree.
+// Replies deeper than maxDepth are cut off and flagged with Continue;
+// branches from collapseDepth downwards start collapsed.
+func buildCommentTree(comments []models.Comment, rootID, maxDepth, collapseDepth int, view *ThreadView) []CommentNode {
+	children := map[int][]models.Comment{}
+	byID := map[int]models.Comment{}
+	for _, c := range comments {
+		byID[c.ID] = c
+	}
+	// The list is newest first; walk it backwards so replies read in order.
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		parent := c.ParentID
+		if _, ok := byID[parent]; !ok {
+			parent = 0 // orphaned reply: show it at the top level
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	var build func(c models.Comment, depth int) CommentNode
+	build = func(c models.Comment, depth int) CommentNode {
+		node := CommentNode{Comment: c, Depth: depth, Thread: view}
+		replies := children[c.ID]
+		if len(replies) == 0 {
+			return node
+		}
+		if depth >= maxDepth {
+			node.Continue = true
+			return node
+		}
+		node.Collapsed = depth+1 >= collapseDepth
+		for _, r := range replies {
+			node.Replies = append(node.Replies, build(r, depth+1))
+		}
+		return node
+	}
+
+	if rootID != 0 {
+		root, ok := byID[rootID]
+		if !ok {
+			return nil
+		}
+		return []CommentNode{build(root, 0)}
+	}
+
+	// Top-level comments stay newest first, as before threading existed.
+	top := children[0]
+	nodes := make([]CommentNode, 0, len(top))
+	for i := len(top) - 1; i >= 0; i-- {
+		nodes = append(nodes, build(top[i], 0))
+	}
+	return nodes
+}
@@ -0,0 +1,125 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prefixLen is how many hex characters of a SHA-1 hash name a range, as in
+// the Pwned Passwords k-anonymity API.
+const prefixLen = 5
+
+// Breached is a local list of passwords known to have leaked, stored as
+// SHA-1 hashes so the list itself gives nothing away. It is loaded in one of
+// two layouts:
+//   - a file with one upper- or lower-case hash per line, optionally
+//     followed by ":count", which is read into memory;
+//   - a directory of range files named after a five character prefix
+//     (like "21BD1" or "21BD1.txt"), each listing the remaining 35
+//     characters as "SUFFIX:COUNT" lines, as the range API serves them.
+//     Only the one range a password falls in is read, so this suits the
+//     full list.
+//
+// Nothing is ever sent over the network. A nil *Breached contains nothing.
+type Breached struct {
+	dir    string
+	ranges map[string]map[string]struct{} // prefix -> suffixes
+}
+
+// LoadBreached opens the list at path.
+func LoadBreached(path string) (*Breached, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &Breached{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := &Breached{ranges: make(map[string]map[string]struct{})}
+	err = eachHash(f, func(hash string) error {
+		if len(hash) != 2*sha1.Size {
+			return fmt.Errorf("%q is not a SHA-1 hash", hash)
+		}
+		prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+		if b.ranges[prefix] == nil {
+			b.ranges[prefix] = make(map[string]struct{})
+		}
+		b.ranges[prefix][suffix] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Contains reports whether password is on the list.
+func (b *Breached) Contains(password string) (bool, error) {
+	if b == nil {
+		return false, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+
+	if b.ranges != nil {
+		_, found := b.ranges[prefix][suffix]
+		return found, nil
+	}
+
+	f, err := os.Open(filepath.Join(b.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(b.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil // no leaked password has this prefix
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	found := false
+	err = eachHash(f, func(s string) error {
+		if s == suffix {
+			found = true
+			return io.EOF
+		}
+		return nil
+	})
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return found, err
+}
+
+// eachHash calls fn with the upper-cased hash on each line of r, dropping
+// any ":count" and skipping blank lines.
+func eachHash(r io.Reader, fn func(string) error) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if line == "" {
+			continue
+		}
+		if err := fn(strings.ToUpper(line)); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,90 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sha1Hex is the upper-case SHA-1 hash of password, as the lists have it.
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBreachedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	writeFile(t, path, strings.ToLower(sha1Hex("hunter2"))+":17\n\n  "+sha1Hex("letmein")+"  \n")
+	b, err := LoadBreached(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"hunter2", true},
+		{"letmein", true},
+		{"Hunter2", false},
+		{"correct horse battery staple", false},
+	}
+	for _, tt := range tests {
+		if got, err := b.Contains(tt.password); err != nil || got != tt.want {
+			t.Errorf("Contains(%q) = %v, %v; want %v", tt.password, got, err, tt.want)
+		}
+	}
+
+	writeFile(t, path, sha1Hex("hunter2")+"\nnot a hash\n")
+	if _, err := LoadBreached(path); err == nil {
+		t.Error("LoadBreached accepted a line that is not a hash")
+	}
+	if _, err := LoadBreached(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadBreached accepted a missing file")
+	}
+}
+
+func TestBreachedDir(t *testing.T) {
+	dir := t.TempDir()
+	hunter2, horse, miss := sha1Hex("hunter2"), sha1Hex("correct horse battery staple"), sha1Hex("Tr0ub4dor&3")
+	// A range file without an extension, and one with ".txt"
+	writeFile(t, filepath.Join(dir, hunter2[:prefixLen]), "0000000000000000000000000000000000A:3\n"+hunter2[prefixLen:]+":42\n")
+	writeFile(t, filepath.Join(dir, horse[:prefixLen]+".txt"), strings.ToLower(horse[prefixLen:])+":1\r\n")
+	// The range of a password that is not in it
+	writeFile(t, filepath.Join(dir, miss[:prefixLen]), "0000000000000000000000000000000000B:5\n")
+	b, err := LoadBreached(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{"hit", "hunter2", true},
+		{"hit in a .txt range", "correct horse battery staple", true},
+		{"miss in a range", "Tr0ub4dor&3", false},
+		{"no range file", "kX9#mQ2$vL7!", false},
+	}
+	for _, tt := range tests {
+		if got, err := b.Contains(tt.password); err != nil || got != tt.want {
+			t.Errorf("%s: Contains(%q) = %v, %v; want %v", tt.name, tt.password, got, err, tt.want)
+		}
+	}
+}
+
+func TestBreachedNil(t *testing.T) {
+	var b *Breached
+	if found, err := b.Contains("hunter2"); found || err != nil {
+		t.Errorf("nil list: %v, %v", found, err)
+	}
+}
@@ -0,0 +1,149 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher turns passwords into hashes for storage. Every hash carries its
+// algorithm and parameters, so any Hasher can check a hash made by another
+// (Verify), and tell when one is weaker than what it makes now
+// (NeedsRehash): such hashes are replaced when their owner next logs in.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, a bcrypt or
+	// argon2id hash.
+	Verify(encoded, password string) bool
+	// NeedsRehash reports whether encoded uses another algorithm, or
+	// weaker parameters, than this Hasher.
+	NeedsRehash(encoded string) bool
+}
+
+// NewHasher returns the Hasher for algorithm, "bcrypt" (at bcryptCost) or
+// "argon2id" (with DefaultArgon2id).
+func NewHasher(algorithm string, bcryptCost int) (Hasher, error) {
+	switch algorithm {
+	case "bcrypt":
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost %d is out of range (%d to %d)", bcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return Bcrypt{Cost: bcryptCost}, nil
+	case "argon2id":
+		return DefaultArgon2id, nil
+	}
+	return nil, fmt.Errorf("unknown password hash algorithm %q (use bcrypt or argon2id)", algorithm)
+}
+
+// Verify reports whether password matches encoded, whichever supported
+// algorithm made it. Unknown formats (like the "!" of accounts that cannot
+// log in) match nothing.
+func Verify(encoded, password string) bool {
+	switch {
+	case isBcrypt(encoded):
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		p, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false
+		}
+		got := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(got, key) == 1
+	}
+	return false
+}
+
+// Bcrypt hashes with bcrypt at Cost, as "$2a$<cost>$...".
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hash), err
+}
+
+func (b Bcrypt) Verify(encoded, password string) bool { return Verify(encoded, password) }
+
+func (b Bcrypt) NeedsRehash(encoded string) bool {
+	if !isBcrypt(encoded) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < b.Cost
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Argon2id hashes with argon2id, in the PHC string format:
+// "$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>", with salt
+// and key in unpadded base64.
+type Argon2id struct {
+	Memory  uint32 // in KiB
+	Time    uint32 // passes over the memory
+	Threads uint8
+}
+
+// DefaultArgon2id has the parameters RFC 9106 recommends where memory is
+// not plentiful: 64 MiB, three passes, four lanes.
+var DefaultArgon2id = Argon2id{Memory: 64 * 1024, Time: 3, Threads: 4}
+
+const (
+	argon2idPrefix = "$argon2id$"
+	argon2SaltLen  = 16
+	argon2KeyLen   = 32
+)
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, argon2KeyLen)
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		a.Memory, a.Time, a.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Verify(encoded, password string) bool { return Verify(encoded, password) }
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	p, _, key, err := decodeArgon2id(encoded)
+	return err != nil || p.Memory < a.Memory || p.Time < a.Time || p.Threads < a.Threads || len(key) < argon2KeyLen
+}
+
+// maxArgon2Memory is the most memory, in KiB, a stored hash may ask for:
+// 2 GiB, the larger of RFC 9106's recommendations.
+const maxArgon2Memory = 2 * 1024 * 1024
+
+// decodeArgon2id splits an argon2id hash into its parameters, salt and key.
+// Anything argon2.IDKey would panic on, or that is not exactly what Hash
+// writes, is an error.
+func decodeArgon2id(encoded string) (p Argon2id, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads)
+	if err != nil || parts[3] != fmt.Sprintf("m=%d,t=%d,p=%d", p.Memory, p.Time, p.Threads) ||
+		p.Time == 0 || p.Threads == 0 || p.Memory > maxArgon2Memory {
+		return p, nil, nil, fmt.Errorf("bad argon2id parameters %q", parts[3])
+	}
+	if salt, err = base64.RawStdEncoding.Strict().DecodeString(parts[4]); err != nil || len(salt) == 0 {
+		return p, nil, nil, fmt.Errorf("bad argon2id salt %q", parts[4])
+	}
+	if key, err = base64.RawStdEncoding.Strict().DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("bad argon2id key %q", parts[5])
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,145 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+// testArgon2id is cheap enough for tests.
+var testArgon2id = Argon2id{Memory: 64, Time: 1, Threads: 1}
+
+func TestHashRoundTrip(t *testing.T) {
+	for _, h := range []Hasher{Bcrypt{Cost: 4}, testArgon2id} {
+		encoded, err := h.Hash("correct horse battery")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !h.Verify(encoded, "correct horse battery") || !Verify(encoded, "correct horse battery") {
+			t.Errorf("%s: the password does not verify", encoded)
+		}
+		for _, wrong := range []string{"", "correct horse batter", "Correct horse battery"} {
+			if Verify(encoded, wrong) {
+				t.Errorf("%s: %q verifies", encoded, wrong)
+			}
+		}
+		if h.NeedsRehash(encoded) {
+			t.Errorf("%s: needs rehashing straight away", encoded)
+		}
+		// The same password hashes differently each time
+		if again, _ := h.Hash("correct horse battery"); again == encoded {
+			t.Errorf("%s: no salt", encoded)
+		}
+	}
+	if encoded, _ := testArgon2id.Hash("x"); !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("argon2id hash %q", encoded)
+	}
+}
+
+func TestVerifyUnknownFormats(t *testing.T) {
+	for _, encoded := range []string{"!", "", "x", "garbage", "$2a$", "$2a$04$short", "$argon2id$", "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5"} {
+		for _, pw := range []string{"", "!", "x", encoded} {
+			if Verify(encoded, pw) {
+				t.Errorf("Verify(%q, %q) = true", encoded, pw)
+			}
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcrypt4, err := Bcrypt{Cost: 4}.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon, err := testArgon2id.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		hasher  Hasher
+		encoded string
+		want    bool
+	}{
+		{"same bcrypt cost", Bcrypt{Cost: 4}, bcrypt4, false},
+		{"bcrypt cost up", Bcrypt{Cost: 5}, bcrypt4, true},
+		{"bcrypt cost down", Bcrypt{Cost: 4}, mustHash(t, Bcrypt{Cost: 5}), false},
+		{"same argon2 parameters", testArgon2id, argon, false},
+		{"argon2 memory up", Argon2id{Memory: 128, Time: 1, Threads: 1}, argon, true},
+		{"argon2 time up", Argon2id{Memory: 64, Time: 2, Threads: 1}, argon, true},
+		{"argon2 threads up", Argon2id{Memory: 64, Time: 1, Threads: 2}, argon, true},
+		{"argon2 parameters down", Argon2id{Memory: 32, Time: 1, Threads: 1}, argon, false},
+		{"bcrypt to argon2id", testArgon2id, bcrypt4, true},
+		{"argon2id to bcrypt", Bcrypt{Cost: 4}, argon, true},
+		{"no password, bcrypt", Bcrypt{Cost: 4}, "!", true},
+		{"no password, argon2id", testArgon2id, "!", true},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.NeedsRehash(tt.encoded); got != tt.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func mustHash(t *testing.T, h Hasher) string {
+	t.Helper()
+	encoded, err := h.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+// Malformed hashes are errors, not panics in argon2.IDKey or huge
+// allocations.
+func TestDecodeArgon2idMalformed(t *testing.T) {
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	valid := "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key
+	if _, _, _, err := decodeArgon2id(valid); err != nil {
+		t.Fatalf("valid hash: %v", err)
+	}
+	for _, encoded := range []string{
+		"$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key,
+		"$argon2id$v=19$m=64,t=1,p=256$" + salt + "$" + key,
+		"$argon2id$v=19$m=64,t=-1,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=64,t=1,p=1junk$" + salt + "$" + key,
+		"$argon2id$v=19$m=64,t=1$" + salt + "$" + key,
+		"$argon2id$v=19$p=1,t=1,m=64$" + salt + "$" + key,
+		"$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key,
+		"$argon2id$v=19junk$m=64,t=1,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=64,t=1,p=1$$" + key,
+		"$argon2id$v=19$m=64,t=1,p=1$" + salt + "$",
+		"$argon2id$v=19$m=64,t=1,p=1$" + salt + "$not base64!",
+		"$argon2id$v=19$m=64,t=1,p=1$" + salt,
+		"$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key + "$",
+		"x$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key,
+	} {
+		if _, _, _, err := decodeArgon2id(encoded); err == nil {
+			t.Errorf("decodeArgon2id(%q) accepted it", encoded)
+		}
+		if Verify(encoded, "pw") {
+			t.Errorf("Verify(%q) = true", encoded)
+		}
+		if !testArgon2id.NeedsRehash(encoded) {
+			t.Errorf("NeedsRehash(%q) = false", encoded)
+		}
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	if h, err := NewHasher("bcrypt", 10); err != nil || h != (Bcrypt{Cost: 10}) {
+		t.Errorf("bcrypt: %v, %v", h, err)
+	}
+	if h, err := NewHasher("argon2id", 0); err != nil || h != DefaultArgon2id {
+		t.Errorf("argon2id: %v, %v", h, err)
+	}
+	for _, bad := range []struct {
+		algorithm string
+		cost      int
+	}{{"bcrypt", 3}, {"bcrypt", 32}, {"scrypt", 10}, {"", 10}} {
+		if _, err := NewHasher(bad.algorithm, bad.cost); err == nil {
+			t.Errorf("NewHasher(%q, %d) accepted it", bad.algorithm, bad.cost)
+		}
+	}
+}
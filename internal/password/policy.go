@@ -0,0 +1,72 @@
+// Package password decides which passwords members may choose (long
+// enough, hard enough to guess, and not on a list of leaked passwords) and
+// how they are hashed for storage.
+package password
+
+import (
+	"fmt"
+	"log"
+)
+
+// MaxBytes is the longest password accepted, in bytes. bcrypt only reads
+// that much, and refuses to hash anything longer.
+const MaxBytes = 72
+
+// Policy is the set of rules a new password has to meet.
+type Policy struct {
+	MinLength int // in characters
+	// MinScore is the least Strength score accepted, from 0 (anything
+	// goes) to 4.
+	MinScore int
+	Breached *Breached // may be nil
+}
+
+// Error explains why a password was turned down.
+type Error struct {
+	Message     string
+	Suggestions []string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Check returns an *Error if password breaks the policy. userInputs are the
+// member's username, email address and the like, which make a password weak.
+func (p Policy) Check(password string, userInputs ...string) error {
+	if n := len([]rune(password)); n < p.MinLength {
+		return &Error{Message: fmt.Sprintf("Your password must be at least %d characters long.", p.MinLength)}
+	}
+	if len(password) > MaxBytes {
+		return &Error{
+			Message: fmt.Sprintf("Your password is too long: it can be at most %d characters, or fewer with accented letters or symbols.", MaxBytes),
+		}
+	}
+
+	breached, err := p.Breached.Contains(password)
+	if err != nil {
+		// A broken list should not keep people from signing up
+		log.Println("Breached password list:", err)
+	}
+	if breached {
+		return &Error{
+			Message:     "This password has appeared in a data breach, so attackers will try it. Please choose another.",
+			Suggestions: []string{"Don't reuse a password you use, or used, on another site."},
+		}
+	}
+
+	if est := Strength(password, userInputs...); est.Score < p.MinScore {
+		msg := "This password is too easy to guess."
+		if est.Warning != "" {
+			msg += " " + est.Warning
+		}
+		return &Error{Message: msg, Suggestions: est.Suggestions}
+	}
+	return nil
+}
+
+// Hint describes the policy for the password forms.
+func (p Policy) Hint() string {
+	if p.MinLength <= 1 {
+		return "Choose a password that is hard to guess."
+	}
+	return fmt.Sprintf("At least %d characters, and hard to guess: a few uncommon words work well.", p.MinLength)
+}
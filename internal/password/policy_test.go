@@ -0,0 +1,61 @@
+package password
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	writeFile(t, path, sha1Hex("correct horse battery staple")+"\n")
+	b, err := LoadBreached(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Policy{MinLength: 8, MinScore: 3, Breached: b}
+
+	tests := []struct {
+		name     string
+		password string
+		err      string // part of the message, "" if accepted
+	}{
+		{"fine", "lantern quarrel onion", ""},
+		{"too short", "kX9#mQ", "at least 8 characters"},
+		{"short in bytes, long in characters", "ÿÿÿÿÿÿÿ", "at least 8 characters"},
+		{"72 bytes", "lantern quarrel onion " + strings.Repeat("x7", 25), ""},
+		{"73 bytes", "lantern quarrel onion " + strings.Repeat("x7", 25) + "y", "too long"},
+		{"under 72 characters but over 72 bytes", strings.Repeat("ü", 37), "too long"},
+		{"breached", "correct horse battery staple", "data breach"},
+		{"guessable", "sunshine1", "too easy to guess"},
+		{"the username", "bertramwooster", "username, email"},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.password, "bertram_wooster", "bw@example.com")
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var perr *Error
+		if !errors.As(err, &perr) || !strings.Contains(perr.Message, tt.err) {
+			t.Errorf("%s: %v, want an *Error about %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// Whatever Check accepts can be hashed.
+func TestPolicyMaxBytesHashes(t *testing.T) {
+	pw := strings.Repeat("ü", MaxBytes/2)
+	if err := (Policy{}).Check(pw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Bcrypt{Cost: 4}).Hash(pw); err != nil {
+		t.Errorf("bcrypt: %v", err)
+	}
+	if _, err := (Bcrypt{Cost: 4}).Hash(pw + "x"); err == nil {
+		t.Error("bcrypt hashed a password Check turns down; MaxBytes can go up")
+	}
+}
@@ -0,0 +1,406 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Strength estimation in the style of zxcvbn: the password is split into the
+// cheapest sequence of guessable patterns (common passwords, the user's own
+// name, sequences, repeats, keyboard rows, years) with brute force for the
+// rest, and the number of guesses that takes is turned into a score.
+
+// maxAnalysed caps how much of a password is analysed; anything longer is
+// strong enough already and the estimate is quadratic in the length.
+const maxAnalysed = 64
+
+// Estimate is the result of rating a password.
+type Estimate struct {
+	Guesses float64 // roughly how many guesses an attacker needs
+	// Score runs from 0 (too guessable) to 4 (very unguessable).
+	Score       int
+	Warning     string   // what makes the password weak, if anything
+	Suggestions []string // how to make it stronger
+}
+
+//go:embed common.txt
+var commonList string
+
+// common ranks the common passwords and words, 1 being the most common.
+var common = loadRanked(commonList)
+
+func loadRanked(list string) map[string]int {
+	ranked := make(map[string]int)
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, ok := ranked[line]; !ok {
+			ranked[line] = len(ranked) + 1
+		}
+	}
+	return ranked
+}
+
+// siteWords are guessed along with the user's own details.
+var siteWords = []string{"literary", "lions", "literarylions"}
+
+// keyboardRows are the rows of a qwerty keyboard, for spotting "qwerty" or
+// "asdf" style passwords.
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+// leet undoes common character substitutions, as in "p@ssw0rd".
+var leet = strings.NewReplacer("4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+// match is a guessable pattern covering password[i:j].
+type match struct {
+	i, j    int
+	kind    string
+	guesses float64
+	leet    bool // a word matched once substitutions were undone
+}
+
+// Strength rates password. userInputs are words an attacker would try
+// first, such as the username and email address.
+func Strength(password string, userInputs ...string) Estimate {
+	runes := []rune(password)
+	if len(runes) > maxAnalysed {
+		runes = runes[:maxAnalysed]
+	}
+	if len(runes) == 0 {
+		return Estimate{Score: 0, Warning: "Enter a password."}
+	}
+
+	personal := make(map[string]int)
+	for _, in := range append(userInputs, siteWords...) {
+		in = strings.ToLower(strings.TrimSpace(in))
+		for _, word := range strings.FieldsFunc(in, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len([]rune(word)) >= 3 {
+				personal[word] = len(personal) + 1
+			}
+		}
+		if in != "" {
+			personal[in] = len(personal) + 1
+		}
+	}
+
+	matches := findMatches(runes, personal)
+	guesses, seq := cheapest(runes, matches)
+	est := Estimate{Guesses: guesses, Score: score(guesses)}
+	est.Warning, est.Suggestions = feedback(est.Score, seq, runes)
+	return est
+}
+
+// findMatches lists every pattern found in the password.
+func findMatches(runes []rune, personal map[string]int) []match {
+	lower := []rune(strings.ToLower(string(runes)))
+	n := len(runes)
+	var out []match
+
+	// Dictionary words, also reversed and with substitutions undone
+	for i := 0; i < n; i++ {
+		for j := i + 1; j <= n; j++ {
+			word := string(lower[i:j])
+			type variant struct {
+				word  string
+				extra float64
+				leet  bool
+			}
+			variants := []variant{{word, 1, false}, {reverse(word), 2, false}}
+			if l := leet.Replace(word); l != word {
+				variants = append(variants, variant{l, 2, true})
+			}
+			for _, v := range variants {
+				rank, kind := personal[v.word], "personal"
+				if rank == 0 {
+					rank, kind = common[v.word], "common"
+				}
+				if rank == 0 {
+					continue
+				}
+				g := float64(rank) * v.extra * caseVariations(runes[i:j])
+				out = append(out, match{i: i, j: j, kind: kind, guesses: g, leet: v.leet})
+			}
+		}
+	}
+
+	// Runs: repeated characters, sequences like "abcd" or "9876", and
+	// keyboard rows like "qwer"
+	for i := 0; i < n; {
+		j := i + 1
+		for j < n && lower[j] == lower[i] {
+			j++
+		}
+		if j-i >= 3 {
+			out = append(out, match{i: i, j: j, kind: "repeat", guesses: bruteCardinality * float64(j-i)})
+		}
+		i = j
+	}
+	for i := 0; i+2 < n; {
+		delta := lower[i+1] - lower[i]
+		j := i + 2
+		if delta == 1 || delta == -1 {
+			for j < n && lower[j]-lower[j-1] == delta {
+				j++
+			}
+		}
+		if j-i >= 3 && (delta == 1 || delta == -1) {
+			start := 26.0
+			if unicode.IsDigit(lower[i]) {
+				start = 10
+			}
+			if lower[i] == 'a' || lower[i] == '1' || lower[i] == 'z' || lower[i] == '9' {
+				start = 4
+			}
+			if delta == -1 {
+				start *= 2
+			}
+			out = append(out, match{i: i, j: j, kind: "sequence", guesses: start * float64(j-i)})
+			i = j - 1
+			continue
+		}
+		i++
+	}
+	for i := 0; i+2 < n; i++ {
+		for j := i + 3; j <= n; j++ {
+			if !onKeyboardRow(string(lower[i:j])) {
+				break
+			}
+			out = append(out, match{i: i, j: j, kind: "keyboard", guesses: 40 * float64(j-i)})
+		}
+	}
+
+	// Years from 1900 to 2099, and dates written as digits
+	for i := 0; i+4 <= n; i++ {
+		if y := digits(lower[i : i+4]); y >= 1900 && y <= 2099 {
+			out = append(out, match{i: i, j: i + 4, kind: "date", guesses: 200})
+		}
+		for _, l := range []int{6, 8} {
+			if i+l <= n && digits(lower[i:i+l]) >= 0 && looksLikeDate(lower[i:i+l]) {
+				out = append(out, match{i: i, j: i + l, kind: "date", guesses: 365 * 200})
+			}
+		}
+	}
+	return out
+}
+
+// cheapest finds the sequence of matches (with brute force in between) that
+// guesses the whole password soonest, zxcvbn style: k patterns cost k! times
+// the product of their guesses, as an attacker has to try them in any order.
+func cheapest(runes []rune, matches []match) (float64, []match) {
+	n := len(runes)
+	byEnd := make([][]match, n+1)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+	// best[j][k] is the least log10 guesses for runes[:j] in k patterns.
+	inf := math.Inf(1)
+	best := make([][]float64, n+1)
+	prev := make([][]match, n+1)
+	for j := range best {
+		best[j] = make([]float64, n+1)
+		prev[j] = make([]match, n+1)
+		for k := range best[j] {
+			best[j][k] = inf
+		}
+	}
+	best[0][0] = 0
+	for j := 1; j <= n; j++ {
+		candidates := byEnd[j]
+		for i := 0; i < j; i++ {
+			candidates = append(candidates, match{i: i, j: j, kind: "bruteforce", guesses: bruteGuesses(runes[i:j])})
+		}
+		for _, m := range candidates {
+			g := math.Log10(math.Max(m.guesses, minGuesses(m.j-m.i)))
+			for k := 0; k < n; k++ {
+				if best[m.i][k] == inf {
+					continue
+				}
+				if c := best[m.i][k] + g; c < best[j][k+1] {
+					best[j][k+1] = c
+					prev[j][k+1] = m
+				}
+			}
+		}
+	}
+	bestK, bestLog := 0, inf
+	for k := 1; k <= n; k++ {
+		if best[n][k] == inf {
+			continue
+		}
+		total := best[n][k] + logFactorial(k)
+		if total < bestLog {
+			bestK, bestLog = k, total
+		}
+	}
+	seq := make([]match, bestK)
+	for j, k := n, bestK; k > 0; k-- {
+		seq[k-1] = prev[j][k]
+		j = prev[j][k].i
+	}
+	return math.Pow(10, bestLog), seq
+}
+
+// score turns a guess count into 0 to 4, with the thresholds zxcvbn uses.
+func score(guesses float64) int {
+	switch {
+	case guesses < 1e3+5:
+		return 0
+	case guesses < 1e6+5:
+		return 1
+	case guesses < 1e8+5:
+		return 2
+	case guesses < 1e10+5:
+		return 3
+	}
+	return 4
+}
+
+// feedback explains a weak score by the pattern that gave it away.
+func feedback(score int, seq []match, runes []rune) (string, []string) {
+	if score > 2 {
+		return "", nil
+	}
+	suggestions := []string{"Add another word or two. Uncommon words are better."}
+	var worst *match
+	for k := range seq {
+		if seq[k].kind != "bruteforce" && (worst == nil || seq[k].j-seq[k].i > worst.j-worst.i) {
+			worst = &seq[k]
+		}
+	}
+	if worst == nil {
+		return "", append(suggestions, "Use a longer password.")
+	}
+	part := runes[worst.i:worst.j]
+	if strings.ToLower(string(part)) != string(part) {
+		suggestions = append(suggestions, "Capitalization doesn't help very much.")
+	}
+	switch worst.kind {
+	case "common":
+		if worst.leet {
+			suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much.")
+		}
+		if len(seq) == 1 {
+			return "This is a very common password.", suggestions
+		}
+		return "Common words and passwords are easy to guess.", suggestions
+	case "personal":
+		return "Avoid your username, email address or the name of the site.", suggestions
+	case "repeat":
+		return "Repeats like \"aaa\" are easy to guess.", append(suggestions, "Avoid repeated words and characters.")
+	case "sequence":
+		return "Sequences like \"abc\" or \"6543\" are easy to guess.", append(suggestions, "Avoid sequences.")
+	case "keyboard":
+		return "Straight rows of keys are easy to guess.", append(suggestions, "Use a longer keyboard pattern with more turns.")
+	case "date":
+		return "Dates and years are easy to guess.", append(suggestions, "Avoid dates and years that are associated with you.")
+	}
+	return "", suggestions
+}
+
+// bruteCardinality is what guessing one character costs; like zxcvbn this
+// is 10 whatever the character, as real attackers are smarter than
+// exhaustive search.
+const bruteCardinality = 10
+
+// bruteGuesses is what guessing runes character by character costs.
+func bruteGuesses(runes []rune) float64 {
+	return math.Pow(bruteCardinality, float64(len(runes)))
+}
+
+// minGuesses keeps single characters and short matches from looking free.
+func minGuesses(length int) float64 {
+	if length == 1 {
+		return 10
+	}
+	return 50
+}
+
+// caseVariations is how many capitalisations of a word an attacker tries
+// before reaching this one.
+func caseVariations(runes []rune) float64 {
+	s := string(runes)
+	if s == strings.ToLower(s) {
+		return 1
+	}
+	if s == strings.ToUpper(s) || (unicode.IsUpper(runes[0]) && string(runes[1:]) == strings.ToLower(string(runes[1:]))) {
+		return 2
+	}
+	upper := 0
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	// The number of ways to pick that many capitals from the word
+	v := 0.0
+	for k := 1; k <= upper; k++ {
+		v += binomial(len(runes), k)
+	}
+	return math.Max(v, 2)
+}
+
+func binomial(n, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r = r * float64(n-k+i) / float64(i)
+	}
+	return r
+}
+
+func logFactorial(k int) float64 {
+	lf := 0.0
+	for i := 2; i <= k; i++ {
+		lf += math.Log10(float64(i))
+	}
+	return lf
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// onKeyboardRow reports whether s runs along a keyboard row, either way.
+func onKeyboardRow(s string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, s) || strings.Contains(reverse(row), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// digits returns the number runes spell out, or -1 if they are not all digits.
+func digits(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n
+}
+
+// looksLikeDate reports whether six or eight digits read as a day, month and
+// year in either order, like 311299 or 19991231.
+func looksLikeDate(runes []rune) bool {
+	s := string(runes)
+	two := func(s string) int { return digits([]rune(s)) }
+	valid := func(d, m int) bool { return d >= 1 && d <= 31 && m >= 1 && m <= 12 }
+	if len(s) == 6 {
+		return valid(two(s[0:2]), two(s[2:4])) || valid(two(s[2:4]), two(s[0:2])) || valid(two(s[4:6]), two(s[2:4]))
+	}
+	year := func(s string) bool { y := two(s); return y >= 1900 && y <= 2099 }
+	return (year(s[4:8]) && (valid(two(s[0:2]), two(s[2:4])) || valid(two(s[2:4]), two(s[0:2])))) ||
+		(year(s[0:4]) && valid(two(s[6:8]), two(s[4:6])))
+}
@@ -0,0 +1,57 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		maxScore   int
+		warning    string // part of the warning
+		suggestion string // part of one suggestion, if any
+	}{
+		{"dictionary word", "sunshine", nil, 0, "very common password", ""},
+		{"capitalised word", "Sunshine", nil, 0, "very common password", "Capitalization"},
+		{"l33t", "p@ssw0rd", nil, 0, "very common password", "substitutions"},
+		{"l33t word", "$unsh1ne", nil, 0, "very common password", "substitutions"},
+		{"keyboard row", "zxcvbnm,./", nil, 0, "rows of keys", "keyboard pattern"},
+		{"year", "1987", nil, 0, "Dates and years", "dates"},
+		{"day month year", "31121987", nil, 1, "Dates and years", "dates"},
+		{"year month day", "19871231", nil, 1, "Dates and years", "dates"},
+		{"repeat", "aaaaaaaaaa", nil, 0, "Repeats", "repeated"},
+		{"sequence", "abcdefgh", nil, 0, "Sequences", "sequences"},
+		{"username", "woosterbertram2", []string{"bertram_wooster", "bw@example.com"}, 1, "username", ""},
+		{"email address", "marguerite!!", []string{"ann", "marguerite@example.com"}, 1, "username, email", ""},
+		{"whole email address", "bw@example.com", []string{"bertram", "bw@example.com"}, 0, "username, email", ""},
+		{"site name", "literarylions", nil, 0, "name of the site", ""},
+		{"empty", "", nil, 0, "Enter a password", ""},
+	}
+	for _, tt := range tests {
+		est := Strength(tt.password, tt.userInputs...)
+		if est.Score > tt.maxScore {
+			t.Errorf("%s: %q scores %d, want at most %d", tt.name, tt.password, est.Score, tt.maxScore)
+		}
+		if !strings.Contains(est.Warning, tt.warning) {
+			t.Errorf("%s: warning %q, want it to mention %q", tt.name, est.Warning, tt.warning)
+		}
+		if tt.suggestion != "" && !strings.Contains(strings.Join(est.Suggestions, "\n"), tt.suggestion) {
+			t.Errorf("%s: suggestions %q, want one about %q", tt.name, est.Suggestions, tt.suggestion)
+		}
+	}
+}
+
+func TestStrengthStrong(t *testing.T) {
+	for _, pw := range []string{"correct horse battery staple", "Tr0ub4dor&3", "kX9#mQ2$vL7!"} {
+		if est := Strength(pw, "ann", "ann@example.com"); est.Score < 3 || est.Warning != "" {
+			t.Errorf("%q: score %d, warning %q", pw, est.Score, est.Warning)
+		}
+	}
+	// The same name is only weak for the member it belongs to
+	if est := Strength("woosterbertram2", "ann", "ann@example.com"); est.Score < 3 {
+		t.Errorf("someone else's name scores %d", est.Score)
+	}
+}
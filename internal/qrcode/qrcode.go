@@ -0,0 +1,206 @@
+// Package qrcode draws QR codes (ISO/IEC 18004) as PNG images, for showing
+// two-factor authentication secrets to authenticator apps. It only covers
+// what that needs: byte mode, error correction level M and versions 1 to 10
+// (up to 213 bytes).
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ErrTooLong is returned for data that does not fit in a version 10 code.
+var ErrTooLong = errors.New("qrcode: data too long")
+
+// quietZone is the light border around the code, in modules.
+const quietZone = 4
+
+// block describes the error correction blocks of one version at level M:
+// ec codewords per block, then count blocks of data codewords each, for
+// each of up to two groups.
+type block struct {
+	ec     int
+	groups [][2]int // {count, data codewords}
+}
+
+// blocks is indexed by version.
+var blocks = [...]block{
+	1:  {10, [][2]int{{1, 16}}},
+	2:  {16, [][2]int{{1, 28}}},
+	3:  {26, [][2]int{{1, 44}}},
+	4:  {18, [][2]int{{2, 32}}},
+	5:  {24, [][2]int{{2, 43}}},
+	6:  {16, [][2]int{{4, 27}}},
+	7:  {18, [][2]int{{4, 31}}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}},
+}
+
+// alignments holds the alignment pattern centre coordinates per version.
+var alignments = [...][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+// dataCodewords returns how many data codewords version v holds.
+func dataCodewords(v int) int {
+	n := 0
+	for _, g := range blocks[v].groups {
+		n += g[0] * g[1]
+	}
+	return n
+}
+
+// Code is a QR code: Size×Size modules, true for dark.
+type Code struct {
+	Size    int
+	modules [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode makes the smallest QR code holding data.
+func Encode(data []byte) (*Code, error) {
+	version := 0
+	for v := 1; v < len(blocks); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*dataCodewords(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	m := newMatrix(version)
+	m.drawFunctionPatterns()
+	m.drawCodewords(addErrorCorrection(version, encodeData(version, data)))
+
+	// Use the mask that makes the code easiest to read
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormat(mask)
+		if p := m.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		m.applyMask(mask) // masking twice undoes it
+	}
+	m.applyMask(best)
+	m.drawFormat(best)
+	return &Code{Size: m.size, modules: m.dark}, nil
+}
+
+// PNG renders the code with the standard quiet zone, scale pixels per module.
+func (c *Code) PNG(scale int) ([]byte, error) {
+	side := (c.Size + 2*quietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetColorIndex((quietZone+x)*scale+px, (quietZone+y)*scale+py, 1)
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeData returns the data codewords for data in byte mode, padded to
+// the capacity of the version.
+func encodeData(version int, data []byte) []byte {
+	var b bitBuffer
+	b.append(0b0100, 4) // byte mode
+	if version >= 10 {
+		b.append(len(data), 16)
+	} else {
+		b.append(len(data), 8)
+	}
+	for _, d := range data {
+		b.append(int(d), 8)
+	}
+
+	capacity := 8 * dataCodewords(version)
+	b.append(0, min(4, capacity-len(b))) // terminator
+	b.append(0, (8-len(b)%8)%8)
+	for pad := 0xEC; len(b) < capacity; pad ^= 0xEC ^ 0x11 {
+		b.append(pad, 8)
+	}
+	return b.bytes()
+}
+
+// addErrorCorrection splits the data codewords into blocks, computes each
+// block's error correction codewords and interleaves it all in the order
+// in which the codewords are placed.
+func addErrorCorrection(version int, data []byte) []byte {
+	bl := blocks[version]
+	var dataBlocks, ecBlocks [][]byte
+	for _, g := range bl.groups {
+		for i := 0; i < g[0]; i++ {
+			d := data[:g[1]]
+			data = data[g[1]:]
+			dataBlocks = append(dataBlocks, d)
+			ecBlocks = append(ecBlocks, reedSolomon(d, bl.ec))
+		}
+	}
+
+	var out []byte
+	for i := 0; ; i++ {
+		added := false
+		for _, d := range dataBlocks {
+			if i < len(d) {
+				out = append(out, d[i])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	for i := 0; i < bl.ec; i++ {
+		for _, e := range ecBlocks {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// bitBuffer is a sequence of bits, most significant first.
+type bitBuffer []bool
+
+// append adds the n low bits of v.
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, v>>i&1 == 1)
+	}
+}
+
+// bytes packs the bits (a multiple of 8) into bytes.
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
@@ -0,0 +1,174 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	tests := []struct {
+		name     string
+		data, ec []byte
+	}{
+		{
+			// ISO/IEC 18004 Annex I: "01234567" at 1-M
+			name: "ISO 18004",
+			data: []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			ec:   []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55},
+		},
+		{
+			// "HELLO WORLD" in alphanumeric mode at 1-M
+			name: "HELLO WORLD",
+			data: []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			ec:   []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+	for _, tt := range tests {
+		if got := reedSolomon(tt.data, len(tt.ec)); !bytes.Equal(got, tt.ec) {
+			t.Errorf("%s: reedSolomon = % X, want % X", tt.name, got, tt.ec)
+		}
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	want := []byte{0x40, 0xB4, 0x84, 0x54, 0xC4, 0xC4, 0xF2, 0x05, 0x74, 0xF5, 0x24, 0xC4, 0x40, 0xEC, 0x11, 0xEC}
+	if got := encodeData(1, []byte("HELLO WORLD")); !bytes.Equal(got, want) {
+		t.Errorf("encodeData = % X, want % X", got, want)
+	}
+	// Version 10 and up count the bytes in 16 bits
+	if got := encodeData(10, []byte("A")); !bytes.Equal(got[:4], []byte{0x40, 0x00, 0x14, 0x10}) {
+		t.Errorf("encodeData(10) starts % X, want 40 00 14 10", got[:4])
+	}
+}
+
+func TestAddErrorCorrection(t *testing.T) {
+	// Version 8: two blocks of 38 data codewords, then two of 39
+	data := make([]byte, dataCodewords(8))
+	for i := range data {
+		data[i] = byte(i)
+	}
+	starts := []int{0, 38, 76, 115}
+	out := addErrorCorrection(8, data)
+	if len(out) != len(data)+4*22 {
+		t.Fatalf("%d codewords, want %d", len(out), len(data)+4*22)
+	}
+	for i := 0; i < 38; i++ {
+		for b, s := range starts {
+			if got := out[4*i+b]; got != byte(s+i) {
+				t.Fatalf("codeword %d = %d, want %d (block %d)", 4*i+b, got, s+i, b)
+			}
+		}
+	}
+	// Only the longer blocks have a 39th codeword
+	if got := out[152:154]; !bytes.Equal(got, []byte{114, 153}) {
+		t.Errorf("last data codewords = %v, want [114 153]", got)
+	}
+	ends := []int{38, 76, 115, 154}
+	for b := range starts {
+		ec := reedSolomon(data[starts[b]:ends[b]], 22)
+		for i := range ec {
+			if got := out[len(data)+4*i+b]; got != ec[i] {
+				t.Fatalf("error correction codeword %d of block %d = %X, want %X", i, b, got, ec[i])
+			}
+		}
+	}
+}
+
+// The golden files were checked with a separate decoder, written from the
+// standard, which read the data back from them.
+func TestEncodeGolden(t *testing.T) {
+	tests := []struct {
+		file string
+		data string
+	}{
+		{"hello.txt", "HELLO WORLD"},
+		{"otpauth.txt", "otpauth://totp/Literary%20Lions:ann@example.com?digits=6&issuer=Literary%20Lions&period=30&secret=JBSWY3DPEHPK3PXP"},
+	}
+	for _, tt := range tests {
+		golden, err := os.ReadFile("testdata/" + tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := Encode([]byte(tt.data))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if got := draw(c); got != string(golden) {
+			t.Errorf("%s: Encode(%q) =\n%s\nwant\n%s", tt.file, tt.data, got, golden)
+		}
+	}
+}
+
+// draw writes the code out as rows of '#' (dark) and '.' (light).
+func draw(c *Code) string {
+	var b strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct {
+		n, size int
+	}{
+		{0, 21},
+		{14, 21},  // the most version 1 holds
+		{15, 25},  // version 2
+		{122, 45}, // the most version 7 holds
+		{213, 57}, // the most version 10 holds
+	}
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte("x"), tt.n))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", tt.n, err)
+		}
+		if c.Size != tt.size {
+			t.Errorf("Encode(%d bytes) is %d modules wide, want %d", tt.n, c.Size, tt.size)
+		}
+	}
+	if _, err := Encode(bytes.Repeat([]byte("x"), 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode(214 bytes) = %v, want ErrTooLong", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	c, err := Encode([]byte("HELLO WORLD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := (21 + 2*quietZone) * 4
+	if got := img.Bounds().Dx(); got != side || img.Bounds().Dy() != side {
+		t.Fatalf("image is %v, want %dx%d", img.Bounds(), side, side)
+	}
+	dark := func(x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r == 0
+	}
+	// The quiet zone is light; the top left finder starts after it
+	if dark(0, 0) || dark(quietZone*4-1, quietZone*4-1) {
+		t.Error("quiet zone is not light")
+	}
+	if !dark(quietZone*4, quietZone*4) || !dark(quietZone*4+3, quietZone*4+3) {
+		t.Error("finder pattern corner is not dark")
+	}
+}
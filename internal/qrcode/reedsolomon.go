@@ -0,0 +1,58 @@
+package qrcode
+
+// Arithmetic in GF(256) with the QR code polynomial x^8+x^4+x^3+x^2+1.
+var gfExp, gfLog [256]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+// generator returns the coefficients of (x-α^0)(x-α^1)...(x-α^(n-1)),
+// highest degree first, without the leading 1.
+func generator(n int) []byte {
+	g := make([]byte, n)
+	g[n-1] = 1 // start from the constant polynomial 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		// Multiply by (x - root)
+		for j := 0; j < n; j++ {
+			g[j] = gfMul(g[j], root)
+			if j+1 < n {
+				g[j] ^= g[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return g
+}
+
+// reedSolomon returns the n error correction codewords for data.
+func reedSolomon(data []byte, n int) []byte {
+	g := generator(n)
+	rem := make([]byte, n)
+	for _, d := range data {
+		factor := d ^ rem[0]
+		copy(rem, rem[1:])
+		rem[n-1] = 0
+		for i := range rem {
+			rem[i] ^= gfMul(g[i], factor)
+		}
+	}
+	return rem
+}
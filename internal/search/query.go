@@ -0,0 +1,292 @@
+// Package search parses the forum's search syntax: plain words, "exact
+// phrases", #hashtags and operators such as author:mira, category:Poetry,
+// before:2025-06-01, after:2025-01-01, likes:>10 and sort:new.
+package search
+
+import (
+	"fmt"
+	"literary-lions/internal/hashtag"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the date format of the before: and after: operators.
+const DateLayout = "2006-01-02"
+
+// Kind is the type of a query term.
+type Kind int
+
+const (
+	Word Kind = iota
+	Phrase
+	Tag
+	Author
+	Category
+	Before
+	After
+	Likes
+	Sort
+)
+
+// operators maps each operator keyword to the kind of term it makes.
+var operators = map[string]Kind{
+	"author":   Author,
+	"category": Category,
+	"before":   Before,
+	"after":    After,
+	"likes":    Likes,
+	"sort":     Sort,
+}
+
+// Sort orders accepted by sort:.
+var sortOrders = []string{"relevance", "new", "old", "top"}
+
+// Term is one element of a query. Value is the normalised value (a tag
+// name without '#', a phrase without quotes, an operator's argument);
+// Raw is the term as it was typed.
+type Term struct {
+	Kind  Kind
+	Value string
+	Raw   string
+}
+
+// Label describes the term for a filter chip, e.g. `author: mira`.
+func (t Term) Label() string {
+	switch t.Kind {
+	case Phrase:
+		return `"` + t.Value + `"`
+	case Tag:
+		return "#" + t.Value
+	case Author:
+		return "author: " + t.Value
+	case Category:
+		return "category: " + t.Value
+	case Before:
+		return "before " + t.Value
+	case After:
+		return "after " + t.Value
+	case Likes:
+		return "likes " + t.Value
+	case Sort:
+		return "sorted by " + t.Value
+	}
+	return t.Value
+}
+
+// Query is a parsed search query. Terms keeps every term in the order
+// typed; the other fields collect them by meaning.
+type Query struct {
+	Terms []Term
+
+	Words    []string  // plain words
+	Phrases  []string  // "exact phrases"
+	Tags     []string  // #hashtags
+	Author   string    // author:
+	Category string    // category:
+	Before   time.Time // before: (zero if not set)
+	After    time.Time // after: (zero if not set)
+	LikesOp  string    // likes: comparison, one of > >= < <= = ("" if not set)
+	Likes    int       // likes: number
+	Sort     string    // sort: ("" if not set)
+}
+
+// Error is a problem with the query syntax, worded for the user.
+type Error struct {
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func errorf(format string, args ...any) error {
+	return &Error{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Parse parses a search query. Words that look like operators but use an
+// unknown keyword ("note:") are kept as plain words.
+func Parse(input string) (Query, error) {
+	var q Query
+	rest := input
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		if rest == "" {
+			break
+		}
+		raw, err := nextToken(rest)
+		if err != nil {
+			return q, err
+		}
+		rest = rest[len(raw):]
+		if err := q.add(raw); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// nextToken returns the token at the start of s: a quoted phrase, or a run
+// of non-space characters in which a quote opens a value that may contain
+// spaces (category:"Science Fiction").
+func nextToken(s string) (string, error) {
+	inQuote := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t' || r == '\r' || r == '\n'):
+			return s[:i], nil
+		}
+	}
+	if inQuote {
+		return "", errorf("Missing closing quote in %s", s)
+	}
+	return s, nil
+}
+
+// add parses one token and adds it to the query.
+func (q *Query) add(raw string) error {
+	term := Term{Kind: Word, Value: raw, Raw: raw}
+
+	key, value, isOp := strings.Cut(raw, ":")
+	kind, known := operators[strings.ToLower(key)]
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		term.Kind = Phrase
+		term.Value = strings.Join(strings.Fields(strings.Trim(raw, `"`)), " ")
+		if term.Value == "" {
+			return nil // "" on its own: nothing to search for
+		}
+		q.Phrases = append(q.Phrases, term.Value)
+
+	case strings.HasPrefix(raw, "#") && hashtag.Normalize(raw) != "":
+		term.Kind = Tag
+		term.Value = hashtag.Normalize(raw)
+		q.Tags = append(q.Tags, term.Value)
+
+	case isOp && known:
+		term.Kind = kind
+		term.Value = strings.TrimSpace(strings.Trim(value, `"`))
+		if term.Value == "" {
+			return errorf("%s: needs a value, e.g. %s", key, example(kind))
+		}
+		if err := q.setOperator(&term); err != nil {
+			return err
+		}
+
+	default:
+		term.Value = strings.ReplaceAll(raw, `"`, "")
+		if term.Value == "" {
+			return nil
+		}
+		q.Words = append(q.Words, term.Value)
+	}
+
+	q.Terms = append(q.Terms, term)
+	return nil
+}
+
+// setOperator checks an operator term's value and records it in the query.
+// A repeated operator overrides the earlier one.
+func (q *Query) setOperator(t *Term) error {
+	switch t.Kind {
+	case Author:
+		q.Author = t.Value
+	case Category:
+		q.Category = t.Value
+	case Before, After:
+		d, err := time.Parse(DateLayout, t.Value)
+		if err != nil {
+			return errorf("%q is not a date; use YYYY-MM-DD, e.g. %s", t.Value, example(t.Kind))
+		}
+		if t.Kind == Before {
+			q.Before = d
+		} else {
+			q.After = d
+		}
+	case Likes:
+		op, n, err := parseComparison(t.Value)
+		if err != nil {
+			return err
+		}
+		q.LikesOp, q.Likes = op, n
+		t.Value = op + " " + strconv.Itoa(n)
+	case Sort:
+		t.Value = strings.ToLower(t.Value)
+		for _, s := range sortOrders {
+			if t.Value == s {
+				q.Sort = s
+				return nil
+			}
+		}
+		return errorf("Unknown sort order %q; use one of %s", t.Value, strings.Join(sortOrders, ", "))
+	}
+	return nil
+}
+
+// parseComparison parses a likes: value such as ">10", ">=3", "<5" or "7".
+func parseComparison(s string) (string, int, error) {
+	op := "="
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			s = s[len(candidate):]
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return "", 0, errorf("likes: needs a number, optionally with > >= < <=, e.g. %s", example(Likes))
+	}
+	return op, n, nil
+}
+
+// example shows how an operator is used, for error messages.
+func example(k Kind) string {
+	switch k {
+	case Author:
+		return "author:mira"
+	case Category:
+		return `category:Poetry or category:"Science Fiction"`
+	case Before:
+		return "before:2025-06-01"
+	case After:
+		return "after:2025-01-01"
+	case Likes:
+		return "likes:>10"
+	case Sort:
+		return "sort:new"
+	}
+	return ""
+}
+
+// IsFilter reports whether the term narrows or orders the results (and so
+// is shown as a removable chip) rather than being a plain word.
+func (t Term) IsFilter() bool {
+	return t.Kind != Word
+}
+
+// HasOperators reports whether the query uses anything beyond plain words.
+func (q Query) HasOperators() bool {
+	for _, t := range q.Terms {
+		if t.IsFilter() {
+			return true
+		}
+	}
+	return false
+}
+
+// Text returns the plain words of the query, space separated.
+func (q Query) Text() string {
+	return strings.Join(q.Words, " ")
+}
+
+// Without returns the query as typed, minus term i.
+func (q Query) Without(i int) string {
+	raws := make([]string, 0, len(q.Terms))
+	for j, t := range q.Terms {
+		if j != i {
+			raws = append(raws, t.Raw)
+		}
+	}
+	return strings.Join(raws, " ")
+}
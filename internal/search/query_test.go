@@ -0,0 +1,132 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse(DateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Query // without Terms
+	}{
+		{"", Query{}},
+		{"  dragons   and\tknights ", Query{Words: []string{"dragons", "and", "knights"}}},
+		{`"the  old man" sea`, Query{Phrases: []string{"the old man"}, Words: []string{"sea"}}},
+		{`"" ""`, Query{}},
+		{`category:"Science Fiction" dragons`, Query{Category: "Science Fiction", Words: []string{"dragons"}}},
+		{`CATEGORY:Poetry author:mira`, Query{Category: "Poetry", Author: "mira"}},
+		{`author:mira author:leo`, Query{Author: "leo"}},
+		{"likes:>=10", Query{LikesOp: ">=", Likes: 10}},
+		{"likes:>3", Query{LikesOp: ">", Likes: 3}},
+		{"likes:<=0", Query{LikesOp: "<=", Likes: 0}},
+		{"likes:7", Query{LikesOp: "=", Likes: 7}},
+		{"before:2025-06-01 after:2025-01-01", Query{Before: date("2025-06-01"), After: date("2025-01-01")}},
+		{"sort:NEW", Query{Sort: "new"}},
+		{"note:remember http://example.com", Query{Words: []string{"note:remember", "http://example.com"}}},
+		{"#Poetry #haiku_2 #poetry", Query{Tags: []string{"poetry", "haiku_2", "poetry"}}},
+		{"#1 # #!", Query{Words: []string{"#1", "#", "#!"}}},
+		{`say"hi"`, Query{Words: []string{"sayhi"}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		got.Terms = nil
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) =\n%+v\nwant\n%+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string // part of the message
+	}{
+		{`category:"Science Fiction`, "Missing closing quote"},
+		{`"the old man`, "Missing closing quote"},
+		{`sea "the old man`, "Missing closing quote"},
+		{"likes:many", "likes: needs a number"},
+		{"likes:>", "likes: needs a number"},
+		{"likes:-1", "likes: needs a number"},
+		{"likes:>>3", "likes: needs a number"},
+		{"likes:", "likes: needs a value"},
+		{"before:2025-13-01", "not a date"},
+		{"after:yesterday", "not a date"},
+		{"before:01/06/2025", "not a date"},
+		{"author:", "needs a value"},
+		{`category:""`, "needs a value"},
+		{"sort:random", "Unknown sort order"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		var serr *Error
+		if !errors.As(err, &serr) || !strings.Contains(serr.Msg, tt.err) {
+			t.Errorf("Parse(%q) = %v, want an *Error about %q", tt.input, err, tt.err)
+		}
+	}
+}
+
+func TestTerms(t *testing.T) {
+	q, err := Parse(`dragon #Poetry "old man" likes:>=10 category:"Science Fiction"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Term{
+		{Word, "dragon", "dragon"},
+		{Tag, "poetry", "#Poetry"},
+		{Phrase, "old man", `"old man"`},
+		{Likes, ">= 10", "likes:>=10"},
+		{Category, "Science Fiction", `category:"Science Fiction"`},
+	}
+	if !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("Terms =\n%+v\nwant\n%+v", q.Terms, want)
+	}
+	if !q.HasOperators() || q.Text() != "dragon" {
+		t.Errorf("HasOperators = %v, Text = %q", q.HasOperators(), q.Text())
+	}
+	if plain, _ := Parse("just words"); plain.HasOperators() {
+		t.Error("plain words have operators")
+	}
+}
+
+// Removing a term gives a query that parses to the other terms.
+func TestWithout(t *testing.T) {
+	input := `dragon  #Poetry "the old  man" likes:>=10 category:"Science Fiction" note:x`
+	q, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Without(-1); got != `dragon #Poetry "the old  man" likes:>=10 category:"Science Fiction" note:x` {
+		t.Errorf("Without(-1) = %q", got)
+	}
+	for i := range q.Terms {
+		s := q.Without(i)
+		r, err := Parse(s)
+		if err != nil {
+			t.Errorf("Without(%d) = %q: %v", i, s, err)
+			continue
+		}
+		want := append(append([]Term{}, q.Terms[:i]...), q.Terms[i+1:]...)
+		if !reflect.DeepEqual(r.Terms, want) {
+			t.Errorf("Without(%d) = %q parses to\n%+v\nwant\n%+v", i, s, r.Terms, want)
+		}
+	}
+	if got := q.Without(4); got != `dragon #Poetry "the old  man" likes:>=10 note:x` {
+		t.Errorf("Without(4) = %q", got)
+	}
+}
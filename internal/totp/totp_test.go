@@ -0,0 +1,136 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// RFC 6238, appendix B (SHA-1), cut to the last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+	// Secrets are accepted in lower case, as some people type them
+	if got, _ := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1); got != "287082" {
+		t.Errorf("lower-case secret: got %s", got)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted a malformed secret")
+	}
+}
+
+func TestVerifyWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0) // step 37037037, 1 second in
+	step := Step(now)
+	tests := []struct {
+		name   string
+		offset int64 // the code's step, relative to now's
+		ok     bool
+	}{
+		{"two steps early", -2, false},
+		{"one step early", -1, true},
+		{"current", 0, true},
+		{"one step late", 1, true},
+		{"two steps late", 2, false},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, step+tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := Verify(rfcSecret, code, now)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if ok && got != step+tt.offset {
+			t.Errorf("%s: step = %d, want %d", tt.name, got, step+tt.offset)
+		}
+	}
+}
+
+func TestVerifyStepBoundary(t *testing.T) {
+	// The last second of a step and the first of the next share the window
+	// of the step between them, and no further.
+	start := time.Unix(30*1000, 0) // first second of step 1000
+	code998, _ := Code(rfcSecret, 998)
+	code1001, _ := Code(rfcSecret, 1001)
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		ok   bool
+	}{
+		{"998 at the end of 999", code998, start.Add(-time.Second), true},
+		{"998 at the start of 1000", code998, start, false},
+		{"1001 at the end of 999", code1001, start.Add(-time.Second), false},
+		{"1001 at the start of 1000", code1001, start, true},
+	}
+	for _, tt := range tests {
+		if _, ok := Verify(rfcSecret, tt.code, tt.at); ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+func TestVerifyInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		code string
+		ok   bool
+	}{
+		{"287082", true},
+		{" 287 082 ", true},
+		{"287083", false},
+		{"28708", false},
+		{"2870820", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, ok := Verify(rfcSecret, tt.code, now); ok != tt.ok {
+			t.Errorf("Verify(%q) = %v, want %v", tt.code, ok, tt.ok)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Literary Lions", "ann@example.com", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Literary%20Lions:ann@example.com?digits=6&issuer=Literary%20Lions&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Errorf("URI =\n %s\nwant\n %s", got, want)
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewSecret()
+	if len(a) != 32 || a == b {
+		t.Errorf("NewSecret gave %q and %q", a, b)
+	}
+	if _, err := Code(a, 0); err != nil {
+		t.Errorf("NewSecret gave an unusable secret: %v", err)
+	}
+}
@@ -1,22 +1,143 @@
 package views
 
 import (
+	"context"
 	"html/template"
+	"literary-lions/internal/db"
+	"literary-lions/internal/hashtag"
 	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
 )
 
 // Templates holds all parsed HTML templates for rendering pages throughout the app.
 var Templates *template.Template
 
+// funcs are the helper functions available inside every template.
+var funcs = template.FuncMap{
+	"linkHashtags": LinkHashtags,
+	"highlight":    Highlight,
+	"csrfField":    csrfField,
+}
+
+// CSRFFieldName is the form field that carries the CSRF token.
+const CSRFFieldName = "csrf_token"
+
+// csrfKey is the context key of the request's CSRF token.
+type csrfKey struct{}
+
+// WithCSRFToken returns a copy of ctx carrying the session's CSRF token,
+// for the csrfField template helper.
+func WithCSRFToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, csrfKey{}, token)
+}
+
+// CSRFToken returns the CSRF token of the request's session, or "" if
+// nobody is logged in.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+// Render executes the named template with data. It sets the CSRFToken
+// field of data (see models.BasePageData), or its "CSRFToken" key if data
+// is a map, to the session's CSRF token, so templates can call
+// {{csrfField $.CSRFToken}} inside a form to embed it as a hidden field.
+func Render(w http.ResponseWriter, r *http.Request, name string, data any) error {
+	return Templates.ExecuteTemplate(w, name, withCSRFToken(data, CSRFToken(r)))
+}
+
+// withCSRFToken returns a copy of data with its CSRFToken field or key set
+// to token, or data itself if it has no such field.
+func withCSRFToken(data any, token string) any {
+	if m, ok := data.(map[string]any); ok {
+		m = maps.Clone(m)
+		if m == nil {
+			m = map[string]any{}
+		}
+		m["CSRFToken"] = token
+		return m
+	}
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Struct {
+		return data
+	}
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	if f := c.FieldByName("CSRFToken"); f.IsValid() && f.CanSet() && f.Kind() == reflect.String {
+		f.SetString(token)
+		return c.Interface()
+	}
+	return data
+}
+
+// csrfField returns a hidden form field carrying the CSRF token, or nothing
+// for visitors who are not logged in (and have no token).
+func csrfField(token string) template.HTML {
+	if token == "" {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + CSRFFieldName + `" value="` +
+		template.HTMLEscapeString(token) + `">`)
+}
+
 // InitTemplates parses all HTML templates in the web/templates directory.
 // Should be called once at startup to initialize the Templates variable.
 // If template parsing fails, the app will log a fatal error and exit.
 func InitTemplates() {
 	var err error
 	// Parse all .html files in the web/templates directory
-	Templates, err = template.ParseGlob("web/templates/*.html")
+	Templates, err = template.New("").Funcs(funcs).ParseGlob("web/templates/*.html")
 	if err != nil {
 		// If parsing fails, log the error and stop the application
 		log.Fatal("failed to parse templates:", err)
 	}
 }
+
+// LinkHashtags HTML-escapes text and turns every #hashtag in it into a
+// link to that tag's page.
+func LinkHashtags(text string) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, m := range hashtag.FindAll(text) {
+		b.WriteString(template.HTMLEscapeString(text[last:m.Start]))
+		b.WriteString(`<a class="hashtag" href="/tag/`)
+		b.WriteString(url.PathEscape(m.Name))
+		b.WriteString(`">`)
+		b.WriteString(template.HTMLEscapeString(text[m.Start:m.End]))
+		b.WriteString(`</a>`)
+		last = m.End
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(b.String())
+}
+
+// Highlight HTML-escapes a search snippet and wraps the matches marked with
+// db.SnippetOpen/SnippetClose in <mark> tags.
+func Highlight(snippet string) template.HTML {
+	var b strings.Builder
+	open := false
+	for _, r := range snippet {
+		switch string(r) {
+		case db.SnippetOpen:
+			if !open {
+				b.WriteString("<mark>")
+				open = true
+			}
+		case db.SnippetClose:
+			if open {
+				b.WriteString("</mark>")
+				open = false
+			}
+		default:
+			b.WriteString(template.HTMLEscapeString(string(r)))
+		}
+	}
+	if open {
+		b.WriteString("</mark>")
+	}
+	return template.HTML(b.String())
+}
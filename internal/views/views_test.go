@@ -0,0 +1,64 @@
+package views
+
+import (
+	"testing"
+
+	"literary-lions/internal/models"
+)
+
+func TestWithCSRFToken(t *testing.T) {
+	type page struct {
+		models.BasePageData
+		Title string
+	}
+	orig := page{BasePageData: models.BasePageData{Username: "ann", LoggedIn: true}, Title: "Hi"}
+	got, ok := withCSRFToken(orig, "tok").(page)
+	if !ok || got.CSRFToken != "tok" || got.Username != "ann" || got.Title != "Hi" {
+		t.Errorf("struct: got %+v", got)
+	}
+	if orig.CSRFToken != "" {
+		t.Error("struct: the caller's data was changed")
+	}
+
+	m := map[string]any{"LoginError": "no"}
+	gotMap := withCSRFToken(m, "tok").(map[string]any)
+	if gotMap["CSRFToken"] != "tok" || gotMap["LoginError"] != "no" {
+		t.Errorf("map: got %v", gotMap)
+	}
+	if _, changed := m["CSRFToken"]; changed {
+		t.Error("map: the caller's map was changed")
+	}
+
+	// Data without a CSRFToken field is passed through
+	for _, data := range []any{nil, "text", struct{ Title string }{"Hi"}, &page{}} {
+		if got := withCSRFToken(data, "tok"); got != data {
+			t.Errorf("%#v: got %#v", data, got)
+		}
+	}
+}
+
+func TestCSRFField(t *testing.T) {
+	if got := csrfField(""); got != "" {
+		t.Errorf(`csrfField("") = %q, want nothing`, got)
+	}
+	want := `<input type="hidden" name="csrf_token" value="a&lt;b">`
+	if got := csrfField("a<b"); string(got) != want {
+		t.Errorf("csrfField = %q, want %q", got, want)
+	}
+}
+
+func TestLinkHashtags(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"Reading #Books", `Reading <a class="hashtag" href="/tag/books">#Books</a>`},
+		{"#книги", `<a class="hashtag" href="/tag/%D0%BA%D0%BD%D0%B8%D0%B3%D0%B8">#книги</a>`},
+		{"Tom's <b>#1</b>", "Tom&#39;s &lt;b&gt;#1&lt;/b&gt;"},
+		{"Tom&#39;s page#anchor", "Tom&amp;#39;s page#anchor"},
+	}
+	for _, tt := range tests {
+		if got := LinkHashtags(tt.text); string(got) != tt.want {
+			t.Errorf("LinkHashtags(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}